@@ -3,8 +3,10 @@ package gorelic
 import (
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"sort"
+	"sync"
+	"time"
 
 	metrics "github.com/yvasiyarov/go-metrics"
 	nrpg "github.com/yvasiyarov/newrelic_platform_go"
@@ -46,15 +48,65 @@ type Agent struct {
 	CollectGcStat               bool
 	CollectMemoryStat           bool
 	CollectHTTPStat             bool
+	CollectContainerStat        bool
+	CollectHostStat             bool
+	CollectSocketStat           bool
+	CollectExpvarStat           bool
+	ExpvarInclude               []string
+	ExpvarExclude               []string
+	ExpvarDeltas                []string
+	HostMountPoints             []string
+	CgroupRoot                  string
+	ProcRoot                    string
+	SysRoot                     string
+	SystemPollInterval          int
 	GCPollInterval              int
 	MemoryAllocatorPollInterval int
 	AgentGUID                   string
 	AgentVersion                string
-	plugin                      *nrpg.NewrelicPlugin
+	BuildInfo                   *BuildInfo
+	Metadata                    map[string]string
+	Labels                      map[string]string
+	Reporters                   []MetricsReporter
+	MaxEventsPerHarvest         int
+	AutoRecordDeployment        bool
+	DeploymentRevisionFile      string
+	StatusRedactSecrets         bool
+	DatastoreQueryMetrics       bool
+	DatastoreMaxQueries         int
+	ExternalMaxDestinations     int
+	Logger                      Logger
+	Clock                       Clock
+	config                      *runConfig
+	configLock                  sync.Mutex
+	reconfigureLock             sync.Mutex
+	configReporters             []MetricsReporter
+	reportersConfig             ReportersConfig
+	configLabels                map[string]string
+	proxyURL                    string
+	gcCollector                 *pollingCollector
+	memoryCollector             *pollingCollector
+	pollIntervalChanged         chan struct{}
+	stopped                     chan struct{}
+	harvestLoopDone             chan struct{}
+	stopOnce                    sync.Once
+	events                      *eventReservoir
+	externals                   *externalSource
+	datastores                  *datastoreSource
+	httpInFlight                *httpInFlight
+	stats                       *agentStats
+	registry                    *metricaRegistry
+	metricaSources              []iMetricaSource
+	component                   iComponent
+	lastHarvest                 time.Time
+	failingMetricas             map[string]bool
+	harvestLock                 sync.Mutex
+	httpPathsLock               sync.Mutex
 	HTTPTimer                   metrics.Timer
 	HTTPRequestCounter          metrics.Counter
 	HTTPRequestErrorCounter     metrics.Counter
 	HTTPStatusCounters          map[int]metrics.Counter
+	HTTPMethodCounters          map[string]metrics.Counter
 	HTTPErrorCounters           map[int]metrics.Counter
 	HTTPPathErrorCounters       map[string]map[int]metrics.Counter
 	Tracer                      *Tracer
@@ -75,10 +127,28 @@ func NewAgent() *Agent {
 		CollectMemoryStat:           true,
 		GCPollInterval:              DefaultGcPollIntervalInSeconds,
 		MemoryAllocatorPollInterval: DefaultMemoryAllocatorPollIntervalInSeconds,
+		CgroupRoot:                  DefaultCgroupRoot,
+		ProcRoot:                    DefaultProcRoot,
+		SysRoot:                     DefaultSysRoot,
+		HostMountPoints:             append([]string(nil), DefaultHostMountPoints...),
+		ExpvarExclude:               append([]string(nil), DefaultExpvarExclude...),
+		SystemPollInterval:          DefaultSystemPollIntervalInSeconds,
 		AgentGUID:                   DefaultAgentGuid,
 		AgentVersion:                CurrentAgentVersion,
 		Tracer:                      nil,
 		CustomMetrics:               make([]nrpg.IMetrica, 0),
+		Metadata:                    make(map[string]string),
+		Labels:                      make(map[string]string),
+		MaxEventsPerHarvest:         DefaultMaxEventsPerHarvest,
+		StatusRedactSecrets:         true,
+		DatastoreMaxQueries:         DefaultDatastoreMaxQueries,
+		ExternalMaxDestinations:     DefaultExternalMaxDestinations,
+		Clock:                       SystemClock,
+		events:                      newEventReservoir(DefaultMaxEventsPerHarvest),
+		externals:                   newExternalSource(),
+		datastores:                  newDatastoreSource(),
+		httpInFlight:                newHTTPInFlight(),
+		stats:                       newAgentStats(),
 		HTTPPathErrorCounters:       make(map[string]map[int]metrics.Counter),
 	}
 	return agent
@@ -86,25 +156,33 @@ func NewAgent() *Agent {
 
 // our custom component
 type resettableComponent struct {
-	nrpg.IComponent
+	iComponent
 	requestCounter      metrics.Counter
 	requestErrorCounter metrics.Counter
 	statusCounters      map[int]metrics.Counter
+	methodCounters      map[string]metrics.Counter
 	errorCounters       map[int]metrics.Counter
 	errorPathCounters   map[string]map[int]metrics.Counter
+	// pathsLock guards errorPathCounters, paths can be registered after Run
+	pathsLock *sync.Mutex
 }
 
-// nrpg.IComponent interface implementation
+// iComponent interface implementation
 func (c resettableComponent) ClearSentData() {
-	c.IComponent.ClearSentData()
+	c.iComponent.ClearSentData()
 	c.requestCounter.Clear()
 	c.requestErrorCounter.Clear()
 	for _, counter := range c.statusCounters {
 		counter.Clear()
 	}
+	for _, counter := range c.methodCounters {
+		counter.Clear()
+	}
 	for _, counter := range c.errorCounters {
 		counter.Clear()
 	}
+	c.pathsLock.Lock()
+	defer c.pathsLock.Unlock()
 	for _, counters := range c.errorPathCounters {
 		for _, counter := range counters {
 			counter.Clear()
@@ -127,12 +205,15 @@ func (agent *Agent) WrapHTTPHandlerFunc(h tHTTPHandlerFunc, path string) tHTTPHa
 	agent.registerHTTPPath(path)
 	agent.CollectHTTPStat = true
 	agent.initTimer()
+	inFlight := agent.httpInFlight.gauges(path)
 	return func(w http.ResponseWriter, req *http.Request) {
 		proxy := newHTTPHandlerFunc(h)
 		proxy.timer = agent.HTTPTimer
+		proxy.now = agent.clock().Now
+		proxy.inFlight = inFlight
 		myW := &statusLoggingResponseWriter{w, 200}
 		proxy.ServeHTTP(myW, req)
-		agent.recordResponse(path, myW.status)
+		agent.recordResponse(path, req.Method, myW.status)
 	}
 }
 
@@ -143,36 +224,184 @@ func (agent *Agent) WrapHTTPHandler(h http.Handler) http.Handler {
 
 	proxy := newHTTPHandler(h)
 	proxy.timer = agent.HTTPTimer
+	proxy.now = agent.clock().Now
+	proxy.inFlight = agent.httpInFlight.gauges("")
 	return proxy
 }
 
 //AddCustomMetric adds metric to be collected periodically with NewrelicPollInterval interval
 func (agent *Agent) AddCustomMetric(metric nrpg.IMetrica) {
 	agent.CustomMetrics = append(agent.CustomMetrics, metric)
+	// Metrics added after Run are registered immediately
+	if agent.component != nil {
+		agent.component.AddMetrica(metric)
+	}
+}
+
+//AddReporter adds reporter harvested metrics will be sent to, in addition to NewRelic.
+//Reporters should be added before Run.
+func (agent *Agent) AddReporter(reporter MetricsReporter) {
+	agent.Reporters = append(agent.Reporters, reporter)
+}
+
+// runConfig is configuration used by running agent. It is taken by Run and replaced by Reconfigure,
+// so changes of Agent fields after Run have no effect.
+type runConfig struct {
+	pollInterval time.Duration
+	license      string
+	name         string
+	verbose      bool
+	client       http.Client
+	// reporters are added reporters followed by configured ones and NewRelic one
+	reporters        []MetricsReporter
+	addedReporters   []MetricsReporter
+	configReporters  []MetricsReporter
+	platformReporter *platformReporter
+	metadata         map[string]string
+	labels           map[string]string
+	// reportersConfig, configLabels and proxyURL are settings of last applied config
+	reportersConfig    ReportersConfig
+	configLabels       map[string]string
+	proxyURL           string
+	collectGcStat      bool
+	gcPollInterval     int
+	collectMemoryStat  bool
+	memoryPollInterval int
+}
+
+// newRunConfig copies settings of agent
+func newRunConfig(agent *Agent) *runConfig {
+	config := &runConfig{
+		pollInterval:       time.Duration(agent.NewrelicPollInterval) * time.Second,
+		license:            agent.NewrelicLicense,
+		name:               agent.NewrelicName,
+		verbose:            agent.Verbose,
+		client:             agent.Client,
+		reporters:          append([]MetricsReporter(nil), agent.Reporters...),
+		metadata:           make(map[string]string, len(agent.Metadata)),
+		labels:             make(map[string]string, len(agent.Labels)),
+		collectGcStat:      agent.CollectGcStat,
+		gcPollInterval:     agent.GCPollInterval,
+		collectMemoryStat:  agent.CollectMemoryStat,
+		memoryPollInterval: agent.MemoryAllocatorPollInterval,
+		reportersConfig:    agent.reportersConfig,
+		configLabels:       agent.configLabels,
+		proxyURL:           agent.proxyURL,
+	}
+	for _, reporter := range agent.Reporters {
+		if platform, ok := reporter.(*platformReporter); ok {
+			config.platformReporter = platform
+		} else if containsReporter(agent.configReporters, reporter) {
+			config.configReporters = append(config.configReporters, reporter)
+		} else {
+			config.addedReporters = append(config.addedReporters, reporter)
+		}
+	}
+	for key, value := range agent.Metadata {
+		config.metadata[key] = value
+	}
+	for key, value := range agent.Labels {
+		config.labels[key] = value
+	}
+	return config
+}
+
+func containsReporter(reporters []MetricsReporter, reporter MetricsReporter) bool {
+	for _, other := range reporters {
+		if other == reporter {
+			return true
+		}
+	}
+	return false
+}
+
+// runConfig returns configuration of running agent, or configuration taken from fields if agent is not running
+func (agent *Agent) runConfig() *runConfig {
+	agent.configLock.Lock()
+	config := agent.config
+	agent.configLock.Unlock()
+	if config == nil {
+		return newRunConfig(agent)
+	}
+	return config
 }
 
 //Run initialize Agent instance and start harvest go routine
 func (agent *Agent) Run() error {
-	if agent.NewrelicLicense == "" {
-		return errors.New("please, pass a valid newrelic license key")
+	agent.configLock.Lock()
+	running := agent.config != nil
+	agent.configLock.Unlock()
+	if running {
+		return errors.New("agent is already running")
+	}
+	if err := agent.validate(); err != nil {
+		return err
 	}
 
-	var component nrpg.IComponent
-	component = nrpg.NewPluginComponent(agent.NewrelicName, agent.AgentGUID, agent.Verbose)
+	// Expvar patterns are checked before any collector is started.
+	if agent.CollectExpvarStat {
+		source, err := newExpvarSource(agent.ExpvarInclude, agent.ExpvarExclude, agent.ExpvarDeltas)
+		if err != nil {
+			return fmt.Errorf("invalid expvar pattern: %v", err)
+		}
+		agent.metricaSources = append(agent.metricaSources, source)
+		agent.logger().Debug("Init expvar metrics collection.")
+	}
+
+	agent.registry = newMetricaRegistry()
+	var component iComponent
+	component = agent.registry
+
+	// Build info is reported as metrics and attached to every harvest.
+	agent.BuildInfo = ReadBuildInfo()
+	if agent.Metadata == nil {
+		agent.Metadata = make(map[string]string)
+	}
+	for key, value := range agent.BuildInfo.Metadata() {
+		if _, ok := agent.Metadata[key]; !ok {
+			agent.Metadata[key] = value
+		}
+	}
+	addBuildMetricsToComponent(component, agent.BuildInfo)
+	agent.logger().Debug("Build info.", "go", agent.BuildInfo.GoVersion, "os", agent.BuildInfo.GOOS, "arch", agent.BuildInfo.GOARCH, "revision", agent.BuildInfo.Revision, "gomaxprocs", agent.BuildInfo.GOMAXPROCS)
+
+	agent.events.setCapacity(agent.MaxEventsPerHarvest)
+	addEventMetricsToComponent(component, agent.events)
+	agent.metricaSources = append(agent.metricaSources, newAgentStatsSource(agent.stats), agent.externals, agent.datastores)
 
 	// Add default metrics and tracer.
-	addRuntimeMericsToComponent(component)
-	agent.Tracer = newTracer(component)
+	clock := agent.clock()
+	addRuntimeMericsToComponent(component, agent.ProcRoot, agent.SystemPollInterval, clock.Now)
+	agent.Tracer = newTracer(component, clock.Now)
 
 	// Check agent flags and add relevant metrics.
+	// GC and memory collectors could be restarted by Reconfigure, so their metricas are taken from sources.
+	agent.gcCollector = newPollingCollector(clock, addGCMetricsToComponent)
+	agent.memoryCollector = newPollingCollector(clock, addMemoryMericsToComponent)
+	agent.metricaSources = append(agent.metricaSources, agent.gcCollector, agent.memoryCollector)
 	if agent.CollectGcStat {
-		addGCMetricsToComponent(component, agent.GCPollInterval)
-		agent.debug(fmt.Sprintf("Init GC metrics collection. Poll interval %d seconds.", agent.GCPollInterval))
+		agent.gcCollector.restart(true, agent.GCPollInterval)
+		agent.logger().Debug("Init GC metrics collection.", "pollInterval", agent.GCPollInterval)
 	}
 
 	if agent.CollectMemoryStat {
-		addMemoryMericsToComponent(component, agent.MemoryAllocatorPollInterval)
-		agent.debug(fmt.Sprintf("Init memory allocator metrics collection. Poll interval %d seconds.", agent.MemoryAllocatorPollInterval))
+		agent.memoryCollector.restart(true, agent.MemoryAllocatorPollInterval)
+		agent.logger().Debug("Init memory allocator metrics collection.", "pollInterval", agent.MemoryAllocatorPollInterval)
+	}
+
+	if agent.CollectContainerStat {
+		addContainerMetricsToComponent(component, agent.CgroupRoot, agent.ProcRoot, clock.Now)
+		agent.logger().Debug("Init container metrics collection.", "cgroupRoot", agent.CgroupRoot)
+	}
+
+	if agent.CollectSocketStat {
+		addSocketMetricsToComponent(component, agent.ProcRoot, agent.SystemPollInterval, clock.Now)
+		agent.logger().Debug("Init socket metrics collection.", "pollInterval", agent.SystemPollInterval)
+	}
+
+	if agent.CollectHostStat {
+		addHostMetricsToComponent(component, agent.ProcRoot, agent.SysRoot, agent.HostMountPoints, clock.Now)
+		agent.logger().Debug("Init host metrics collection.")
 	}
 
 	if agent.CollectHTTPStat {
@@ -181,44 +410,118 @@ func (agent *Agent) Run() error {
 		agent.initErrorCounters()
 
 		addHTTPMericsToComponent(component, agent.HTTPTimer, agent.HTTPRequestCounter, agent.HTTPRequestErrorCounter)
-		agent.debug(fmt.Sprintf("Init HTTP metrics collection."))
+		agent.metricaSources = append(agent.metricaSources, newHTTPInFlightSource(agent.httpInFlight, clock.Now))
+		agent.logger().Debug("Init HTTP metrics collection.")
 
-		component = &resettableComponent{component, agent.HTTPRequestCounter, agent.HTTPRequestErrorCounter, agent.HTTPStatusCounters, agent.HTTPErrorCounters, agent.HTTPPathErrorCounters}
+		component = &resettableComponent{component, agent.HTTPRequestCounter, agent.HTTPRequestErrorCounter, agent.HTTPStatusCounters, agent.HTTPMethodCounters, agent.HTTPErrorCounters, agent.HTTPPathErrorCounters, &agent.httpPathsLock}
 		addHTTPStatusMetricsToComponent(component, agent.HTTPStatusCounters)
-		agent.debug(fmt.Sprintf("Init HTTP status metrics collection."))
+		addHTTPMethodMetricsToComponent(component, agent.HTTPMethodCounters)
+		agent.logger().Debug("Init HTTP status metrics collection.")
 
 		addHTTPErrorMetricsToComponent(component, agent.HTTPErrorCounters)
 		addHTTPPathErrorMetricsToComponent(component, agent.HTTPPathErrorCounters)
-		agent.debug(fmt.Sprintf("Init HTTP status metrics collection."))
+		agent.logger().Debug("Init HTTP status metrics collection.")
 	}
 
 	for _, metric := range agent.CustomMetrics {
 		component.AddMetrica(metric)
-		agent.debug(fmt.Sprintf("Init %s metric collection.", metric.GetName()))
+		agent.logger().Debug("Init custom metric collection.", "metric", metric.GetName())
+	}
+
+	for _, source := range agent.metricaSources {
+		agent.registry.addSource(source)
 	}
 
+	agent.component = component
+
 	// Init newrelic reporting plugin.
-	agent.plugin = nrpg.NewNewrelicPlugin(agent.AgentVersion, agent.NewrelicLicense, agent.NewrelicPollInterval)
-	agent.plugin.Client = agent.Client
-	agent.plugin.Verbose = agent.Verbose
+	if agent.NewrelicLicense != "" {
+		agent.AddReporter(newPlatformReporter(agent.NewrelicName, agent.AgentGUID, agent.AgentVersion, agent.NewrelicLicense, agent.NewrelicPollInterval, agent.Client, agent.Verbose))
+	}
+
+	// Configuration is immutable from now on, it could be changed with Reconfigure only.
+	agent.pollIntervalChanged = make(chan struct{}, 1)
+	agent.stopped = make(chan struct{})
+	agent.harvestLoopDone = make(chan struct{})
+	agent.configLock.Lock()
+	agent.config = newRunConfig(agent)
+	agent.configLock.Unlock()
 
-	// Add our metrics component to the plugin.
-	agent.plugin.AddComponent(component)
+	if agent.AutoRecordDeployment {
+		go agent.recordDeploymentOnRevisionChange()
+	}
 
 	// Start reporting!
-	go agent.plugin.Run()
+	agent.stats.setRunning(clock.Now)
+	go agent.harvestLoop()
 	return nil
 }
 
-//RegisterHTTPPath registers a path for error status tracking
+// Stop stops harvest loop and GC and memory collectors, it returns once harvest in progress is finished.
+// Metrics collected since the last harvest are not reported. Stopped agent can not be run or reconfigured again.
+func (agent *Agent) Stop() {
+	agent.reconfigureLock.Lock()
+	defer agent.reconfigureLock.Unlock()
+	agent.configLock.Lock()
+	running := agent.config != nil
+	agent.configLock.Unlock()
+	if !running {
+		return
+	}
+	agent.stopOnce.Do(func() {
+		close(agent.stopped)
+		<-agent.harvestLoopDone
+		agent.gcCollector.restart(false, 0)
+		agent.memoryCollector.restart(false, 0)
+		agent.stats.setStopped()
+		agent.logger().Debug("Agent stopped.")
+	})
+}
+
+//RegisterHTTPPath registers a path for error status tracking.
+//Counters of paths registered after Run are created and reported immediately.
 func (agent *Agent) registerHTTPPath(path string) {
-	if agent.HTTPPathErrorCounters[path] == nil {
-		agent.HTTPPathErrorCounters[path] = make(map[int]metrics.Counter)
+	agent.httpPathsLock.Lock()
+	if agent.HTTPPathErrorCounters[path] != nil {
+		agent.httpPathsLock.Unlock()
+		return
+	}
+	counters := make(map[int]metrics.Counter)
+	running := agent.component != nil && agent.HTTPErrorCounters != nil
+	if running {
+		for statusCode := range httpErrors {
+			counters[statusCode] = metrics.NewCounter()
+		}
+	}
+	agent.HTTPPathErrorCounters[path] = counters
+	agent.httpPathsLock.Unlock()
+
+	if running {
+		addHTTPPathErrorMetricsToComponent(agent.component, map[string]map[int]metrics.Counter{path: counters})
 	}
 }
 
+// registeredHTTPPaths returns number of paths errors of which are tracked
+func (agent *Agent) registeredHTTPPaths() int {
+	agent.httpPathsLock.Lock()
+	defer agent.httpPathsLock.Unlock()
+	return len(agent.HTTPPathErrorCounters)
+}
+
+// httpPaths returns sorted paths errors of which are tracked
+func (agent *Agent) httpPaths() []string {
+	agent.httpPathsLock.Lock()
+	paths := make([]string, 0, len(agent.HTTPPathErrorCounters))
+	for path := range agent.HTTPPathErrorCounters {
+		paths = append(paths, path)
+	}
+	agent.httpPathsLock.Unlock()
+	sort.Strings(paths)
+	return paths
+}
+
 //RecordResponse increments different counters accordingly for an HTTP request
-func (agent *Agent) recordResponse(path string, code int) {
+func (agent *Agent) recordResponse(path string, method string, code int) {
 	if agent.HTTPRequestCounter != nil {
 		agent.HTTPRequestCounter.Inc(1)
 	}
@@ -227,10 +530,18 @@ func (agent *Agent) recordResponse(path string, code int) {
 		agent.HTTPStatusCounters[code].Inc(1)
 	}
 
-	if httpErrors[code] {
+	if counter := agent.HTTPMethodCounters[method]; counter != nil {
+		counter.Inc(1)
+	}
+
+	// error counters are not created if HTTP metrics were not collected at Run
+	if httpErrors[code] && agent.HTTPErrorCounters != nil {
 		agent.HTTPRequestErrorCounter.Inc(1)
 		agent.HTTPErrorCounters[code].Inc(1)
-		if counters := agent.HTTPPathErrorCounters[path]; counters != nil {
+		agent.httpPathsLock.Lock()
+		counters := agent.HTTPPathErrorCounters[path]
+		agent.httpPathsLock.Unlock()
+		if counters != nil {
 			counters[code].Inc(1)
 		}
 	}
@@ -249,6 +560,10 @@ func (agent *Agent) initStatusCounters() {
 	for _, statusCode := range httpStatuses {
 		agent.HTTPStatusCounters[statusCode] = metrics.NewCounter()
 	}
+	agent.HTTPMethodCounters = make(map[string]metrics.Counter, len(httpMethods))
+	for _, method := range httpMethods {
+		agent.HTTPMethodCounters[method] = metrics.NewCounter()
+	}
 	agent.HTTPRequestCounter = metrics.NewCounter()
 }
 
@@ -265,10 +580,3 @@ func (agent *Agent) initErrorCounters() {
 	}
 	agent.HTTPRequestErrorCounter = metrics.NewCounter()
 }
-
-//Print debug messages
-func (agent *Agent) debug(msg string) {
-	if agent.Verbose {
-		log.Println(msg)
-	}
-}
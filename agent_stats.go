@@ -0,0 +1,327 @@
+package gorelic
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+// Failure reasons of reporters
+const (
+	FailureTimeout = "Timeout"
+	FailureNetwork = "Network"
+	FailureHTTP4xx = "HTTP4xx"
+	FailureHTTP5xx = "HTTP5xx"
+	FailureOther   = "Other"
+)
+
+// DefaultMaxRecentErrors is number of last errors kept in AgentStats.RecentErrors
+const DefaultMaxRecentErrors = 20
+
+// AgentStats describes health of the agent itself. It is returned by Agent.Stats and reported as Agent/... metrics.
+type AgentStats struct {
+	// Running is set once Run succeeded and cleared by Stop
+	Running             bool
+	StartTime           time.Time
+	Harvests            int64
+	LastHarvestTime     time.Time
+	LastHarvestDuration time.Duration
+	// LastHarvestMetrics is number of metrics taken by last harvest
+	LastHarvestMetrics int
+	// GetValueErrors is total number of metricas GetValue errors, MetricErrors splits it by metric name
+	GetValueErrors int64
+	MetricErrors   map[string]int64
+	HTTPPaths      int
+	Traces         int
+	Reporters      []ReporterStats
+	// RecentErrors are last DefaultMaxRecentErrors errors of metricas, reporters and deployments, oldest first
+	RecentErrors []AgentError
+}
+
+// AgentError is an error happened in background, Source is a metric or reporter name
+type AgentError struct {
+	Time    time.Time
+	Source  string
+	Message string
+}
+
+// ReporterStats describes results of sending harvests by one reporter
+type ReporterStats struct {
+	Name      string
+	Successes int64
+	Failures  int64
+	// FailuresByReason splits failures by FailureTimeout, FailureNetwork, FailureHTTP4xx, FailureHTTP5xx and FailureOther
+	FailuresByReason    map[string]int64
+	ConsecutiveFailures int64
+	// SentBytes is total size of sent payloads, it is known for reporters implementing PayloadReporter only
+	SentBytes   int64
+	LastAttempt time.Time
+	LastSuccess time.Time
+	LastError   string
+}
+
+// PayloadReporter is implemented by reporters which know size of sent payloads
+type PayloadReporter interface {
+	// SentBytes returns total size of payloads sent so far
+	SentBytes() int64
+}
+
+// httpStatusError is returned by reporters when collector responded with unsuccessful status
+type httpStatusError struct {
+	endpoint string
+	status   string
+	code     int
+	body     string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s responded with %s: %s", e.endpoint, e.status, e.body)
+}
+
+// failureReason classifies reporter error
+func failureReason(err error) string {
+	if statusErr, ok := err.(*httpStatusError); ok {
+		if statusErr.code >= 500 {
+			return FailureHTTP5xx
+		}
+		return FailureHTTP4xx
+	}
+	if netErr, ok := err.(net.Error); ok {
+		if netErr.Timeout() {
+			return FailureTimeout
+		}
+		return FailureNetwork
+	}
+	return FailureOther
+}
+
+// reporterName is type name of reporter, index is added to names of reporters with the same type
+func reporterName(reporter MetricsReporter, index int, reporters []MetricsReporter) string {
+	reporterType := reflect.TypeOf(reporter)
+	name := reporterType.String()
+	if reporterType.Kind() == reflect.Ptr {
+		name = reporterType.Elem().Name()
+	} else if reporterType.Name() != "" {
+		name = reporterType.Name()
+	}
+	for i, other := range reporters {
+		if i != index && reflect.TypeOf(other) == reporterType {
+			return fmt.Sprintf("%s%d", name, index)
+		}
+	}
+	return name
+}
+
+// agentStats collects AgentStats, it is updated by harvest goroutine and read by any goroutine
+type agentStats struct {
+	sync.Mutex
+	stats AgentStats
+	now   func() time.Time
+	// metrics are values taken by last harvest
+	metrics []Metric
+}
+
+func newAgentStats() *agentStats {
+	return &agentStats{
+		stats: AgentStats{MetricErrors: make(map[string]int64)},
+		now:   time.Now,
+	}
+}
+
+// setRunning marks agent as started, now tells time of errors and statistic from now on
+func (s *agentStats) setRunning(now func() time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.now = now
+	s.stats.Running = true
+	s.stats.StartTime = now()
+}
+
+// setStopped marks agent as stopped
+func (s *agentStats) setStopped() {
+	s.Lock()
+	defer s.Unlock()
+	s.stats.Running = false
+}
+
+func (s *agentStats) recordHarvest(startTime time.Time, duration time.Duration, metrics []Metric, errs []error) {
+	s.Lock()
+	defer s.Unlock()
+	s.stats.Harvests++
+	s.stats.LastHarvestTime = startTime
+	s.stats.LastHarvestDuration = duration
+	s.stats.LastHarvestMetrics = len(metrics)
+	s.metrics = metrics
+	for _, err := range errs {
+		s.stats.GetValueErrors++
+		source := "harvest"
+		if metricaErr, ok := err.(*metricaError); ok {
+			s.stats.MetricErrors[metricaErr.name]++
+			source = metricaErr.name
+		}
+		s.addError(startTime, source, err)
+	}
+}
+
+// currentTime returns time of agent clock
+func (s *agentStats) currentTime() time.Time {
+	s.Lock()
+	defer s.Unlock()
+	return s.now()
+}
+
+// recordError keeps error happened outside of harvest
+func (s *agentStats) recordError(source string, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.addError(s.now(), source, err)
+}
+
+// addError appends error to RecentErrors dropping the oldest one, lock should be held
+func (s *agentStats) addError(errorTime time.Time, source string, err error) {
+	if len(s.stats.RecentErrors) >= DefaultMaxRecentErrors {
+		s.stats.RecentErrors = append(s.stats.RecentErrors[:0], s.stats.RecentErrors[1:]...)
+	}
+	s.stats.RecentErrors = append(s.stats.RecentErrors, AgentError{errorTime, source, err.Error()})
+}
+
+func (s *agentStats) recordReport(index int, reporters []MetricsReporter, attemptTime time.Time, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for len(s.stats.Reporters) <= index {
+		s.stats.Reporters = append(s.stats.Reporters, ReporterStats{FailuresByReason: make(map[string]int64)})
+	}
+
+	reporter := &s.stats.Reporters[index]
+	reporter.Name = reporterName(reporters[index], index, reporters)
+	reporter.LastAttempt = attemptTime
+	if payloadReporter, ok := reporters[index].(PayloadReporter); ok {
+		reporter.SentBytes = payloadReporter.SentBytes()
+	}
+	if err != nil {
+		reporter.Failures++
+		reporter.FailuresByReason[failureReason(err)]++
+		reporter.ConsecutiveFailures++
+		reporter.LastError = err.Error()
+		s.addError(attemptTime, reporter.Name, err)
+		return
+	}
+	reporter.Successes++
+	reporter.ConsecutiveFailures = 0
+	reporter.LastSuccess = attemptTime
+	reporter.LastError = ""
+}
+
+// resetReporters starts reporters statistic over, it is done when reporters are replaced
+func (s *agentStats) resetReporters() {
+	s.Lock()
+	defer s.Unlock()
+	s.stats.Reporters = nil
+}
+
+func (s *agentStats) setRegistered(httpPaths int, traces int) {
+	s.Lock()
+	defer s.Unlock()
+	s.stats.HTTPPaths = httpPaths
+	s.stats.Traces = traces
+}
+
+// snapshot returns deep copy of stats
+func (s *agentStats) snapshot() AgentStats {
+	s.Lock()
+	defer s.Unlock()
+	stats := s.stats
+	stats.MetricErrors = make(map[string]int64, len(s.stats.MetricErrors))
+	for name, count := range s.stats.MetricErrors {
+		stats.MetricErrors[name] = count
+	}
+	stats.Reporters = make([]ReporterStats, len(s.stats.Reporters))
+	for i, reporter := range s.stats.Reporters {
+		stats.Reporters[i] = reporter
+		stats.Reporters[i].FailuresByReason = make(map[string]int64, len(reporter.FailuresByReason))
+		for reason, count := range reporter.FailuresByReason {
+			stats.Reporters[i].FailuresByReason[reason] = count
+		}
+	}
+	stats.RecentErrors = append([]AgentError(nil), s.stats.RecentErrors...)
+	return stats
+}
+
+// lastMetrics returns values taken by last harvest, they are not modified after harvest
+func (s *agentStats) lastMetrics() []Metric {
+	s.Lock()
+	defer s.Unlock()
+	return s.metrics
+}
+
+// Stats returns health statistic of the agent: harvests, reporters results and metricas errors
+func (agent *Agent) Stats() AgentStats {
+	return agent.stats.snapshot()
+}
+
+// agentStatsSource reports AgentStats as Agent/... metrics.
+// Totals are reported as increase since previous harvest, so they describe results of previous harvest.
+type agentStatsSource struct {
+	stats    *agentStats
+	previous map[string]float64
+}
+
+func newAgentStatsSource(stats *agentStats) *agentStatsSource {
+	return &agentStatsSource{stats: stats, previous: make(map[string]float64)}
+}
+
+// iMetricaSource interface implementation
+func (source *agentStatsSource) Metricas() []nrpg.IMetrica {
+	stats := source.stats.snapshot()
+	now := source.stats.currentTime()
+	var metricas []nrpg.IMetrica
+
+	gauge := func(name string, units string, value float64) {
+		metricas = append(metricas, &customMetrica{name: name, units: units, value: func() float64 { return value }})
+	}
+	count := func(name string, units string, total float64) {
+		value := total - source.previous[name]
+		if value < 0 {
+			// statistic was started over
+			value = total
+		}
+		source.previous[name] = total
+		metricas = append(metricas, &customMetrica{name: name, units: units, value: func() float64 { return value }, metricType: CountMetric})
+	}
+
+	gauge("Agent/Harvest/Duration", "ms", float64(stats.LastHarvestDuration)/float64(time.Millisecond))
+	gauge("Agent/Harvest/Metrics", "metrics", float64(stats.LastHarvestMetrics))
+	count("Agent/Harvest/GetValueErrors", "errors", float64(stats.GetValueErrors))
+	names := make([]string, 0, len(stats.MetricErrors))
+	for name := range stats.MetricErrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		count("Agent/GetValueErrors/"+name, "errors", float64(stats.MetricErrors[name]))
+	}
+	gauge("Agent/HTTP/Paths", "paths", float64(stats.HTTPPaths))
+	gauge("Agent/Tracer/Traces", "traces", float64(stats.Traces))
+
+	for _, reporter := range stats.Reporters {
+		prefix := "Agent/Reporter/" + reporter.Name + "/"
+		count(prefix+"Successes", "harvests", float64(reporter.Successes))
+		count(prefix+"Failures", "harvests", float64(reporter.Failures))
+		for _, reason := range []string{FailureTimeout, FailureNetwork, FailureHTTP4xx, FailureHTTP5xx, FailureOther} {
+			count(prefix+"Failures/"+reason, "harvests", float64(reporter.FailuresByReason[reason]))
+		}
+		gauge(prefix+"ConsecutiveFailures", "harvests", float64(reporter.ConsecutiveFailures))
+		count(prefix+"PayloadBytes", "bytes", float64(reporter.SentBytes))
+		lastSuccess := reporter.LastSuccess
+		if lastSuccess.IsZero() {
+			lastSuccess = stats.StartTime
+		}
+		gauge(prefix+"SecondsSinceLastSuccess", "seconds", now.Sub(lastSuccess).Seconds())
+	}
+	return metricas
+}
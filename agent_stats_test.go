@@ -0,0 +1,153 @@
+package gorelic
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type failingReporter struct {
+	err error
+}
+
+func (reporter *failingReporter) Report(harvest *Harvest) error {
+	return reporter.err
+}
+
+type failingMetrica struct{}
+
+func (metrica *failingMetrica) GetName() string { return "Custom/failing" }
+
+func (metrica *failingMetrica) GetUnits() string { return "value" }
+
+func (metrica *failingMetrica) GetValue() (float64, error) { return 0, errors.New("broken") }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ = Describe("Agent stats", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+	var failing *failingReporter
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		reporter = &recordingReporter{}
+		failing = &failingReporter{err: &httpStatusError{"http://collector", "503 Service Unavailable", 503, ""}}
+		agent.AddReporter(reporter)
+		agent.AddReporter(failing)
+		agent.AddCustomMetric(&failingMetrica{})
+		agent.WrapHTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {}, "/users")
+	})
+
+	It("should describe harvests and reporters", func() {
+		Expect(agent.Run()).To(Succeed())
+		agent.Tracer.Trace("db", func() {})
+		agent.harvest()
+		agent.harvest()
+
+		stats := agent.Stats()
+		Expect(stats.Harvests).To(Equal(int64(2)))
+		Expect(stats.LastHarvestTime).NotTo(BeZero())
+		Expect(stats.LastHarvestMetrics).To(Equal(len(reporter.lastHarvest().Metrics)))
+		Expect(stats.GetValueErrors).To(Equal(int64(2)))
+		Expect(stats.MetricErrors).To(Equal(map[string]int64{"Custom/failing": 2}))
+		Expect(stats.HTTPPaths).To(Equal(1))
+		Expect(stats.Traces).To(Equal(1))
+
+		Expect(stats.Reporters).To(HaveLen(2))
+		Expect(stats.Reporters[0].Name).To(Equal("recordingReporter"))
+		Expect(stats.Reporters[0].Successes).To(Equal(int64(2)))
+		Expect(stats.Reporters[0].LastSuccess).NotTo(BeZero())
+		Expect(stats.Reporters[1].Name).To(Equal("failingReporter"))
+		Expect(stats.Reporters[1].Failures).To(Equal(int64(2)))
+		Expect(stats.Reporters[1].ConsecutiveFailures).To(Equal(int64(2)))
+		Expect(stats.Reporters[1].FailuresByReason).To(Equal(map[string]int64{FailureHTTP5xx: 2}))
+		Expect(stats.Reporters[1].LastError).To(ContainSubstring("503"))
+	})
+
+	It("should report Agent metrics of previous harvest", func() {
+		Expect(agent.Run()).To(Succeed())
+		agent.harvest()
+		failing.err = nil
+		agent.harvest()
+
+		harvest := reporter.lastHarvest()
+		Expect(findMetric(harvest, "Agent/Harvest/Metrics").Value).To(BeNumerically(">", 0))
+		Expect(findMetric(harvest, "Agent/Harvest/Duration").Units).To(Equal("ms"))
+		Expect(findMetric(harvest, "Agent/Harvest/GetValueErrors").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "Agent/GetValueErrors/Custom/failing").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "Agent/HTTP/Paths").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "Agent/Reporter/failingReporter/Failures").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "Agent/Reporter/failingReporter/Failures/HTTP5xx").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "Agent/Reporter/failingReporter/ConsecutiveFailures").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "Agent/Reporter/recordingReporter/Successes").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "Agent/Reporter/recordingReporter/SecondsSinceLastSuccess")).NotTo(BeNil())
+
+		agent.harvest()
+		harvest = reporter.lastHarvest()
+		Expect(findMetric(harvest, "Agent/Reporter/failingReporter/Failures").Value).To(Equal(0.0))
+		Expect(findMetric(harvest, "Agent/Reporter/failingReporter/Successes").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "Agent/Reporter/failingReporter/ConsecutiveFailures").Value).To(Equal(0.0))
+	})
+
+	It("should tell time since start by agent clock until reporter succeeds", func() {
+		clock := &manualClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		agent, err := New(WithClock(clock), WithReporter(reporter), WithReporter(failing), WithGCStat(false, 0), WithMemoryStat(false, 0))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(agent.Run()).To(Succeed())
+
+		clock.now = clock.now.Add(time.Minute)
+		agent.harvest()
+		clock.now = clock.now.Add(30 * time.Second)
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "Agent/Reporter/failingReporter/SecondsSinceLastSuccess").Value).To(Equal(90.0))
+	})
+
+	It("should count payload bytes of reporters", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+		metricAPI := NewMetricAPIReporter("license")
+		metricAPI.Endpoint = server.URL
+		agent.AddReporter(metricAPI)
+
+		Expect(agent.Run()).To(Succeed())
+		agent.harvest()
+		Expect(metricAPI.SentBytes()).To(BeNumerically(">", 0))
+		Expect(agent.Stats().Reporters[2].SentBytes).To(Equal(metricAPI.SentBytes()))
+	})
+
+	It("should count platform payload bytes only when collector accepts them", func() {
+		transport := &statusTransport{status: http.StatusServiceUnavailable}
+		platform := newPlatformReporter("app", "guid", "1.0", "license", 60, http.Client{Transport: transport}, false)
+		harvest := &Harvest{Metrics: []Metric{{Name: "Custom/jobs", Units: "jobs", Value: 1}}}
+		Expect(platform.Report(harvest)).NotTo(Succeed())
+		Expect(platform.SentBytes()).To(BeZero())
+
+		transport.status = http.StatusOK
+		Expect(platform.Report(harvest)).To(Succeed())
+		Expect(platform.SentBytes()).To(Equal(int64(len(transport.bodies[1]))))
+	})
+
+	It("should classify failures", func() {
+		Expect(failureReason(&httpStatusError{code: 429})).To(Equal(FailureHTTP4xx))
+		Expect(failureReason(&httpStatusError{code: 502})).To(Equal(FailureHTTP5xx))
+		Expect(failureReason(timeoutError{})).To(Equal(FailureTimeout))
+		Expect(failureReason(&net.OpError{Op: "dial", Err: errors.New("refused")})).To(Equal(FailureNetwork))
+		Expect(failureReason(errors.New("oops"))).To(Equal(FailureOther))
+
+		client := http.Client{Timeout: time.Nanosecond}
+		_, err := client.Get("http://127.0.0.1:1/")
+		Expect(failureReason(err)).To(Or(Equal(FailureTimeout), Equal(FailureNetwork)))
+	})
+})
@@ -1,12 +1,16 @@
 package gorelic
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"strings"
 )
 
 type WaveMetrica struct {
@@ -30,6 +34,55 @@ func (metrica *WaveMetrica) GetValue() (float64, error) {
 	return float64(metrica.sawtoothCounter), nil
 }
 
+type recordingReporter struct {
+	harvests []*Harvest
+}
+
+func (reporter *recordingReporter) Report(harvest *Harvest) error {
+	reporter.harvests = append(reporter.harvests, harvest)
+	return nil
+}
+
+// lastHarvest returns the latest reported harvest
+func (reporter *recordingReporter) lastHarvest() *Harvest {
+	return reporter.harvests[len(reporter.harvests)-1]
+}
+
+// reporterFunc is Reporter calling function
+type reporterFunc func(harvest *Harvest) error
+
+func (f reporterFunc) Report(harvest *Harvest) error {
+	return f(harvest)
+}
+
+// statusTransport answers every request with status and keeps request bodies
+type statusTransport struct {
+	status int
+	bodies []string
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, _ := ioutil.ReadAll(req.Body)
+		t.bodies = append(t.bodies, string(body))
+	}
+	return &http.Response{
+		StatusCode: t.status,
+		Status:     http.StatusText(t.status),
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+func findMetric(harvest *Harvest, name string) *Metric {
+	for i := range harvest.Metrics {
+		if harvest.Metrics[i].Name == name {
+			return &harvest.Metrics[i]
+		}
+	}
+	return nil
+}
+
 var _ = Describe("Agent", func() {
 	Describe("Without license set", func() {
 		var agent *Agent
@@ -85,6 +138,35 @@ var _ = Describe("Agent", func() {
 					Expect(w.Code).To(Equal(http.StatusOK))
 				})
 			})
+
+			Context("When handler is wrapped after Run", func() {
+				failing := func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+
+				It("should count errors of its path", func() {
+					reporter := &recordingReporter{}
+					agent.AddReporter(reporter)
+					agent.CollectHTTPStat = true
+					Expect(agent.Run()).To(Succeed())
+
+					w := httptest.NewRecorder()
+					agent.WrapHTTPHandlerFunc(failing, "/late")(w, httptest.NewRequest("GET", "/late", nil))
+					Expect(w.Code).To(Equal(http.StatusInternalServerError))
+
+					agent.harvest()
+					Expect(findMetric(reporter.lastHarvest(), "http/path//late/error/500").Value).To(Equal(1.0))
+					Expect(findMetric(reporter.lastHarvest(), "http/all/error/500").Value).To(Equal(1.0))
+				})
+
+				It("should not fail if HTTP metrics were not collected at Run", func() {
+					Expect(agent.Run()).To(Succeed())
+
+					w := httptest.NewRecorder()
+					agent.WrapHTTPHandlerFunc(failing, "/late")(w, httptest.NewRequest("GET", "/late", nil))
+					Expect(w.Code).To(Equal(http.StatusInternalServerError))
+				})
+			})
 		})
 
 		Describe("WrapHTTPHandler", func() {
@@ -120,4 +202,97 @@ var _ = Describe("Agent", func() {
 			})
 		})
 	})
+
+	Describe("With reporter added", func() {
+		var agent *Agent
+		var reporter *recordingReporter
+
+		BeforeEach(func() {
+			agent = NewAgent()
+			reporter = &recordingReporter{}
+			agent.AddReporter(reporter)
+		})
+
+		It("should run without license", func() {
+			Expect(agent.Run()).To(Succeed())
+		})
+
+		It("should pass harvested metrics to reporter", func() {
+			agent.AddCustomMetric(&WaveMetrica{sawtoothMax: 10, sawtoothCounter: 5})
+			Expect(agent.Run()).To(Succeed())
+			agent.harvest()
+
+			Expect(reporter.harvests).To(HaveLen(1))
+			metric := findMetric(reporter.harvests[0], "Custom/Wave_Metrica")
+			Expect(metric).NotTo(BeNil())
+			Expect(metric.Value).To(Equal(6.0))
+			Expect(metric.Units).To(Equal("Queries/Second"))
+		})
+
+		It("should report build info", func() {
+			agent.Metadata["deploy"] = "canary"
+			Expect(agent.Run()).To(Succeed())
+			agent.harvest()
+
+			harvest := reporter.harvests[0]
+			Expect(findMetric(harvest, "Runtime/Build/NumCPU").Value).To(Equal(float64(runtime.NumCPU())))
+			Expect(findMetric(harvest, "Runtime/Build/GOMAXPROCS").Value).To(Equal(float64(runtime.GOMAXPROCS(0))))
+			Expect(harvest.Metadata).To(HaveKeyWithValue("go.version", runtime.Version()))
+			Expect(harvest.Metadata).To(HaveKeyWithValue("go.os", runtime.GOOS))
+			Expect(harvest.Metadata).To(HaveKeyWithValue("deploy", "canary"))
+		})
+
+		It("should stop harvest loop and collectors", func() {
+			Expect(agent.Run()).To(Succeed())
+			Expect(agent.gcCollector.Metricas()).NotTo(BeEmpty())
+			agent.Stop()
+			agent.Stop()
+
+			Expect(agent.Stats().Running).To(BeFalse())
+			Expect(agent.harvestLoopDone).To(BeClosed())
+			Expect(agent.gcCollector.Metricas()).To(BeEmpty())
+			Expect(agent.memoryCollector.Metricas()).To(BeEmpty())
+			Expect(agent.Reconfigure(&Config{})).To(MatchError("agent is stopped"))
+			Expect(agent.Run()).NotTo(Succeed())
+		})
+	})
+
+	Describe("With platform reporter failing", func() {
+		It("should resend counts to platform only", func() {
+			transport := &statusTransport{status: http.StatusServiceUnavailable}
+			agent := NewAgent()
+			agent.NewrelicLicense = "license"
+			agent.Client = http.Client{Transport: transport}
+			reporter := &recordingReporter{}
+			agent.AddReporter(reporter)
+			counter := agent.Counter("jobs", "jobs")
+			Expect(agent.Run()).To(Succeed())
+
+			// platform payload value of the last request
+			platformValue := func() interface{} {
+				var payload struct {
+					Components []struct {
+						Metrics map[string]interface{} `json:"metrics"`
+					} `json:"components"`
+				}
+				Expect(json.Unmarshal([]byte(transport.bodies[len(transport.bodies)-1]), &payload)).To(Succeed())
+				return payload.Components[0].Metrics["Component/Custom/jobs[jobs]"]
+			}
+
+			counter.Inc(2)
+			agent.harvest()
+			Expect(platformValue()).To(Equal(2.0))
+			counter.Inc(1)
+			transport.status = http.StatusOK
+			agent.harvest()
+			Expect(platformValue()).To(Equal(3.0))
+			agent.harvest()
+			Expect(platformValue()).To(Equal(0.0))
+
+			// other reporters get every increment once
+			Expect(findMetric(reporter.harvests[0], "Custom/jobs").Value).To(Equal(2.0))
+			Expect(findMetric(reporter.harvests[1], "Custom/jobs").Value).To(Equal(1.0))
+			Expect(findMetric(reporter.harvests[2], "Custom/jobs").Value).To(Equal(0.0))
+		})
+	})
 })
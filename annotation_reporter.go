@@ -0,0 +1,143 @@
+package gorelic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GraphiteAnnotationReporter marks deployments with Graphite events API.
+// It does not send metrics, so it is used together with metrics reporters:
+//
+//	agent.AddReporter(gorelic.NewGraphiteAnnotationReporter("http://graphite/events/"))
+type GraphiteAnnotationReporter struct {
+	URL string
+	// Tags are added to every event, "deployment" tag is always present
+	Tags []string
+	// All requests will be done using this client. Change it if you need
+	// to use a proxy.
+	Client http.Client
+}
+
+// NewGraphiteAnnotationReporter creates reporter posting events to Graphite events URL
+func NewGraphiteAnnotationReporter(eventsURL string) *GraphiteAnnotationReporter {
+	return &GraphiteAnnotationReporter{URL: eventsURL, Client: http.Client{Timeout: 30 * time.Second}}
+}
+
+// MetricsReporter interface implementation. Metrics are not sent.
+func (reporter *GraphiteAnnotationReporter) Report(harvest *Harvest) error { return nil }
+
+// Validate checks events URL, it is called by New and Run
+func (reporter *GraphiteAnnotationReporter) Validate() error {
+	if err := validateURL(reporter.URL, "http", "https"); err != nil {
+		return fmt.Errorf("URL: %v", err)
+	}
+	return nil
+}
+
+// DeploymentReporter interface implementation
+func (reporter *GraphiteAnnotationReporter) ReportDeployment(deployment Deployment) error {
+	event := map[string]interface{}{
+		"what": "Deployment " + deployment.Revision,
+		"tags": append([]string{"deployment"}, reporter.Tags...),
+		"data": deploymentText(deployment),
+		"when": deployment.Timestamp.Unix(),
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postAnnotation(reporter.Client, reporter.URL, "application/json", bytes.NewReader(body))
+}
+
+// InfluxDBAnnotationReporter marks deployments by writing points to InfluxDB measurement,
+// which can be used as Grafana annotations source.
+// It does not send metrics, so it is used together with metrics reporters.
+type InfluxDBAnnotationReporter struct {
+	URL         string
+	Database    string
+	Measurement string
+	// All requests will be done using this client. Change it if you need
+	// to use a proxy.
+	Client http.Client
+}
+
+// NewInfluxDBAnnotationReporter creates reporter writing deployments to "events" measurement of database
+func NewInfluxDBAnnotationReporter(influxURL string, database string) *InfluxDBAnnotationReporter {
+	return &InfluxDBAnnotationReporter{
+		URL:         strings.TrimSuffix(influxURL, "/"),
+		Database:    database,
+		Measurement: "events",
+		Client:      http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// MetricsReporter interface implementation. Metrics are not sent.
+func (reporter *InfluxDBAnnotationReporter) Report(harvest *Harvest) error { return nil }
+
+// Validate checks URL, database and measurement, it is called by New and Run
+func (reporter *InfluxDBAnnotationReporter) Validate() error {
+	if err := validateURL(reporter.URL, "http", "https"); err != nil {
+		return fmt.Errorf("URL: %v", err)
+	}
+	if reporter.Database == "" {
+		return errors.New("Database: must not be empty")
+	}
+	if reporter.Measurement == "" {
+		return errors.New("Measurement: must not be empty")
+	}
+	return nil
+}
+
+var (
+	influxTagReplacer    = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+	influxStringReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// DeploymentReporter interface implementation. Point is written in line protocol with seconds precision.
+func (reporter *InfluxDBAnnotationReporter) ReportDeployment(deployment Deployment) error {
+	// tags must not have empty values
+	tags := ",type=deployment"
+	if deployment.Revision != "" {
+		tags += ",revision=" + influxTagReplacer.Replace(deployment.Revision)
+	}
+	line := fmt.Sprintf("%s%s title=\"%s\",text=\"%s\",user=\"%s\" %d\n",
+		influxTagReplacer.Replace(reporter.Measurement),
+		tags,
+		influxStringReplacer.Replace(strings.TrimSpace("Deployment "+deployment.Revision)),
+		influxStringReplacer.Replace(deploymentText(deployment)),
+		influxStringReplacer.Replace(deployment.User),
+		deployment.Timestamp.Unix(),
+	)
+	endpoint := reporter.URL + "/write?" + url.Values{"db": {reporter.Database}, "precision": {"s"}}.Encode()
+	return postAnnotation(reporter.Client, endpoint, "text/plain", strings.NewReader(line))
+}
+
+// deploymentText describes deployment in one line
+func deploymentText(deployment Deployment) string {
+	text := deployment.Description
+	if deployment.User != "" {
+		text += " by " + deployment.User
+	}
+	return strings.TrimSpace(text)
+}
+
+func postAnnotation(client http.Client, endpoint string, contentType string, body io.Reader) error {
+	resp, err := client.Post(endpoint, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	response, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &httpStatusError{endpoint, resp.Status, resp.StatusCode, strings.TrimSpace(string(response))}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package gorelic
+
+import (
+	"runtime"
+	"strconv"
+)
+
+// BuildInfo describes binary and runtime which report metrics.
+type BuildInfo struct {
+	GoVersion  string
+	GOOS       string
+	GOARCH     string
+	GOMAXPROCS int
+	NumCPU     int
+	// Path and Version of main module
+	Path    string
+	Version string
+	// Version control info, stamped by Go 1.18+ toolchain
+	VCS          string
+	Revision     string
+	RevisionTime string
+	Modified     bool
+	// Modules maps dependency path to its version
+	Modules map[string]string
+}
+
+// ReadBuildInfo reads info about running binary.
+// Module and version control info is available only for binaries built with module support.
+func ReadBuildInfo() *BuildInfo {
+	info := &BuildInfo{
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		NumCPU:     runtime.NumCPU(),
+		Modules:    make(map[string]string),
+	}
+	readModuleInfo(info)
+	return info
+}
+
+// Metadata returns build info in form of harvest metadata.
+// Dependencies are not included, they are available in Modules.
+func (info *BuildInfo) Metadata() map[string]string {
+	metadata := map[string]string{
+		"go.version":    info.GoVersion,
+		"go.os":         info.GOOS,
+		"go.arch":       info.GOARCH,
+		"go.maxprocs":   strconv.Itoa(info.GOMAXPROCS),
+		"go.numcpu":     strconv.Itoa(info.NumCPU),
+		"build.path":    info.Path,
+		"build.version": info.Version,
+	}
+	if info.VCS != "" {
+		metadata["vcs.system"] = info.VCS
+		metadata["vcs.revision"] = info.Revision
+		metadata["vcs.time"] = info.RevisionTime
+		metadata["vcs.modified"] = strconv.FormatBool(info.Modified)
+	}
+	return metadata
+}
+
+// Metrica which value never changes
+type constantMetrica struct {
+	name  string
+	units string
+	value float64
+}
+
+// nrpg.IMetrica interface implementation.
+func (m *constantMetrica) GetName() string { return m.name }
+
+func (m *constantMetrica) GetUnits() string { return m.units }
+
+func (m *constantMetrica) GetValue() (float64, error) { return m.value, nil }
+
+func addBuildMetricsToComponent(component iComponent, info *BuildInfo) {
+	component.AddMetrica(&constantMetrica{
+		name:  "Runtime/Build/GOMAXPROCS",
+		units: "procs",
+		value: float64(info.GOMAXPROCS),
+	})
+	component.AddMetrica(&constantMetrica{
+		name:  "Runtime/Build/NumCPU",
+		units: "cpus",
+		value: float64(info.NumCPU),
+	})
+}
@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package gorelic
+
+import "runtime/debug"
+
+func readModuleInfo(info *BuildInfo) {
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	info.Path = buildInfo.Path
+	info.Version = buildInfo.Main.Version
+	for _, dep := range buildInfo.Deps {
+		version := dep.Version
+		if dep.Replace != nil {
+			version = dep.Replace.Version
+		}
+		info.Modules[dep.Path] = version
+	}
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs":
+			info.VCS = setting.Value
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.RevisionTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !go1.18
+// +build !go1.18
+
+package gorelic
+
+// Build settings are available since Go 1.18, older toolchains report runtime info only
+func readModuleInfo(info *BuildInfo) {}
@@ -0,0 +1,56 @@
+package gorelic
+
+import "time"
+
+// Clock tells time to harvest loop, collectors goroutines, system data sources, counters and timers.
+// Agent uses SystemClock unless other one is set, tests could use fake clock of gorelictest package
+// to drive harvests and rates deterministically. Moving average rates of go-metrics meters run on wall clock and ignore it.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer sends current time once, like time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker sends current time once in period, like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is Clock of time package
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+// Clock interface implementation
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Clock interface implementation
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+// Clock interface implementation
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTimer struct{ *time.Timer }
+
+// Timer interface implementation
+func (timer systemTimer) C() <-chan time.Time { return timer.Timer.C }
+
+type systemTicker struct{ *time.Ticker }
+
+// Ticker interface implementation
+func (ticker systemTicker) C() <-chan time.Time { return ticker.Ticker.C }
+
+// clock returns Clock of agent, SystemClock if it is not set
+func (agent *Agent) clock() Clock {
+	if agent.Clock == nil {
+		return SystemClock
+	}
+	return agent.Clock
+}
@@ -0,0 +1,50 @@
+package gorelic
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// manualClock tells time set by test, timers and tickers are real
+type manualClock struct {
+	now time.Time
+}
+
+func (clock *manualClock) Now() time.Time                   { return clock.now }
+func (clock *manualClock) NewTimer(d time.Duration) Timer   { return SystemClock.NewTimer(d) }
+func (clock *manualClock) NewTicker(d time.Duration) Ticker { return SystemClock.NewTicker(d) }
+
+var _ = Describe("Clock", func() {
+	It("should tick with system clock", func() {
+		ticker := SystemClock.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		Eventually(ticker.C()).Should(Receive())
+
+		timer := SystemClock.NewTimer(time.Hour)
+		Expect(timer.Stop()).To(BeTrue())
+	})
+
+	It("should be used for harvests and rates", func() {
+		clock := &manualClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		reporter := &recordingReporter{}
+		agent, err := New(WithClock(clock), WithReporter(reporter), WithGCStat(false, 0), WithMemoryStat(false, 0))
+		Expect(err).NotTo(HaveOccurred())
+		jobs := agent.Counter("jobs", "jobs")
+		Expect(agent.Run()).To(Succeed())
+
+		jobs.Inc(10)
+		agent.Tracer.Trace("db", func() { clock.now = clock.now.Add(5 * time.Second) })
+		agent.harvest()
+		harvest := reporter.harvests[0]
+		Expect(harvest.Time).To(Equal(clock.now))
+		Expect(findMetric(harvest, "Custom/jobs/rate").Value).To(Equal(2.0))
+		Expect(findMetric(harvest, "Trace/db/max").Value).To(Equal(5000.0))
+		Expect(agent.Stats().StartTime).To(Equal(clock.now.Add(-5 * time.Second)))
+
+		clock.now = clock.now.Add(time.Minute)
+		agent.harvest()
+		Expect(reporter.harvests[1].Duration).To(Equal(time.Minute))
+	})
+})
@@ -0,0 +1,64 @@
+// Command gorelic-mockcollector runs local mock of New Relic ingest endpoints for development and
+// integration tests without internet access or real license:
+//
+//	gorelic-mockcollector -listen :8080 -license 0123456789abcdef0123456789abcdef01234567
+//
+// Agent sends platform plugin metrics to it with client returned by mockcollector.NewTransport,
+// Metric API and Event API reporters with Endpoint set to http://localhost:8080/metric/v1 and
+// http://localhost:8080/v1/accounts/<id>/events. Received payloads are shown at http://localhost:8080/,
+// faults are injected with POST /faults or flags.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/earlonrails/gorelic/mockcollector"
+)
+
+var (
+	listen      = flag.String("listen", "127.0.0.1:8080", "address to listen on")
+	license     = flag.String("license", "", "the only accepted license key, empty accepts any key")
+	insertKey   = flag.String("insert-key", "", "the only accepted Event API insert key, empty accepts any key")
+	maxPayloads = flag.Int("max-payloads", mockcollector.DefaultMaxPayloads, "number of kept payloads")
+	latency     = flag.Duration("latency", 0, "delay of every response")
+	failStatus  = flag.Int("fail-status", 0, "status of responses to first -fail-count requests, like 500 or 429")
+	failCount   = flag.Int("fail-count", 0, "number of failed requests, 0 fails all requests")
+	retryAfter  = flag.Int("retry-after", 0, "Retry-After header of failed responses, in seconds")
+)
+
+func main() {
+	flag.Parse()
+
+	collector := mockcollector.New(*license, *insertKey)
+	collector.MaxPayloads = *maxPayloads
+	// only the first matching fault is applied, so failed responses are delayed by their own fault
+	if *failStatus != 0 {
+		collector.InjectFault(mockcollector.Fault{Status: *failStatus, Latency: *latency, Count: *failCount, RetryAfter: *retryAfter})
+	}
+	if *latency > 0 && (*failStatus == 0 || *failCount > 0) {
+		collector.InjectFault(mockcollector.Fault{Latency: *latency})
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		startTime := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		collector.ServeHTTP(recorder, req)
+		log.Printf("%s %s %d %v", req.Method, req.URL.Path, recorder.status, time.Since(startTime))
+	})
+	log.Printf("Mock collector is listening on http://%s/", *listen)
+	log.Fatal(http.ListenAndServe(*listen, handler))
+}
+
+// statusRecorder keeps response status for request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
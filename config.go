@@ -0,0 +1,563 @@
+package gorelic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Environment variables read by NewAgentFromEnv and LoadConfig
+const (
+	EnvConfigFile                  = "NEW_RELIC_CONFIG_FILE"
+	EnvLicenseKey                  = "NEW_RELIC_LICENSE_KEY"
+	EnvAppName                     = "NEW_RELIC_APP_NAME"
+	EnvPollInterval                = "NEW_RELIC_POLL_INTERVAL"
+	EnvVerbose                     = "NEW_RELIC_VERBOSE"
+	EnvCollectGcStat               = "NEW_RELIC_COLLECT_GC_STAT"
+	EnvCollectMemoryStat           = "NEW_RELIC_COLLECT_MEMORY_STAT"
+	EnvCollectHTTPStat             = "NEW_RELIC_COLLECT_HTTP_STAT"
+	EnvGCPollInterval              = "NEW_RELIC_GC_POLL_INTERVAL"
+	EnvMemoryAllocatorPollInterval = "NEW_RELIC_MEMORY_ALLOCATOR_POLL_INTERVAL"
+	EnvProxyURL                    = "NEW_RELIC_PROXY_URL"
+	// EnvLabels are "key:value" pairs separated by ";", like "env:prod;region:us"
+	EnvLabels                 = "NEW_RELIC_LABELS"
+	EnvMetricAPI              = "NEW_RELIC_METRIC_API"
+	EnvMetricAPIEndpoint      = "NEW_RELIC_METRIC_API_ENDPOINT"
+	EnvInsightsAccountID      = "NEW_RELIC_INSIGHTS_ACCOUNT_ID"
+	EnvInsightsInsertKey      = "NEW_RELIC_INSIGHTS_INSERT_KEY"
+	EnvGraphiteAnnotationsURL = "NEW_RELIC_GRAPHITE_ANNOTATIONS_URL"
+	EnvInfluxDBAnnotationsURL = "NEW_RELIC_INFLUXDB_ANNOTATIONS_URL"
+	EnvInfluxDBAnnotationsDB  = "NEW_RELIC_INFLUXDB_ANNOTATIONS_DATABASE"
+)
+
+// Config is agent configuration read from file or environment. Nil and empty values are not applied.
+type Config struct {
+	License                     *string           `json:"license,omitempty" yaml:"license,omitempty"`
+	Name                        *string           `json:"name,omitempty" yaml:"name,omitempty"`
+	PollInterval                *int              `json:"pollInterval,omitempty" yaml:"pollInterval,omitempty"`
+	Verbose                     *bool             `json:"verbose,omitempty" yaml:"verbose,omitempty"`
+	CollectGcStat               *bool             `json:"collectGcStat,omitempty" yaml:"collectGcStat,omitempty"`
+	CollectMemoryStat           *bool             `json:"collectMemoryStat,omitempty" yaml:"collectMemoryStat,omitempty"`
+	CollectHTTPStat             *bool             `json:"collectHttpStat,omitempty" yaml:"collectHttpStat,omitempty"`
+	GCPollInterval              *int              `json:"gcPollInterval,omitempty" yaml:"gcPollInterval,omitempty"`
+	MemoryAllocatorPollInterval *int              `json:"memoryAllocatorPollInterval,omitempty" yaml:"memoryAllocatorPollInterval,omitempty"`
+	ProxyURL                    *string           `json:"proxyUrl,omitempty" yaml:"proxyUrl,omitempty"`
+	Labels                      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Reporters                   ReportersConfig   `json:"reporters,omitempty" yaml:"reporters,omitempty"`
+}
+
+// ReportersConfig describes reporters added in addition to NewRelic one. Nil reporter config means reporter is not added.
+type ReportersConfig struct {
+	MetricAPI           *MetricAPIConfig           `json:"metricApi,omitempty" yaml:"metricApi,omitempty"`
+	Insights            *InsightsConfig            `json:"insights,omitempty" yaml:"insights,omitempty"`
+	GraphiteAnnotations *GraphiteAnnotationsConfig `json:"graphiteAnnotations,omitempty" yaml:"graphiteAnnotations,omitempty"`
+	InfluxDBAnnotations *InfluxDBAnnotationsConfig `json:"influxdbAnnotations,omitempty" yaml:"influxdbAnnotations,omitempty"`
+}
+
+// MetricAPIConfig configures MetricAPIReporter. License defaults to agent license, Endpoint to region of license.
+type MetricAPIConfig struct {
+	License  string `json:"license,omitempty" yaml:"license,omitempty"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+}
+
+// InsightsConfig configures InsightsReporter
+type InsightsConfig struct {
+	AccountID string `json:"accountId,omitempty" yaml:"accountId,omitempty"`
+	InsertKey string `json:"insertKey,omitempty" yaml:"insertKey,omitempty"`
+}
+
+// GraphiteAnnotationsConfig configures GraphiteAnnotationReporter
+type GraphiteAnnotationsConfig struct {
+	URL  string   `json:"url,omitempty" yaml:"url,omitempty"`
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// InfluxDBAnnotationsConfig configures InfluxDBAnnotationReporter
+type InfluxDBAnnotationsConfig struct {
+	URL      string `json:"url,omitempty" yaml:"url,omitempty"`
+	Database string `json:"database,omitempty" yaml:"database,omitempty"`
+}
+
+// configKeys maps config file keys to environment variables, they are used to name invalid settings
+var configKeys = map[string]string{
+	"license":                                EnvLicenseKey,
+	"name":                                   EnvAppName,
+	"pollInterval":                           EnvPollInterval,
+	"gcPollInterval":                         EnvGCPollInterval,
+	"memoryAllocatorPollInterval":            EnvMemoryAllocatorPollInterval,
+	"proxyUrl":                               EnvProxyURL,
+	"labels":                                 EnvLabels,
+	"reporters.metricApi.endpoint":           EnvMetricAPIEndpoint,
+	"reporters.insights.accountId":           EnvInsightsAccountID,
+	"reporters.insights.insertKey":           EnvInsightsInsertKey,
+	"reporters.graphiteAnnotations.url":      EnvGraphiteAnnotationsURL,
+	"reporters.influxdbAnnotations.url":      EnvInfluxDBAnnotationsURL,
+	"reporters.influxdbAnnotations.database": EnvInfluxDBAnnotationsDB,
+}
+
+// NewAgentFromEnv builds Agent configured with file named by NEW_RELIC_CONFIG_FILE, if set, and environment variables.
+func NewAgentFromEnv() (*Agent, error) {
+	agent := NewAgent()
+	if err := agent.LoadConfig(os.Getenv(EnvConfigFile)); err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
+
+// LoadConfig configures agent with JSON (.json) or YAML (.yaml, .yml) file and environment variables.
+// Environment variables take precedence over file, settings changed after LoadConfig take precedence over both.
+// Empty path means environment variables only. Reporters configured by file or environment are added to agent.
+func (agent *Agent) LoadConfig(path string) error {
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	agent.applyConfig(config)
+	return nil
+}
+
+// loadConfig reads config file, if path is not empty, and environment variables. Merged config is validated.
+func loadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path != "" {
+		fileConfig, err := ReadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		config = fileConfig
+	}
+
+	envConfig, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err := envConfig.validate(envKey, true); err != nil {
+		return nil, err
+	}
+	config.merge(envConfig)
+	if err := config.validate(anyKey(path), false); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ReadConfigFile reads JSON or YAML config file, format is chosen by extension. Unknown keys are errors.
+func ReadConfigFile(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, config)
+	default:
+		return nil, fmt.Errorf("%s: unknown config format, use .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := config.validate(fileKey(path), true); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ConfigFromEnv reads configuration from NEW_RELIC_* environment variables. Empty variables are ignored.
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{}
+	var err error
+	stringVar := func(name string) *string {
+		if value := os.Getenv(name); value != "" {
+			return &value
+		}
+		return nil
+	}
+	intVar := func(name string) *int {
+		value := os.Getenv(name)
+		if value == "" || err != nil {
+			return nil
+		}
+		parsed, parseErr := strconv.Atoi(value)
+		if parseErr != nil {
+			err = fmt.Errorf("%s: invalid integer %q", name, value)
+			return nil
+		}
+		return &parsed
+	}
+	boolVar := func(name string) *bool {
+		value := os.Getenv(name)
+		if value == "" || err != nil {
+			return nil
+		}
+		parsed, parseErr := strconv.ParseBool(value)
+		if parseErr != nil {
+			err = fmt.Errorf("%s: invalid boolean %q", name, value)
+			return nil
+		}
+		return &parsed
+	}
+
+	config.License = stringVar(EnvLicenseKey)
+	config.Name = stringVar(EnvAppName)
+	config.PollInterval = intVar(EnvPollInterval)
+	config.Verbose = boolVar(EnvVerbose)
+	config.CollectGcStat = boolVar(EnvCollectGcStat)
+	config.CollectMemoryStat = boolVar(EnvCollectMemoryStat)
+	config.CollectHTTPStat = boolVar(EnvCollectHTTPStat)
+	config.GCPollInterval = intVar(EnvGCPollInterval)
+	config.MemoryAllocatorPollInterval = intVar(EnvMemoryAllocatorPollInterval)
+	config.ProxyURL = stringVar(EnvProxyURL)
+	if labels := os.Getenv(EnvLabels); labels != "" {
+		config.Labels = make(map[string]string)
+		for _, pair := range strings.Split(labels, ";") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			parts := strings.SplitN(pair, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("%s: invalid label %q, use key:value", EnvLabels, pair)
+			}
+			config.Labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if enabled := boolVar(EnvMetricAPI); (enabled != nil && *enabled) || os.Getenv(EnvMetricAPIEndpoint) != "" {
+		config.Reporters.MetricAPI = &MetricAPIConfig{Endpoint: os.Getenv(EnvMetricAPIEndpoint)}
+	}
+	if os.Getenv(EnvInsightsAccountID) != "" || os.Getenv(EnvInsightsInsertKey) != "" {
+		config.Reporters.Insights = &InsightsConfig{AccountID: os.Getenv(EnvInsightsAccountID), InsertKey: os.Getenv(EnvInsightsInsertKey)}
+	}
+	if os.Getenv(EnvGraphiteAnnotationsURL) != "" {
+		config.Reporters.GraphiteAnnotations = &GraphiteAnnotationsConfig{URL: os.Getenv(EnvGraphiteAnnotationsURL)}
+	}
+	if os.Getenv(EnvInfluxDBAnnotationsURL) != "" || os.Getenv(EnvInfluxDBAnnotationsDB) != "" {
+		config.Reporters.InfluxDBAnnotations = &InfluxDBAnnotationsConfig{URL: os.Getenv(EnvInfluxDBAnnotationsURL), Database: os.Getenv(EnvInfluxDBAnnotationsDB)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// fileKey names invalid setting of config file
+func fileKey(path string) func(key string) string {
+	return func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + ": " + key
+	}
+}
+
+// envKey names invalid setting by its environment variable
+func envKey(key string) string {
+	if name, ok := configKeys[key]; ok {
+		return name
+	}
+	return key
+}
+
+// anyKey names missing setting by config file key and environment variable
+func anyKey(path string) func(key string) string {
+	return func(key string) string {
+		if name, ok := configKeys[key]; ok {
+			return fmt.Sprintf("%s (%s)", fileKey(path)(key), name)
+		}
+		return fileKey(path)(key)
+	}
+}
+
+// validate checks values of config, errors name the key with keyName.
+// Partial config is checked before merge, so required settings could be missing in it.
+func (config *Config) validate(keyName func(key string) string, partial bool) error {
+	invalid := func(key string, format string, args ...interface{}) error {
+		return fmt.Errorf("%s: %s", keyName(key), fmt.Sprintf(format, args...))
+	}
+	if config.License != nil && strings.TrimSpace(*config.License) == "" {
+		return invalid("license", "must not be empty")
+	}
+	if config.Name != nil && strings.TrimSpace(*config.Name) == "" {
+		return invalid("name", "must not be empty")
+	}
+	intervals := []struct {
+		key   string
+		value *int
+	}{
+		{"pollInterval", config.PollInterval},
+		{"gcPollInterval", config.GCPollInterval},
+		{"memoryAllocatorPollInterval", config.MemoryAllocatorPollInterval},
+	}
+	for _, interval := range intervals {
+		if interval.value != nil && *interval.value <= 0 {
+			return invalid(interval.key, "must be positive, got %d", *interval.value)
+		}
+	}
+	if config.ProxyURL != nil {
+		if err := validateURL(*config.ProxyURL, "http", "https", "socks5"); err != nil {
+			return invalid("proxyUrl", "%v", err)
+		}
+	}
+	for key := range config.Labels {
+		if key == "" {
+			return invalid("labels", "label name must not be empty")
+		}
+	}
+
+	reporters := config.Reporters
+	if reporters.MetricAPI != nil {
+		if !partial && reporters.MetricAPI.License == "" && config.License == nil {
+			return invalid("reporters.metricApi.license", "is required when license (%s) is not set", EnvLicenseKey)
+		}
+		if reporters.MetricAPI.Endpoint != "" {
+			if err := validateURL(reporters.MetricAPI.Endpoint, "http", "https"); err != nil {
+				return invalid("reporters.metricApi.endpoint", "%v", err)
+			}
+		}
+	}
+	if reporters.Insights != nil {
+		if !partial && reporters.Insights.AccountID == "" {
+			return invalid("reporters.insights.accountId", "is required")
+		}
+		if !partial && reporters.Insights.InsertKey == "" {
+			return invalid("reporters.insights.insertKey", "is required")
+		}
+	}
+	if reporters.GraphiteAnnotations != nil && (!partial || reporters.GraphiteAnnotations.URL != "") {
+		if err := validateURL(reporters.GraphiteAnnotations.URL, "http", "https"); err != nil {
+			return invalid("reporters.graphiteAnnotations.url", "%v", err)
+		}
+	}
+	if reporters.InfluxDBAnnotations != nil {
+		if !partial || reporters.InfluxDBAnnotations.URL != "" {
+			if err := validateURL(reporters.InfluxDBAnnotations.URL, "http", "https"); err != nil {
+				return invalid("reporters.influxdbAnnotations.url", "%v", err)
+			}
+		}
+		if !partial && reporters.InfluxDBAnnotations.Database == "" {
+			return invalid("reporters.influxdbAnnotations.database", "is required")
+		}
+	}
+	return nil
+}
+
+// proxyTransport returns copy of http.DefaultTransport using proxy, so its timeouts and connection limits are kept
+func proxyTransport(proxy string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	proxyURL, _ := url.Parse(proxy)
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return transport
+}
+
+// validateURL checks URL is absolute and has one of schemes
+func validateURL(rawURL string, schemes ...string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q", rawURL)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("URL %q has no host", rawURL)
+	}
+	for _, scheme := range schemes {
+		if parsed.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("URL %q scheme should be one of %s", rawURL, strings.Join(schemes, ", "))
+}
+
+// merge overrides settings of config with settings present in other
+func (config *Config) merge(other *Config) {
+	if other.License != nil {
+		config.License = other.License
+	}
+	if other.Name != nil {
+		config.Name = other.Name
+	}
+	if other.PollInterval != nil {
+		config.PollInterval = other.PollInterval
+	}
+	if other.Verbose != nil {
+		config.Verbose = other.Verbose
+	}
+	if other.CollectGcStat != nil {
+		config.CollectGcStat = other.CollectGcStat
+	}
+	if other.CollectMemoryStat != nil {
+		config.CollectMemoryStat = other.CollectMemoryStat
+	}
+	if other.CollectHTTPStat != nil {
+		config.CollectHTTPStat = other.CollectHTTPStat
+	}
+	if other.GCPollInterval != nil {
+		config.GCPollInterval = other.GCPollInterval
+	}
+	if other.MemoryAllocatorPollInterval != nil {
+		config.MemoryAllocatorPollInterval = other.MemoryAllocatorPollInterval
+	}
+	if other.ProxyURL != nil {
+		config.ProxyURL = other.ProxyURL
+	}
+	if len(other.Labels) > 0 && config.Labels == nil {
+		config.Labels = make(map[string]string, len(other.Labels))
+	}
+	for key, value := range other.Labels {
+		config.Labels[key] = value
+	}
+
+	if metricAPI := other.Reporters.MetricAPI; metricAPI != nil {
+		if config.Reporters.MetricAPI == nil {
+			config.Reporters.MetricAPI = &MetricAPIConfig{}
+		}
+		mergeString(&config.Reporters.MetricAPI.License, metricAPI.License)
+		mergeString(&config.Reporters.MetricAPI.Endpoint, metricAPI.Endpoint)
+	}
+	if insights := other.Reporters.Insights; insights != nil {
+		if config.Reporters.Insights == nil {
+			config.Reporters.Insights = &InsightsConfig{}
+		}
+		mergeString(&config.Reporters.Insights.AccountID, insights.AccountID)
+		mergeString(&config.Reporters.Insights.InsertKey, insights.InsertKey)
+	}
+	if graphite := other.Reporters.GraphiteAnnotations; graphite != nil {
+		if config.Reporters.GraphiteAnnotations == nil {
+			config.Reporters.GraphiteAnnotations = &GraphiteAnnotationsConfig{}
+		}
+		mergeString(&config.Reporters.GraphiteAnnotations.URL, graphite.URL)
+		if len(graphite.Tags) > 0 {
+			config.Reporters.GraphiteAnnotations.Tags = graphite.Tags
+		}
+	}
+	if influxDB := other.Reporters.InfluxDBAnnotations; influxDB != nil {
+		if config.Reporters.InfluxDBAnnotations == nil {
+			config.Reporters.InfluxDBAnnotations = &InfluxDBAnnotationsConfig{}
+		}
+		mergeString(&config.Reporters.InfluxDBAnnotations.URL, influxDB.URL)
+		mergeString(&config.Reporters.InfluxDBAnnotations.Database, influxDB.Database)
+	}
+}
+
+func mergeString(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+// applyConfig sets agent fields present in validated config and replaces reporters and labels of previously applied config
+func (agent *Agent) applyConfig(config *Config) {
+	if config.License != nil {
+		agent.NewrelicLicense = *config.License
+	}
+	if config.Name != nil {
+		agent.NewrelicName = *config.Name
+	}
+	if config.PollInterval != nil {
+		agent.NewrelicPollInterval = *config.PollInterval
+	}
+	if config.Verbose != nil {
+		agent.Verbose = *config.Verbose
+	}
+	if config.CollectGcStat != nil {
+		agent.CollectGcStat = *config.CollectGcStat
+	}
+	if config.CollectMemoryStat != nil {
+		agent.CollectMemoryStat = *config.CollectMemoryStat
+	}
+	if config.CollectHTTPStat != nil {
+		agent.CollectHTTPStat = *config.CollectHTTPStat
+	}
+	if config.GCPollInterval != nil {
+		agent.GCPollInterval = *config.GCPollInterval
+	}
+	if config.MemoryAllocatorPollInterval != nil {
+		agent.MemoryAllocatorPollInterval = *config.MemoryAllocatorPollInterval
+	}
+	if config.ProxyURL != nil && *config.ProxyURL != agent.proxyURL {
+		agent.proxyURL = *config.ProxyURL
+		agent.Client.Transport = proxyTransport(agent.proxyURL)
+	}
+	agent.Labels = replaceConfigLabels(agent.Labels, agent.configLabels, config.Labels)
+	agent.configLabels = copyLabels(config.Labels)
+
+	reporters := agent.Reporters[:0:0]
+	for _, reporter := range agent.Reporters {
+		if !containsReporter(agent.configReporters, reporter) {
+			reporters = append(reporters, reporter)
+		}
+	}
+	agent.Reporters = reporters
+	agent.configReporters = newConfigReporters(config.Reporters, agent.NewrelicLicense, agent.Client.Transport)
+	agent.reportersConfig = config.Reporters
+	for _, reporter := range agent.configReporters {
+		agent.AddReporter(reporter)
+	}
+}
+
+// replaceConfigLabels returns labels with labels of previous config replaced by labels of next one,
+// labels set by other means are kept
+func replaceConfigLabels(labels map[string]string, previous map[string]string, next map[string]string) map[string]string {
+	replaced := make(map[string]string, len(labels)+len(next))
+	for key, value := range labels {
+		if previousValue, ok := previous[key]; !ok || previousValue != value {
+			replaced[key] = value
+		}
+	}
+	for key, value := range next {
+		replaced[key] = value
+	}
+	return replaced
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	copied := make(map[string]string, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+	return copied
+}
+
+// newConfigReporters creates configured reporters, their requests are done with transport
+func newConfigReporters(reporters ReportersConfig, license string, transport http.RoundTripper) []MetricsReporter {
+	var created []MetricsReporter
+	if reporters.MetricAPI != nil {
+		if reporters.MetricAPI.License != "" {
+			license = reporters.MetricAPI.License
+		}
+		reporter := NewMetricAPIReporter(license)
+		if reporters.MetricAPI.Endpoint != "" {
+			reporter.Endpoint = reporters.MetricAPI.Endpoint
+		}
+		reporter.Client.Transport = transport
+		created = append(created, reporter)
+	}
+	if reporters.Insights != nil {
+		reporter := NewInsightsReporter(reporters.Insights.AccountID, reporters.Insights.InsertKey)
+		reporter.Client.Transport = transport
+		created = append(created, reporter)
+	}
+	if reporters.GraphiteAnnotations != nil {
+		reporter := NewGraphiteAnnotationReporter(reporters.GraphiteAnnotations.URL)
+		reporter.Tags = reporters.GraphiteAnnotations.Tags
+		reporter.Client.Transport = transport
+		created = append(created, reporter)
+	}
+	if reporters.InfluxDBAnnotations != nil {
+		reporter := NewInfluxDBAnnotationReporter(reporters.InfluxDBAnnotations.URL, reporters.InfluxDBAnnotations.Database)
+		reporter.Client.Transport = transport
+		created = append(created, reporter)
+	}
+	return created
+}
@@ -0,0 +1,170 @@
+package gorelic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var dir string
+	var agent *Agent
+	var environ map[string]string
+
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		return path
+	}
+
+	// clearEnv removes NEW_RELIC_* variables, they are restored by AfterEach
+	clearEnv := func() {
+		for _, env := range os.Environ() {
+			if strings.HasPrefix(env, "NEW_RELIC_") {
+				os.Unsetenv(strings.SplitN(env, "=", 2)[0])
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "gorelic-config")
+		Expect(err).NotTo(HaveOccurred())
+		agent = NewAgent()
+		environ = make(map[string]string)
+		for _, env := range os.Environ() {
+			if strings.HasPrefix(env, "NEW_RELIC_") {
+				parts := strings.SplitN(env, "=", 2)
+				environ[parts[0]] = parts[1]
+			}
+		}
+		clearEnv()
+	})
+
+	AfterEach(func() {
+		clearEnv()
+		for name, value := range environ {
+			os.Setenv(name, value)
+		}
+		os.RemoveAll(dir)
+	})
+
+	It("should load YAML file", func() {
+		path := writeFile("agent.yaml", `
+license: 0123456789012345678901234567890123456789
+name: billing
+pollInterval: 30
+verbose: true
+collectGcStat: false
+collectHttpStat: true
+gcPollInterval: 5
+labels:
+  env: prod
+reporters:
+  insights:
+    accountId: "42"
+    insertKey: key
+`)
+		Expect(agent.LoadConfig(path)).To(Succeed())
+		Expect(agent.NewrelicLicense).To(Equal("0123456789012345678901234567890123456789"))
+		Expect(agent.NewrelicName).To(Equal("billing"))
+		Expect(agent.NewrelicPollInterval).To(Equal(30))
+		Expect(agent.Verbose).To(BeTrue())
+		Expect(agent.CollectGcStat).To(BeFalse())
+		Expect(agent.CollectMemoryStat).To(BeTrue())
+		Expect(agent.CollectHTTPStat).To(BeTrue())
+		Expect(agent.GCPollInterval).To(Equal(5))
+		Expect(agent.MemoryAllocatorPollInterval).To(Equal(DefaultMemoryAllocatorPollIntervalInSeconds))
+		Expect(agent.Labels).To(Equal(map[string]string{"env": "prod"}))
+		Expect(agent.Reporters).To(HaveLen(1))
+		Expect(agent.Reporters[0].(*InsightsReporter).Endpoint).To(Equal("https://insights-collector.newrelic.com/v1/accounts/42/events"))
+	})
+
+	It("should load JSON file with environment taking precedence", func() {
+		path := writeFile("agent.json", `{"license": "file-license", "name": "billing", "reporters": {"metricApi": {}}}`)
+		os.Setenv(EnvAppName, "payments")
+		os.Setenv(EnvLabels, "env:prod; region:us")
+		os.Setenv(EnvProxyURL, "http://proxy:3128")
+
+		Expect(agent.LoadConfig(path)).To(Succeed())
+		Expect(agent.NewrelicLicense).To(Equal("file-license"))
+		Expect(agent.NewrelicName).To(Equal("payments"))
+		Expect(agent.Labels).To(Equal(map[string]string{"env": "prod", "region": "us"}))
+
+		transport := agent.Client.Transport.(*http.Transport)
+		proxy, err := transport.Proxy(&http.Request{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxy.String()).To(Equal("http://proxy:3128"))
+		Expect(transport.TLSHandshakeTimeout).To(Equal(http.DefaultTransport.(*http.Transport).TLSHandshakeTimeout))
+		Expect(transport.IdleConnTimeout).To(Equal(http.DefaultTransport.(*http.Transport).IdleConnTimeout))
+
+		reporter := agent.Reporters[0].(*MetricAPIReporter)
+		Expect(reporter.License).To(Equal("file-license"))
+		Expect(reporter.Client.Transport).To(BeIdenticalTo(agent.Client.Transport))
+	})
+
+	It("should complete file config with environment", func() {
+		path := writeFile("agent.yml", "reporters:\n  insights:\n    accountId: \"42\"\n")
+		os.Setenv(EnvInsightsInsertKey, "key")
+		Expect(agent.LoadConfig(path)).To(Succeed())
+		Expect(agent.Reporters[0].(*InsightsReporter).InsertKey).To(Equal("key"))
+	})
+
+	It("should build agent from environment", func() {
+		os.Setenv(EnvConfigFile, writeFile("agent.yaml", "name: billing\n"))
+		os.Setenv(EnvLicenseKey, "env-license")
+		os.Setenv(EnvCollectMemoryStat, "false")
+		os.Setenv(EnvMemoryAllocatorPollInterval, "120")
+
+		agent, err := NewAgentFromEnv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(agent.NewrelicLicense).To(Equal("env-license"))
+		Expect(agent.NewrelicName).To(Equal("billing"))
+		Expect(agent.CollectMemoryStat).To(BeFalse())
+		Expect(agent.MemoryAllocatorPollInterval).To(Equal(120))
+	})
+
+	Describe("validation", func() {
+		It("should name invalid file key", func() {
+			path := writeFile("agent.yaml", "pollInterval: 0\n")
+			Expect(agent.LoadConfig(path)).To(MatchError(path + ": pollInterval: must be positive, got 0"))
+		})
+
+		It("should name invalid environment variable", func() {
+			os.Setenv(EnvGCPollInterval, "-1")
+			Expect(agent.LoadConfig("")).To(MatchError("NEW_RELIC_GC_POLL_INTERVAL: must be positive, got -1"))
+
+			os.Setenv(EnvGCPollInterval, "ten")
+			Expect(agent.LoadConfig("")).To(MatchError(`NEW_RELIC_GC_POLL_INTERVAL: invalid integer "ten"`))
+
+			os.Unsetenv(EnvGCPollInterval)
+			os.Setenv(EnvVerbose, "maybe")
+			Expect(agent.LoadConfig("")).To(MatchError(`NEW_RELIC_VERBOSE: invalid boolean "maybe"`))
+		})
+
+		It("should reject unknown keys", func() {
+			Expect(agent.LoadConfig(writeFile("agent.json", `{"pollIntervl": 10}`))).To(MatchError(ContainSubstring(`unknown field "pollIntervl"`)))
+			Expect(agent.LoadConfig(writeFile("agent.yaml", "pollIntervl: 10\n"))).To(MatchError(ContainSubstring("pollIntervl")))
+			Expect(agent.LoadConfig(writeFile("agent.toml", ""))).To(MatchError(ContainSubstring("unknown config format")))
+		})
+
+		It("should check proxy and reporters", func() {
+			os.Setenv(EnvProxyURL, "proxy:3128")
+			Expect(agent.LoadConfig("")).To(MatchError(ContainSubstring("NEW_RELIC_PROXY_URL: URL")))
+			os.Unsetenv(EnvProxyURL)
+
+			os.Setenv(EnvMetricAPI, "true")
+			Expect(agent.LoadConfig("")).To(MatchError("reporters.metricApi.license: is required when license (NEW_RELIC_LICENSE_KEY) is not set"))
+			os.Unsetenv(EnvMetricAPI)
+
+			path := writeFile("agent.yaml", "reporters:\n  influxdbAnnotations:\n    url: http://influx:8086\n")
+			Expect(agent.LoadConfig(path)).To(MatchError(path + ": reporters.influxdbAnnotations.database (NEW_RELIC_INFLUXDB_ANNOTATIONS_DATABASE): is required"))
+			Expect(agent.Reporters).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,319 @@
+package gorelic
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultCgroupRoot - where cgroup filesystem is mounted
+	DefaultCgroupRoot = "/sys/fs/cgroup"
+
+	containerQueryInterval = 10
+
+	// cgroup v1 reports "no limit" as a huge page aligned number
+	cgroupV1Unlimited = 1 << 62
+)
+
+// cgroup data source fabrica
+func newContainerMetricaDataSource(cgroupRoot string, procRoot string, now func() time.Time) iSystemMetricaDataSource {
+	var ds iSystemMetricaDataSource
+	switch runtime.GOOS {
+	default:
+		ds = &systemMetricaDataSource{}
+	case "linux":
+		ds = newCgroupMetricaDataSource(cgroupRoot, filepath.Join(procRoot, strconv.Itoa(os.Getpid()), "cgroup"), now)
+	}
+	return ds
+}
+
+// cgroup v1/v2 implementation of iSystemMetricaDataSource
+type cgroupMetricaDataSource struct {
+	cgroupRoot string
+	cgroupFile string
+	lastUpdate time.Time
+	data       map[string]float64
+	now        func() time.Time
+}
+
+func newCgroupMetricaDataSource(cgroupRoot string, cgroupFile string, now func() time.Time) *cgroupMetricaDataSource {
+	return &cgroupMetricaDataSource{
+		cgroupRoot: cgroupRoot,
+		cgroupFile: cgroupFile,
+		data:       make(map[string]float64),
+		now:        now,
+	}
+}
+
+func (ds *cgroupMetricaDataSource) GetValue(key string) (float64, error) {
+	if err := ds.checkAndUpdateData(); err != nil {
+		return 0, err
+	} else if val, ok := ds.data[key]; !ok {
+		return 0, fmt.Errorf("container data with key %s was not found", key)
+	} else {
+		return val, nil
+	}
+}
+
+func (ds *cgroupMetricaDataSource) checkAndUpdateData() error {
+	startTime := ds.now()
+	if startTime.Sub(ds.lastUpdate) > time.Second*containerQueryInterval {
+		rawCgroups, err := ioutil.ReadFile(ds.cgroupFile)
+		if err != nil {
+			return err
+		}
+		data := make(map[string]float64)
+		if _, err := os.Stat(filepath.Join(ds.cgroupRoot, "cgroup.controllers")); err == nil {
+			ds.readV2(parseCgroupV2Path(rawCgroups), data)
+		} else {
+			ds.readV1(parseCgroupV1Paths(rawCgroups), data)
+		}
+		ds.data = data
+		ds.lastUpdate = startTime
+	}
+	return nil
+}
+
+// cgroup v2 has single unified hierarchy
+func (ds *cgroupMetricaDataSource) readV2(cgroupPath string, data map[string]float64) {
+	dir := ds.cgroupDir("", cgroupPath)
+
+	readCgroupLimit(filepath.Join(dir, "memory.max"), "memory.limit", data)
+	readCgroupValue(filepath.Join(dir, "memory.current"), "memory.usage", data)
+	if stat, err := readCgroupKeyValues(filepath.Join(dir, "memory.stat")); err == nil {
+		if usage, ok := data["memory.usage"]; ok {
+			data["memory.workingSet"] = workingSet(usage, stat["inactive_file"])
+		}
+	}
+	if events, err := readCgroupKeyValues(filepath.Join(dir, "memory.events")); err == nil {
+		if v, ok := events["oom_kill"]; ok {
+			data["memory.oomKills"] = v
+		}
+	}
+
+	// cpu.max contains "$MAX $PERIOD", where $MAX could be "max"
+	if raw, err := ioutil.ReadFile(filepath.Join(dir, "cpu.max")); err == nil {
+		fields := strings.Fields(string(raw))
+		if len(fields) == 2 {
+			if fields[0] == "max" {
+				data["cpu.quota"] = 0
+			} else if v, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				data["cpu.quota"] = v
+			}
+			if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+				data["cpu.period"] = v
+			}
+		}
+	}
+	if stat, err := readCgroupKeyValues(filepath.Join(dir, "cpu.stat")); err == nil {
+		if v, ok := stat["nr_throttled"]; ok {
+			data["cpu.throttledPeriods"] = v
+		}
+		if v, ok := stat["throttled_usec"]; ok {
+			data["cpu.throttledTime"] = v / 1e3
+		}
+	}
+
+	readCgroupLimit(filepath.Join(dir, "pids.max"), "pids.limit", data)
+	readCgroupValue(filepath.Join(dir, "pids.current"), "pids.current", data)
+}
+
+// cgroup v1 has hierarchy per controller
+func (ds *cgroupMetricaDataSource) readV1(cgroupPaths map[string]string, data map[string]float64) {
+	memoryDir := ds.cgroupDir("memory", cgroupPaths["memory"])
+	readCgroupLimit(filepath.Join(memoryDir, "memory.limit_in_bytes"), "memory.limit", data)
+	readCgroupValue(filepath.Join(memoryDir, "memory.usage_in_bytes"), "memory.usage", data)
+	if stat, err := readCgroupKeyValues(filepath.Join(memoryDir, "memory.stat")); err == nil {
+		if usage, ok := data["memory.usage"]; ok {
+			data["memory.workingSet"] = workingSet(usage, stat["total_inactive_file"])
+		}
+	}
+	if oomControl, err := readCgroupKeyValues(filepath.Join(memoryDir, "memory.oom_control")); err == nil {
+		if v, ok := oomControl["oom_kill"]; ok {
+			data["memory.oomKills"] = v
+		}
+	}
+
+	cpuDir := ds.cgroupDir("cpu", cgroupPaths["cpu"])
+	readCgroupLimit(filepath.Join(cpuDir, "cpu.cfs_quota_us"), "cpu.quota", data)
+	readCgroupValue(filepath.Join(cpuDir, "cpu.cfs_period_us"), "cpu.period", data)
+	if stat, err := readCgroupKeyValues(filepath.Join(cpuDir, "cpu.stat")); err == nil {
+		if v, ok := stat["nr_throttled"]; ok {
+			data["cpu.throttledPeriods"] = v
+		}
+		if v, ok := stat["throttled_time"]; ok {
+			data["cpu.throttledTime"] = v / 1e6
+		}
+	}
+
+	pidsDir := ds.cgroupDir("pids", cgroupPaths["pids"])
+	readCgroupLimit(filepath.Join(pidsDir, "pids.max"), "pids.limit", data)
+	readCgroupValue(filepath.Join(pidsDir, "pids.current"), "pids.current", data)
+}
+
+// cgroupDir returns directory of the process cgroup for given controller.
+// Inside of cgroup namespace process path is not visible, so hierarchy root is used instead.
+func (ds *cgroupMetricaDataSource) cgroupDir(controller string, cgroupPath string) string {
+	root := filepath.Join(ds.cgroupRoot, controller)
+	dir := filepath.Join(root, cgroupPath)
+	if _, err := os.Stat(dir); err != nil {
+		return root
+	}
+	return dir
+}
+
+// parseCgroupV2Path finds "0::/path" entry of /proc/<pid>/cgroup
+func parseCgroupV2Path(raw []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) == 3 && parts[0] == "0" && parts[1] == "" {
+			return parts[2]
+		}
+	}
+	return "/"
+}
+
+// parseCgroupV1Paths maps every controller of /proc/<pid>/cgroup to its path.
+// Joined controllers like "cpu,cpuacct" are mounted with symlink for each of them.
+func parseCgroupV1Paths(raw []byte) map[string]string {
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	return paths
+}
+
+func readCgroupValue(path string, key string, data map[string]float64) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if v, err := strconv.ParseFloat(strings.TrimSpace(string(raw)), 64); err == nil {
+		data[key] = v
+	}
+}
+
+// readCgroupLimit reads limit value. Absence of limit is reported as 0.
+func readCgroupLimit(path string, key string, data map[string]float64) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	val := strings.TrimSpace(string(raw))
+	if val == "max" {
+		data[key] = 0
+	} else if v, err := strconv.ParseFloat(val, 64); err == nil {
+		if v < 0 || v >= cgroupV1Unlimited {
+			v = 0
+		}
+		data[key] = v
+	}
+}
+
+// readCgroupKeyValues parses flat keyed files like memory.stat or cpu.stat
+func readCgroupKeyValues(path string) (map[string]float64, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, nil
+}
+
+// Working set is calculated same way as kubelet does: usage without inactive page cache
+func workingSet(usage float64, inactiveFile float64) float64 {
+	if inactiveFile > usage {
+		return 0
+	}
+	return usage - inactiveFile
+}
+
+func addContainerMetricsToComponent(component iComponent, cgroupRoot string, procRoot string, now func() time.Time) {
+	ds := newContainerMetricaDataSource(cgroupRoot, procRoot, now)
+	metrics := []*systemMetrica{
+		&systemMetrica{
+			sourceKey:    "memory.limit",
+			units:        "bytes",
+			newrelicName: "Runtime/Container/Memory/Limit",
+		},
+		&systemMetrica{
+			sourceKey:    "memory.usage",
+			units:        "bytes",
+			newrelicName: "Runtime/Container/Memory/Usage",
+		},
+		// Usage without inactive page cache, this is what OOM killer is looking at
+		&systemMetrica{
+			sourceKey:    "memory.workingSet",
+			units:        "bytes",
+			newrelicName: "Runtime/Container/Memory/WorkingSet",
+		},
+		&systemMetrica{
+			sourceKey:    "memory.oomKills",
+			units:        "events",
+			newrelicName: "Runtime/Container/Memory/OOMKills",
+			incremental:  true,
+		},
+		&systemMetrica{
+			sourceKey:    "cpu.quota",
+			units:        "microseconds",
+			newrelicName: "Runtime/Container/CPU/Quota",
+		},
+		&systemMetrica{
+			sourceKey:    "cpu.period",
+			units:        "microseconds",
+			newrelicName: "Runtime/Container/CPU/Period",
+		},
+		&systemMetrica{
+			sourceKey:    "cpu.throttledPeriods",
+			units:        "periods",
+			newrelicName: "Runtime/Container/CPU/ThrottledPeriods",
+			incremental:  true,
+		},
+		&systemMetrica{
+			sourceKey:    "cpu.throttledTime",
+			units:        "ms",
+			newrelicName: "Runtime/Container/CPU/ThrottledTime",
+			incremental:  true,
+		},
+		&systemMetrica{
+			sourceKey:    "pids.limit",
+			units:        "pids",
+			newrelicName: "Runtime/Container/Pids/Limit",
+		},
+		&systemMetrica{
+			sourceKey:    "pids.current",
+			units:        "pids",
+			newrelicName: "Runtime/Container/Pids/Current",
+		},
+	}
+	for _, m := range metrics {
+		m.dataSource = ds
+		component.AddMetrica(m)
+	}
+}
@@ -0,0 +1,128 @@
+package gorelic
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func writeFixtures(root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+}
+
+var _ = Describe("Container metrics", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "gorelic-cgroup")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	Context("With cgroup v2", func() {
+		var ds *cgroupMetricaDataSource
+
+		BeforeEach(func() {
+			writeFixtures(root, map[string]string{
+				"proc/cgroup":                                 "0::/system.slice/app.service\n",
+				"sys/cgroup.controllers":                      "cpu memory pids\n",
+				"sys/system.slice/app.service/memory.max":     "536870912\n",
+				"sys/system.slice/app.service/memory.current": "209715200\n",
+				"sys/system.slice/app.service/memory.stat":    "anon 104857600\nfile 104857600\ninactive_file 52428800\n",
+				"sys/system.slice/app.service/memory.events":  "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+				"sys/system.slice/app.service/cpu.max":        "50000 100000\n",
+				"sys/system.slice/app.service/cpu.stat":       "usage_usec 1000\nnr_periods 20\nnr_throttled 5\nthrottled_usec 2500\n",
+				"sys/system.slice/app.service/pids.max":       "max\n",
+				"sys/system.slice/app.service/pids.current":   "12\n",
+			})
+			ds = newCgroupMetricaDataSource(filepath.Join(root, "sys"), filepath.Join(root, "proc/cgroup"), time.Now)
+		})
+
+		It("should report memory usage and limits", func() {
+			Expect(ds.GetValue("memory.limit")).To(Equal(536870912.0))
+			Expect(ds.GetValue("memory.usage")).To(Equal(209715200.0))
+			Expect(ds.GetValue("memory.workingSet")).To(Equal(157286400.0))
+			Expect(ds.GetValue("memory.oomKills")).To(Equal(1.0))
+		})
+
+		It("should report cpu quota and throttling", func() {
+			Expect(ds.GetValue("cpu.quota")).To(Equal(50000.0))
+			Expect(ds.GetValue("cpu.period")).To(Equal(100000.0))
+			Expect(ds.GetValue("cpu.throttledPeriods")).To(Equal(5.0))
+			Expect(ds.GetValue("cpu.throttledTime")).To(Equal(2.5))
+		})
+
+		It("should report unlimited pids as 0", func() {
+			Expect(ds.GetValue("pids.limit")).To(Equal(0.0))
+			Expect(ds.GetValue("pids.current")).To(Equal(12.0))
+		})
+	})
+
+	Context("With cgroup v1", func() {
+		var ds *cgroupMetricaDataSource
+
+		BeforeEach(func() {
+			writeFixtures(root, map[string]string{
+				"proc/cgroup": "12:pids:/docker/abc\n" +
+					"5:cpu,cpuacct:/docker/abc\n" +
+					"4:memory:/docker/abc\n" +
+					"1:name=systemd:/docker/abc\n",
+				"sys/memory/docker/abc/memory.limit_in_bytes": "9223372036854771712\n",
+				"sys/memory/docker/abc/memory.usage_in_bytes": "1048576\n",
+				"sys/memory/docker/abc/memory.stat":           "cache 4096\ntotal_inactive_file 524288\n",
+				"sys/memory/docker/abc/memory.oom_control":    "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n",
+				"sys/cpu/docker/abc/cpu.cfs_quota_us":         "-1\n",
+				"sys/cpu/docker/abc/cpu.cfs_period_us":        "100000\n",
+				"sys/cpu/docker/abc/cpu.stat":                 "nr_periods 10\nnr_throttled 3\nthrottled_time 4000000\n",
+				"sys/pids/docker/abc/pids.max":                "256\n",
+				"sys/pids/docker/abc/pids.current":            "7\n",
+			})
+			ds = newCgroupMetricaDataSource(filepath.Join(root, "sys"), filepath.Join(root, "proc/cgroup"), time.Now)
+		})
+
+		It("should report memory usage and treat huge limit as unlimited", func() {
+			Expect(ds.GetValue("memory.limit")).To(Equal(0.0))
+			Expect(ds.GetValue("memory.usage")).To(Equal(1048576.0))
+			Expect(ds.GetValue("memory.workingSet")).To(Equal(524288.0))
+			Expect(ds.GetValue("memory.oomKills")).To(Equal(2.0))
+		})
+
+		It("should report cpu quota and throttling", func() {
+			Expect(ds.GetValue("cpu.quota")).To(Equal(0.0))
+			Expect(ds.GetValue("cpu.period")).To(Equal(100000.0))
+			Expect(ds.GetValue("cpu.throttledPeriods")).To(Equal(3.0))
+			Expect(ds.GetValue("cpu.throttledTime")).To(Equal(4.0))
+		})
+
+		It("should report pids", func() {
+			Expect(ds.GetValue("pids.limit")).To(Equal(256.0))
+			Expect(ds.GetValue("pids.current")).To(Equal(7.0))
+		})
+	})
+
+	Context("Inside of cgroup namespace", func() {
+		It("should fall back to hierarchy root", func() {
+			writeFixtures(root, map[string]string{
+				"proc/cgroup":            "0::/kubepods/pod1/abc\n",
+				"sys/cgroup.controllers": "memory\n",
+				"sys/memory.current":     "4096\n",
+			})
+			ds := newCgroupMetricaDataSource(filepath.Join(root, "sys"), filepath.Join(root, "proc/cgroup"), time.Now)
+			Expect(ds.GetValue("memory.usage")).To(Equal(4096.0))
+			_, err := ds.GetValue("memory.limit")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
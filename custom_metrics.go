@@ -0,0 +1,378 @@
+package gorelic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "github.com/yvasiyarov/go-metrics"
+)
+
+const (
+	customMetricsPrefix = "Custom/"
+
+	// size of uniform sample used by histograms, same as go-metrics uses for timers
+	histogramSampleSize = 1028
+)
+
+// DefaultHistogramPercentiles are reported when no percentiles are passed to Agent.Histogram
+var DefaultHistogramPercentiles = []float64{0.75, 0.90, 0.95}
+
+// Counter counts events. Count is reported and reset once per harvest.
+type Counter struct {
+	lock      sync.Mutex
+	counter   metrics.Counter
+	reported  int64
+	lastReset time.Time
+	now       func() time.Time
+}
+
+// Inc increments counter by n
+func (c *Counter) Inc(n int64) {
+	c.counter.Inc(n)
+}
+
+// Count returns number of events since last harvest
+func (c *Counter) Count() int64 {
+	return c.counter.Count()
+}
+
+// take returns number of events since last harvest, events counted after it are kept by clear
+func (c *Counter) take() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reported = c.counter.Count()
+	return float64(c.reported)
+}
+
+// rate returns events per second since last harvest, it is collected after take
+func (c *Counter) rate() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elapsed := c.now().Sub(c.lastReset).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(c.reported) / elapsed
+}
+
+func (c *Counter) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.counter.Dec(c.reported)
+	c.reported = 0
+	c.lastReset = c.now()
+}
+
+// Gauge holds last set value
+type Gauge struct {
+	gauge metrics.GaugeFloat64
+}
+
+// Update sets gauge value
+func (g *Gauge) Update(value float64) {
+	g.gauge.Update(value)
+}
+
+// Value returns last set value
+func (g *Gauge) Value() float64 {
+	return g.gauge.Value()
+}
+
+// Histogram calculates distribution of values. It is reset once per harvest.
+type Histogram struct {
+	lock      sync.Mutex
+	histogram metrics.Histogram
+	// reported keeps values taken for harvest until harvest is done
+	reported metrics.Histogram
+	count    int64
+}
+
+func newHistogram() metrics.Histogram {
+	return metrics.NewHistogram(metrics.NewUniformSample(histogramSampleSize))
+}
+
+// Update adds value to histogram
+func (h *Histogram) Update(value int64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.histogram.Update(value)
+}
+
+// take moves values recorded since previous take into reported histogram
+func (h *Histogram) take() metrics.Histogram {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.count += h.histogram.Count()
+	if h.reported == nil {
+		h.reported = h.histogram
+		h.histogram = newHistogram()
+		return h.reported
+	}
+	for _, value := range h.histogram.Sample().Values() {
+		h.reported.Update(value)
+	}
+	h.histogram.Clear()
+	return h.reported
+}
+
+// taken returns histogram of values being reported
+func (h *Histogram) taken() metrics.Histogram {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.reported == nil {
+		return metrics.NilHistogram{}
+	}
+	return h.reported
+}
+
+func (h *Histogram) takenCount() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return float64(h.count)
+}
+
+func (h *Histogram) clear() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.reported = nil
+	h.count = 0
+}
+
+// Meter measures rate of events.
+// Per harvest count and exponentially-weighted moving average rates are reported.
+type Meter struct {
+	lock          sync.Mutex
+	meter         metrics.Meter
+	previousCount int64
+	reported      int64
+}
+
+// Mark records n events
+func (m *Meter) Mark(n int64) {
+	m.meter.Mark(n)
+}
+
+// take returns number of events since last harvest, events marked after it are kept by clear
+func (m *Meter) take() float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.reported = m.meter.Count() - m.previousCount
+	return float64(m.reported)
+}
+
+func (m *Meter) clear() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.previousCount += m.reported
+	m.reported = 0
+}
+
+// Counter creates counter and registers Custom/<name> (events since last harvest)
+// and Custom/<name>/rate (events per second since last harvest) metrics.
+func (agent *Agent) Counter(name string, units string) *Counter {
+	now := agent.clock().Now
+	counter := &Counter{counter: metrics.NewCounter(), lastReset: now(), now: now}
+	name = customMetricName(name)
+
+	agent.AddCustomMetric(&customMetrica{
+		name:       name,
+		units:      units,
+		value:      counter.take,
+		clear:      counter.clear,
+		metricType: CountMetric,
+	})
+	agent.AddCustomMetric(&customMetrica{
+		name:  name + "/rate",
+		units: units + "/second",
+		value: counter.rate,
+	})
+	return counter
+}
+
+// Gauge creates gauge and registers Custom/<name> metric
+func (agent *Agent) Gauge(name string, units string) *Gauge {
+	gauge := &Gauge{gauge: metrics.NewGaugeFloat64()}
+	agent.AddCustomMetric(&customMetrica{
+		name:  customMetricName(name),
+		units: units,
+		value: gauge.Value,
+	})
+	return gauge
+}
+
+// GaugeFunc registers Custom/<name> metric, value of which is returned by valueFunc on every harvest.
+// valueFunc is called from harvest goroutine.
+func (agent *Agent) GaugeFunc(name string, units string, valueFunc func() float64) {
+	agent.AddCustomMetric(&customMetrica{
+		name:  customMetricName(name),
+		units: units,
+		value: valueFunc,
+	})
+}
+
+// Histogram creates histogram and registers Custom/<name>/{count,mean,min,max} and
+// Custom/<name>/percentile<N> metrics. Percentiles are in (0, 1) range, DefaultHistogramPercentiles are used if none passed.
+// Dimensional reporters also get Custom/<name> summary metric.
+// It panics if percentile is out of range, like 95 passed instead of 0.95.
+func (agent *Agent) Histogram(name string, units string, percentiles ...float64) *Histogram {
+	histogram := &Histogram{histogram: newHistogram()}
+	name = customMetricName(name)
+	if len(percentiles) == 0 {
+		percentiles = DefaultHistogramPercentiles
+	}
+	for _, percentile := range percentiles {
+		if !(percentile > 0 && percentile < 1) {
+			panic(fmt.Sprintf("gorelic: percentile %v of histogram %s is out of (0, 1) range", percentile, name))
+		}
+	}
+
+	// summary metrica is collected first, it takes values the other metricas report
+	agent.AddCustomMetric(&histogramSummaryMetrica{
+		name:      name,
+		units:     units,
+		histogram: histogram,
+	})
+	agent.AddCustomMetric(&customMetrica{
+		name:       name + "/count",
+		units:      "count",
+		value:      histogram.takenCount,
+		clear:      histogram.clear,
+		metricType: CountMetric,
+	})
+	agent.AddCustomMetric(&customMetrica{
+		name:  name + "/mean",
+		units: units,
+		value: func() float64 { return histogram.taken().Mean() },
+	})
+	agent.AddCustomMetric(&customMetrica{
+		name:  name + "/min",
+		units: units,
+		value: func() float64 { return float64(histogram.taken().Min()) },
+	})
+	agent.AddCustomMetric(&customMetrica{
+		name:  name + "/max",
+		units: units,
+		value: func() float64 { return float64(histogram.taken().Max()) },
+	})
+	for _, percentile := range percentiles {
+		percentile := percentile
+		agent.AddCustomMetric(&customMetrica{
+			name:  name + percentileMetricName(percentile),
+			units: units,
+			value: func() float64 { return histogram.taken().Percentile(percentile) },
+		})
+	}
+	return histogram
+}
+
+// Meter creates meter and registers Custom/<name>/count (events since last harvest),
+// Custom/<name>/rate1, rate5, rate15 (moving average rates) and Custom/<name>/rateMean metrics.
+func (agent *Agent) Meter(name string, units string) *Meter {
+	meter := &Meter{meter: metrics.NewMeter()}
+	name = customMetricName(name)
+
+	agent.AddCustomMetric(&customMetrica{
+		name:       name + "/count",
+		units:      units,
+		value:      meter.take,
+		clear:      meter.clear,
+		metricType: CountMetric,
+	})
+	rates := []struct {
+		name  string
+		value func() float64
+	}{
+		{"rate1", meter.meter.Rate1},
+		{"rate5", meter.meter.Rate5},
+		{"rate15", meter.meter.Rate15},
+		{"rateMean", meter.meter.RateMean},
+	}
+	for _, rate := range rates {
+		agent.AddCustomMetric(&customMetrica{
+			name:  name + "/" + rate.name,
+			units: units + "/second",
+			value: rate.value,
+		})
+	}
+	return meter
+}
+
+func customMetricName(name string) string {
+	if strings.HasPrefix(name, customMetricsPrefix) {
+		return name
+	}
+	return customMetricsPrefix + name
+}
+
+// percentileMetricName returns /percentile<N> suffix, where N is percentile in percents
+func percentileMetricName(percentile float64) string {
+	return "/percentile" + strconv.FormatFloat(percentile*100, 'f', -1, 64)
+}
+
+// customMetrica reports value of custom instrument.
+// Metricas accumulating values per harvest clear their instrument after harvest.
+type customMetrica struct {
+	name       string
+	units      string
+	value      func() float64
+	clear      func()
+	metricType MetricType
+}
+
+// nrpg.IMetrica interface implementation.
+func (m *customMetrica) GetName() string { return m.name }
+
+func (m *customMetrica) GetUnits() string { return m.units }
+
+func (m *customMetrica) GetValue() (float64, error) { return m.value(), nil }
+
+// TypedMetrica interface implementation.
+func (m *customMetrica) GetType() MetricType {
+	if m.metricType == "" {
+		return GaugeMetric
+	}
+	return m.metricType
+}
+
+// resettableMetrica interface implementation
+func (m *customMetrica) ClearSentData() {
+	if m.clear != nil {
+		m.clear()
+	}
+}
+
+// histogramSummaryMetrica reports distribution of histogram values as single summary metric.
+// Its value is number of recorded values.
+type histogramSummaryMetrica struct {
+	name      string
+	units     string
+	histogram *Histogram
+}
+
+// nrpg.IMetrica interface implementation.
+func (m *histogramSummaryMetrica) GetName() string { return m.name }
+
+func (m *histogramSummaryMetrica) GetUnits() string { return m.units }
+
+func (m *histogramSummaryMetrica) GetValue() (float64, error) {
+	m.histogram.take()
+	return m.histogram.takenCount(), nil
+}
+
+// SummaryMetrica interface implementation.
+func (m *histogramSummaryMetrica) GetType() MetricType { return SummaryMetric }
+
+func (m *histogramSummaryMetrica) GetSummary() (MetricSummary, error) {
+	// sum is estimated from mean of sampled values
+	histogram := m.histogram.taken()
+	count := m.histogram.takenCount()
+	return MetricSummary{
+		Count: count,
+		Sum:   histogram.Mean() * count,
+		Min:   float64(histogram.Min()),
+		Max:   float64(histogram.Max()),
+	}, nil
+}
@@ -0,0 +1,162 @@
+package gorelic
+
+import (
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Custom metrics", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		reporter = &recordingReporter{}
+		agent.AddReporter(reporter)
+	})
+
+	Describe("Counter", func() {
+		It("should report and reset count every harvest", func() {
+			counter := agent.Counter("jobs", "jobs")
+			Expect(agent.Run()).To(Succeed())
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					counter.Inc(2)
+				}()
+			}
+			wg.Wait()
+
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/jobs").Value).To(Equal(20.0))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/jobs/rate").Units).To(Equal("jobs/second"))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/jobs").Type).To(Equal(CountMetric))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/jobs/rate").Type).To(Equal(GaugeMetric))
+			Expect(counter.Count()).To(Equal(int64(0)))
+
+			counter.Inc(1)
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/jobs").Value).To(Equal(1.0))
+		})
+
+		It("should keep events counted while harvest is sent", func() {
+			counter := agent.Counter("jobs", "jobs")
+			histogram := agent.Histogram("payload", "bytes")
+			agent.AddReporter(reporterFunc(func(harvest *Harvest) error {
+				counter.Inc(1)
+				histogram.Update(7)
+				return nil
+			}))
+			Expect(agent.Run()).To(Succeed())
+
+			counter.Inc(2)
+			histogram.Update(3)
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/jobs").Value).To(Equal(2.0))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/max").Value).To(Equal(3.0))
+
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/jobs").Value).To(Equal(1.0))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/count").Value).To(Equal(1.0))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/max").Value).To(Equal(7.0))
+		})
+
+		It("should be registered when created after Run", func() {
+			Expect(agent.Run()).To(Succeed())
+			agent.Counter("Custom/late", "calls").Inc(3)
+
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/late").Value).To(Equal(3.0))
+		})
+	})
+
+	Describe("Gauge", func() {
+		It("should report last value", func() {
+			gauge := agent.Gauge("queue/size", "items")
+			agent.GaugeFunc("answer", "value", func() float64 { return 42 })
+			Expect(agent.Run()).To(Succeed())
+
+			gauge.Update(3)
+			gauge.Update(5)
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/queue/size").Value).To(Equal(5.0))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/answer").Value).To(Equal(42.0))
+
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/queue/size").Value).To(Equal(5.0))
+		})
+	})
+
+	Describe("Histogram", func() {
+		It("should report distribution and reset it every harvest", func() {
+			histogram := agent.Histogram("payload", "bytes", 0.5, 0.999)
+			Expect(agent.Run()).To(Succeed())
+
+			for i := int64(1); i <= 100; i++ {
+				histogram.Update(i)
+			}
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/count").Value).To(Equal(100.0))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/min").Value).To(Equal(1.0))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/max").Value).To(Equal(100.0))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/mean").Value).To(Equal(50.5))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/percentile50").Value).To(Equal(50.5))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/percentile99.9")).NotTo(BeNil())
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/percentile95")).To(BeNil())
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/count").Type).To(Equal(CountMetric))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload").Type).To(Equal(SummaryMetric))
+			Expect(*findMetric(reporter.lastHarvest(), "Custom/payload").Summary).To(Equal(MetricSummary{Count: 100, Sum: 5050, Min: 1, Max: 100}))
+
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/payload/count").Value).To(Equal(0.0))
+		})
+
+		It("should use default percentiles", func() {
+			agent.Histogram("latency", "ms")
+			Expect(agent.Run()).To(Succeed())
+
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/latency/percentile75")).NotTo(BeNil())
+			Expect(findMetric(reporter.lastHarvest(), "Custom/latency/percentile90")).NotTo(BeNil())
+			Expect(findMetric(reporter.lastHarvest(), "Custom/latency/percentile95")).NotTo(BeNil())
+		})
+
+		It("should reject percentiles out of range", func() {
+			Expect(func() { agent.Histogram("latency", "ms", 95) }).To(Panic())
+			Expect(func() { agent.Histogram("latency", "ms", 1) }).To(Panic())
+			Expect(func() { agent.Histogram("latency", "ms", 0) }).To(Panic())
+		})
+	})
+
+	Describe("Meter", func() {
+		It("should report events since last harvest", func() {
+			meter := agent.Meter("requests", "requests")
+			Expect(agent.Run()).To(Succeed())
+
+			meter.Mark(5)
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/requests/count").Value).To(Equal(5.0))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/requests/rate1").Units).To(Equal("requests/second"))
+			Expect(findMetric(reporter.lastHarvest(), "Custom/requests/rateMean").Value).To(BeNumerically(">", 0))
+
+			meter.Mark(2)
+			agent.harvest()
+			Expect(findMetric(reporter.lastHarvest(), "Custom/requests/count").Value).To(Equal(2.0))
+		})
+
+		It("should keep events marked during harvest for next one", func() {
+			meter := agent.Meter("requests", "requests")
+
+			meter.Mark(5)
+			Expect(meter.take()).To(Equal(5.0))
+			meter.Mark(3)
+			meter.clear()
+			Expect(meter.take()).To(Equal(3.0))
+		})
+	})
+})
@@ -0,0 +1,327 @@
+package gorelic
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// WrapDriver instruments database/sql driver, metrics are reported under Datastore/<name>/...
+// Exec, Query, Prepare, Begin, Commit and Rollback are timed per operation and, if DatastoreQueryMetrics is set,
+// per normalized query template. Query time is time until rows are returned, reading rows is not included.
+//
+//	sql.Register("postgres-gorelic", agent.WrapDriver(&pq.Driver{}, "postgres"))
+//	db, err := sql.Open("postgres-gorelic", dsn)
+func (agent *Agent) WrapDriver(d driver.Driver, name string) driver.Driver {
+	return &datastoreDriver{driver: d, store: agent.datastore(name), now: agent.clock().Now}
+}
+
+// WrapConnector instruments database/sql connector like WrapDriver, use it with sql.OpenDB
+//
+//	db := sql.OpenDB(agent.WrapConnector(connector, "postgres"))
+func (agent *Agent) WrapConnector(connector driver.Connector, name string) driver.Connector {
+	wrapped := &datastoreDriver{driver: connector.Driver(), store: agent.datastore(name), now: agent.clock().Now}
+	return &datastoreConnector{connector: connector, driver: wrapped}
+}
+
+func (agent *Agent) datastore(name string) *datastore {
+	return agent.datastores.datastore(name, agent.DatastoreQueryMetrics, agent.DatastoreMaxQueries)
+}
+
+// datastoreDriver is driver.Driver recording metrics of its connections
+type datastoreDriver struct {
+	driver driver.Driver
+	store  *datastore
+	now    func() time.Time
+}
+
+// driver.Driver interface implementation
+func (d *datastoreDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.wrapConn(conn), nil
+}
+
+// driver.DriverContext interface implementation
+func (d *datastoreDriver) OpenConnector(name string) (driver.Connector, error) {
+	if driverContext, ok := d.driver.(driver.DriverContext); ok {
+		connector, err := driverContext.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &datastoreConnector{connector: connector, driver: d}, nil
+	}
+	return &datastoreConnector{connector: dsnConnector{name: name, driver: d.driver}, driver: d}, nil
+}
+
+func (d *datastoreDriver) wrapConn(conn driver.Conn) driver.Conn {
+	return &datastoreConn{conn: conn, store: d.store, now: d.now}
+}
+
+// dsnConnector is driver.Connector of driver not implementing driver.DriverContext
+type dsnConnector struct {
+	name   string
+	driver driver.Driver
+}
+
+func (connector dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return connector.driver.Open(connector.name)
+}
+
+func (connector dsnConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+// datastoreConnector is driver.Connector recording metrics of its connections
+type datastoreConnector struct {
+	connector driver.Connector
+	driver    *datastoreDriver
+}
+
+// driver.Connector interface implementation
+func (connector *datastoreConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := connector.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return connector.driver.wrapConn(conn), nil
+}
+
+func (connector *datastoreConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+// datastoreConn is driver.Conn recording metrics of operations. Optional interfaces not implemented
+// by wrapped connection fall back to their database/sql defaults.
+type datastoreConn struct {
+	conn  driver.Conn
+	store *datastore
+	now   func() time.Time
+}
+
+// driver.Conn interface implementation
+func (c *datastoreConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *datastoreConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *datastoreConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// driver.ConnPrepareContext interface implementation
+func (c *datastoreConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	startTime := c.now()
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else if stmt, err = c.conn.Prepare(query); err == nil {
+		select {
+		case <-ctx.Done():
+			stmt.Close()
+			stmt, err = nil, ctx.Err()
+		default:
+		}
+	}
+	c.store.record(datastorePrepare, query, startTime, c.now, err)
+	if err != nil {
+		return nil, err
+	}
+	return &datastoreStmt{stmt: stmt, conn: c, query: query}, nil
+}
+
+// driver.ConnBeginTx interface implementation
+func (c *datastoreConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	startTime := c.now()
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		err = errors.New("sql: driver does not support non-default isolation level")
+	} else if opts.ReadOnly {
+		err = errors.New("sql: driver does not support read-only transactions")
+	} else {
+		tx, err = c.conn.Begin()
+	}
+	c.store.record(datastoreBegin, "", startTime, c.now, err)
+	if err != nil {
+		return nil, err
+	}
+	return &datastoreTx{tx: tx, conn: c}, nil
+}
+
+// driver.ExecerContext interface implementation
+func (c *datastoreConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	startTime := c.now()
+	if execer, ok := c.conn.(driver.ExecerContext); ok {
+		result, err = execer.ExecContext(ctx, query, args)
+	} else if execer, ok := c.conn.(driver.Execer); ok {
+		var values []driver.Value
+		if values, err = namedValuesToValues(ctx, args); err == nil {
+			result, err = execer.Exec(query, values)
+		}
+	} else {
+		return nil, driver.ErrSkip
+	}
+	c.store.record(datastoreExec, query, startTime, c.now, err)
+	return result, err
+}
+
+// driver.QueryerContext interface implementation
+func (c *datastoreConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	startTime := c.now()
+	if queryer, ok := c.conn.(driver.QueryerContext); ok {
+		rows, err = queryer.QueryContext(ctx, query, args)
+	} else if queryer, ok := c.conn.(driver.Queryer); ok {
+		var values []driver.Value
+		if values, err = namedValuesToValues(ctx, args); err == nil {
+			rows, err = queryer.Query(query, values)
+		}
+	} else {
+		return nil, driver.ErrSkip
+	}
+	c.store.record(datastoreQuery, query, startTime, c.now, err)
+	return rows, err
+}
+
+// driver.Pinger interface implementation
+func (c *datastoreConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// driver.SessionResetter interface implementation
+func (c *datastoreConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// driver.Validator interface implementation
+func (c *datastoreConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// driver.NamedValueChecker interface implementation
+func (c *datastoreConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// namedValuesToValues converts arguments for drivers not supporting context, like database/sql does
+func namedValuesToValues(ctx context.Context, args []driver.NamedValue) ([]driver.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// datastoreStmt is driver.Stmt recording metrics of executions
+type datastoreStmt struct {
+	stmt  driver.Stmt
+	conn  *datastoreConn
+	query string
+}
+
+// driver.Stmt interface implementation
+func (s *datastoreStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *datastoreStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *datastoreStmt) Exec(args []driver.Value) (driver.Result, error) {
+	startTime := s.conn.now()
+	result, err := s.stmt.Exec(args)
+	s.conn.store.record(datastoreExec, s.query, startTime, s.conn.now, err)
+	return result, err
+}
+
+func (s *datastoreStmt) Query(args []driver.Value) (driver.Rows, error) {
+	startTime := s.conn.now()
+	rows, err := s.stmt.Query(args)
+	s.conn.store.record(datastoreQuery, s.query, startTime, s.conn.now, err)
+	return rows, err
+}
+
+// driver.StmtExecContext interface implementation
+func (s *datastoreStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
+	startTime := s.conn.now()
+	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(ctx, args); err == nil {
+			result, err = s.stmt.Exec(values)
+		}
+	}
+	s.conn.store.record(datastoreExec, s.query, startTime, s.conn.now, err)
+	return result, err
+}
+
+// driver.StmtQueryContext interface implementation
+func (s *datastoreStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	startTime := s.conn.now()
+	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(ctx, args); err == nil {
+			rows, err = s.stmt.Query(values)
+		}
+	}
+	s.conn.store.record(datastoreQuery, s.query, startTime, s.conn.now, err)
+	return rows, err
+}
+
+// driver.NamedValueChecker interface implementation, database/sql does not ask connection
+// when statement implements it, so connection checker is used here
+func (s *datastoreStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return s.conn.CheckNamedValue(value)
+}
+
+// datastoreTx is driver.Tx recording metrics of commits and rollbacks
+type datastoreTx struct {
+	tx   driver.Tx
+	conn *datastoreConn
+}
+
+// driver.Tx interface implementation
+func (tx *datastoreTx) Commit() error {
+	startTime := tx.conn.now()
+	err := tx.tx.Commit()
+	tx.conn.store.record(datastoreCommit, "", startTime, tx.conn.now, err)
+	return err
+}
+
+func (tx *datastoreTx) Rollback() error {
+	startTime := tx.conn.now()
+	err := tx.tx.Rollback()
+	tx.conn.store.record(datastoreRollback, "", startTime, tx.conn.now, err)
+	return err
+}
@@ -0,0 +1,276 @@
+package gorelic
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	metrics "github.com/yvasiyarov/go-metrics"
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+const (
+	datastoreMetricsPrefix = "Datastore/"
+
+	// DefaultDatastoreMaxQueries is the number of query templates reported per datastore,
+	// other queries are reported as "other" template
+	DefaultDatastoreMaxQueries = 100
+
+	// maxQueryTemplateLength is the length query templates are truncated to
+	maxQueryTemplateLength = 200
+
+	// maxQueryNameLength is the length query templates are truncated to in metric names
+	maxQueryNameLength = 100
+
+	otherQueryTemplate = "other"
+)
+
+// Datastore operations
+const (
+	datastoreExec     = "exec"
+	datastoreQuery    = "query"
+	datastorePrepare  = "prepare"
+	datastoreBegin    = "begin"
+	datastoreCommit   = "commit"
+	datastoreRollback = "rollback"
+)
+
+var datastoreOperations = []string{datastoreExec, datastoreQuery, datastorePrepare, datastoreBegin, datastoreCommit, datastoreRollback}
+
+var (
+	queryCommentPattern = regexp.MustCompile(`(?s)/\*.*?\*/|--[^\n]*`)
+	queryStringPattern  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	queryNumberPattern  = regexp.MustCompile(`(^|[^\w$.])-?\d+(?:\.\d+)?\b`)
+	queryListPattern    = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	querySpacePattern   = regexp.MustCompile(`\s+`)
+	// slashes split metric names, brackets enclose units of platform metric names
+	queryNameReplacer = strings.NewReplacer("/", "_", "[", "(", "]", ")")
+)
+
+// normalizeQuery turns query into template: comments are removed, string and number literals are
+// replaced with ?, lists of literals are collapsed to (?) and whitespace is collapsed
+func normalizeQuery(query string) string {
+	query = queryCommentPattern.ReplaceAllString(query, " ")
+	query = queryStringPattern.ReplaceAllString(query, "?")
+	query = queryNumberPattern.ReplaceAllString(query, "${1}?")
+	query = queryListPattern.ReplaceAllString(query, "(?)")
+	query = strings.TrimSuffix(strings.TrimSpace(querySpacePattern.ReplaceAllString(query, " ")), ";")
+	return strings.TrimSpace(truncateString(query, maxQueryTemplateLength))
+}
+
+// queryMetricName returns query template shortened to be used in metric names, slashes and brackets are replaced.
+// Full template is reported as "query" label.
+func queryMetricName(template string) string {
+	return strings.TrimSpace(truncateString(queryNameReplacer.Replace(template), maxQueryNameLength))
+}
+
+// truncateString cuts s to at most length bytes without splitting multi-byte characters
+func truncateString(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	for length > 0 && !utf8.RuneStart(s[length]) {
+		length--
+	}
+	return s[:length]
+}
+
+// datastoreOperation collects metrics of operation or query template, counters are reset on every harvest
+type datastoreOperation struct {
+	// atomic counters are first to be 64-bit aligned on 32-bit platforms
+	calls  int64
+	errors int64
+	timer  metrics.Timer
+}
+
+func newDatastoreOperation() *datastoreOperation {
+	return &datastoreOperation{timer: metrics.NewTimer()}
+}
+
+func (operation *datastoreOperation) record(duration time.Duration, err error) {
+	operation.timer.Update(duration)
+	atomic.AddInt64(&operation.calls, 1)
+	if err != nil {
+		atomic.AddInt64(&operation.errors, 1)
+	}
+}
+
+// datastore collects metrics of one datastore
+type datastore struct {
+	sync.Mutex
+	name         string
+	queryMetrics bool
+	maxQueries   int
+	// operations are indexed like datastoreOperations
+	operations []*datastoreOperation
+	queries    map[string]*datastoreOperation
+}
+
+// record adds operation call, query is raw query of exec, query and prepare operations.
+// driver.ErrSkip is not recorded, database/sql repeats such calls in another way.
+func (store *datastore) record(operation string, query string, startTime time.Time, now func() time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	duration := now().Sub(startTime)
+	for i, known := range datastoreOperations {
+		if known == operation {
+			store.operations[i].record(duration, err)
+		}
+	}
+	if query == "" {
+		return
+	}
+	store.Lock()
+	queryMetrics := store.queryMetrics
+	store.Unlock()
+	if queryMetrics {
+		store.query(normalizeQuery(query)).record(duration, err)
+	}
+}
+
+// query returns metrics of query template, templates over the limit share "other" template
+func (store *datastore) query(template string) *datastoreOperation {
+	store.Lock()
+	defer store.Unlock()
+	operation := store.queries[template]
+	if operation == nil {
+		if len(store.queries) >= store.maxQueries {
+			template = otherQueryTemplate
+			if operation = store.queries[template]; operation != nil {
+				return operation
+			}
+		}
+		operation = newDatastoreOperation()
+		store.queries[template] = operation
+	}
+	return operation
+}
+
+// datastoreSource reports metrics of all wrapped drivers
+type datastoreSource struct {
+	sync.Mutex
+	datastores map[string]*datastore
+}
+
+func newDatastoreSource() *datastoreSource {
+	return &datastoreSource{datastores: make(map[string]*datastore)}
+}
+
+// datastore returns datastore by name, creating it on first call. Query metrics settings of later calls win.
+func (source *datastoreSource) datastore(name string, queryMetrics bool, maxQueries int) *datastore {
+	source.Lock()
+	defer source.Unlock()
+	store := source.datastores[name]
+	if store == nil {
+		store = &datastore{name: name, queries: make(map[string]*datastoreOperation)}
+		for range datastoreOperations {
+			store.operations = append(store.operations, newDatastoreOperation())
+		}
+		source.datastores[name] = store
+	}
+	store.Lock()
+	defer store.Unlock()
+	store.queryMetrics = queryMetrics
+	store.maxQueries = maxQueries
+	if store.maxQueries <= 0 {
+		store.maxQueries = DefaultDatastoreMaxQueries
+	}
+	return store
+}
+
+// iMetricaSource interface implementation. Counters are taken and reset, so they count calls since previous harvest.
+func (source *datastoreSource) Metricas() []nrpg.IMetrica {
+	source.Lock()
+	stores := make([]*datastore, 0, len(source.datastores))
+	for _, store := range source.datastores {
+		stores = append(stores, store)
+	}
+	source.Unlock()
+	sort.Slice(stores, func(i, j int) bool { return stores[i].name < stores[j].name })
+
+	var metricas []nrpg.IMetrica
+	add := func(name string, baseName string, labels map[string]string, operation *datastoreOperation) {
+		metricas = append(metricas, labeledTimerMetricas(name+"/responseTime", baseName+"/responseTime", labels, operation.timer)...)
+		metricas = append(metricas,
+			newLabeledMetrica(name+"/calls", baseName+"/calls", labels, "calls", float64(atomic.SwapInt64(&operation.calls, 0)), CountMetric),
+			newLabeledMetrica(name+"/errors", baseName+"/errors", labels, "errors", float64(atomic.SwapInt64(&operation.errors, 0)), CountMetric),
+		)
+	}
+	for _, store := range stores {
+		prefix := datastoreMetricsPrefix + store.name + "/"
+		for i, operation := range datastoreOperations {
+			labels := map[string]string{"datastore": store.name, "operation": operation}
+			add(prefix+"Operation/"+operation, datastoreMetricsPrefix+"Operation", labels, store.operations[i])
+		}
+
+		store.Lock()
+		templates := make([]string, 0, len(store.queries))
+		queries := make(map[string]*datastoreOperation, len(store.queries))
+		for template, operation := range store.queries {
+			templates = append(templates, template)
+			queries[template] = operation
+		}
+		store.Unlock()
+		sort.Strings(templates)
+		for _, template := range templates {
+			labels := map[string]string{"datastore": store.name, "query": template}
+			add(prefix+"Query/"+queryMetricName(template), datastoreMetricsPrefix+"Query", labels, queries[template])
+		}
+	}
+	return metricas
+}
+
+// dbStatsSource reports connection pool statistics of sql.DB, cumulative counters are reported as
+// deltas since previous harvest
+type dbStatsSource struct {
+	sync.Mutex
+	name     string
+	db       *sql.DB
+	previous sql.DBStats
+}
+
+// iMetricaSource interface implementation
+func (source *dbStatsSource) Metricas() []nrpg.IMetrica {
+	source.Lock()
+	defer source.Unlock()
+	stats := source.db.Stats()
+	previous := source.previous
+	source.previous = stats
+
+	prefix := datastoreMetricsPrefix + source.name + "/Pool/"
+	labels := map[string]string{"datastore": source.name}
+	value := func(name string, units string, value float64, metricType MetricType) nrpg.IMetrica {
+		return newLabeledMetrica(prefix+name, datastoreMetricsPrefix+"Pool/"+name, labels, units, value, metricType)
+	}
+	return []nrpg.IMetrica{
+		value("open", "connections", float64(stats.OpenConnections), GaugeMetric),
+		value("inUse", "connections", float64(stats.InUse), GaugeMetric),
+		value("idle", "connections", float64(stats.Idle), GaugeMetric),
+		value("maxOpen", "connections", float64(stats.MaxOpenConnections), GaugeMetric),
+		value("waitCount", "waits", float64(stats.WaitCount-previous.WaitCount), CountMetric),
+		value("waitDuration", "ms", float64(stats.WaitDuration-previous.WaitDuration)/float64(time.Millisecond), CountMetric),
+		value("maxIdleClosed", "connections", float64(stats.MaxIdleClosed-previous.MaxIdleClosed), CountMetric),
+		value("maxIdleTimeClosed", "connections", float64(stats.MaxIdleTimeClosed-previous.MaxIdleTimeClosed), CountMetric),
+		value("maxLifetimeClosed", "connections", float64(stats.MaxLifetimeClosed-previous.MaxLifetimeClosed), CountMetric),
+	}
+}
+
+// AddDBStats reports connection pool statistics of db under Datastore/<name>/Pool/...: open, inUse, idle and
+// maxOpen connections, waitCount, waitDuration (ms), maxIdleClosed, maxIdleTimeClosed and maxLifetimeClosed
+// connections since previous harvest.
+func (agent *Agent) AddDBStats(db *sql.DB, name string) {
+	source := &dbStatsSource{name: name, db: db, previous: db.Stats()}
+	agent.metricaSources = append(agent.metricaSources, source)
+	// Databases added after Run are registered immediately
+	if agent.registry != nil {
+		agent.registry.addSource(source)
+	}
+}
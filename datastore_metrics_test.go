@@ -0,0 +1,279 @@
+package gorelic
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var errFakeQuery = errors.New("fake query failed")
+
+// fakeDriver is database/sql driver answering every query with one row, queries containing "fail" fail.
+// Legacy connections implement only driver.Conn, so database/sql prepares statements for them.
+type fakeDriver struct {
+	legacy bool
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	if d.legacy {
+		return &fakeLegacyConn{}, nil
+	}
+	return &fakeConn{}, nil
+}
+
+type fakeConnector struct {
+	driver *fakeDriver
+}
+
+func (connector fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return connector.driver.Open("")
+}
+
+func (connector fakeConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+type fakeLegacyConn struct{}
+
+func (c *fakeLegacyConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{query: query}, nil
+}
+
+func (c *fakeLegacyConn) Close() error { return nil }
+
+func (c *fakeLegacyConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeConn struct {
+	fakeLegacyConn
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return (&fakeStmt{query: query}).Exec(nil)
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return (&fakeStmt{query: query}).Query(nil)
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "fail") {
+		return nil, errFakeQuery
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if strings.Contains(s.query, "fail") {
+		return nil, errFakeQuery
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (rows *fakeRows) Columns() []string { return []string{"n"} }
+
+func (rows *fakeRows) Close() error { return nil }
+
+func (rows *fakeRows) Next(dest []driver.Value) error {
+	if rows.done {
+		return io.EOF
+	}
+	rows.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error { return nil }
+
+func (fakeTx) Rollback() error { return nil }
+
+var _ = Describe("Datastore metrics", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+	var dbs []*sql.DB
+
+	calls := func(name string) float64 {
+		metric := findMetric(reporter.lastHarvest(), "Datastore/fake/"+name+"/calls")
+		Expect(metric).NotTo(BeNil(), name)
+		return metric.Value
+	}
+
+	openDB := func(d *fakeDriver) *sql.DB {
+		db := sql.OpenDB(agent.WrapConnector(fakeConnector{d}, "fake"))
+		dbs = append(dbs, db)
+		return db
+	}
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		reporter = &recordingReporter{}
+		agent.AddReporter(reporter)
+		Expect(agent.Run()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		for _, db := range dbs {
+			db.Close()
+		}
+		dbs = nil
+	})
+
+	It("should time operations", func() {
+		db := openDB(&fakeDriver{})
+		_, err := db.Exec("INSERT INTO users VALUES (?)", 1)
+		Expect(err).NotTo(HaveOccurred())
+		var n int
+		Expect(db.QueryRow("SELECT 1").Scan(&n)).To(Succeed())
+		tx, err := db.Begin()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tx.Commit()).To(Succeed())
+		tx, err = db.Begin()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tx.Rollback()).To(Succeed())
+		stmt, err := db.Prepare("SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stmt.QueryRow().Scan(&n)).To(Succeed())
+		stmt.Close()
+		agent.harvest()
+
+		Expect(calls("Operation/exec")).To(Equal(1.0))
+		Expect(calls("Operation/query")).To(Equal(2.0))
+		Expect(calls("Operation/prepare")).To(Equal(1.0))
+		Expect(calls("Operation/begin")).To(Equal(2.0))
+		Expect(calls("Operation/commit")).To(Equal(1.0))
+		Expect(calls("Operation/rollback")).To(Equal(1.0))
+		metric := findMetric(reporter.lastHarvest(), "Datastore/fake/Operation/exec/responseTime/max")
+		Expect(metric.Units).To(Equal("ms"))
+		Expect(metric.BaseName).To(Equal("Datastore/Operation/responseTime/max"))
+		Expect(metric.Labels).To(Equal(map[string]string{"datastore": "fake", "operation": "exec"}))
+		Expect(findMetric(reporter.lastHarvest(), "Datastore/fake/Query/SELECT ?/calls")).To(BeNil())
+
+		agent.harvest()
+		Expect(calls("Operation/exec")).To(Equal(0.0))
+	})
+
+	It("should count errors", func() {
+		db := openDB(&fakeDriver{})
+		_, err := db.Exec("fail")
+		Expect(err).To(MatchError(errFakeQuery))
+		agent.harvest()
+
+		Expect(findMetric(reporter.lastHarvest(), "Datastore/fake/Operation/exec/errors").Value).To(Equal(1.0))
+		Expect(findMetric(reporter.lastHarvest(), "Datastore/fake/Operation/query/errors").Value).To(Equal(0.0))
+	})
+
+	It("should fall back to prepared statements for legacy drivers", func() {
+		db := openDB(&fakeDriver{legacy: true})
+		_, err := db.Exec("DELETE FROM users")
+		Expect(err).NotTo(HaveOccurred())
+		agent.harvest()
+
+		Expect(calls("Operation/prepare")).To(Equal(1.0))
+		Expect(calls("Operation/exec")).To(Equal(1.0))
+	})
+
+	It("should wrap driver", func() {
+		connector, err := agent.WrapDriver(&fakeDriver{}, "fake").(driver.DriverContext).OpenConnector("dsn")
+		Expect(err).NotTo(HaveOccurred())
+		db := sql.OpenDB(connector)
+		defer db.Close()
+		_, err = db.Exec("DELETE FROM users")
+		Expect(err).NotTo(HaveOccurred())
+		agent.harvest()
+
+		Expect(calls("Operation/exec")).To(Equal(1.0))
+	})
+
+	It("should report query templates if enabled", func() {
+		agent.DatastoreQueryMetrics = true
+		agent.DatastoreMaxQueries = 2
+		db := openDB(&fakeDriver{})
+		for _, query := range []string{
+			"SELECT name FROM users WHERE id = 1",
+			"SELECT name FROM users WHERE id = 2",
+			"DELETE FROM users",
+			"DELETE FROM orders",
+			"DELETE FROM sessions",
+		} {
+			_, err := db.Exec(query)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		agent.harvest()
+
+		Expect(calls("Query/SELECT name FROM users WHERE id = ?")).To(Equal(2.0))
+		Expect(calls("Query/DELETE FROM users")).To(Equal(1.0))
+		Expect(calls("Query/other")).To(Equal(2.0))
+		metric := findMetric(reporter.lastHarvest(), "Datastore/fake/Query/DELETE FROM users/responseTime/mean")
+		Expect(metric.BaseName).To(Equal("Datastore/Query/responseTime/mean"))
+		Expect(metric.Labels).To(Equal(map[string]string{"datastore": "fake", "query": "DELETE FROM users"}))
+	})
+
+	It("should normalize queries", func() {
+		Expect(normalizeQuery("SELECT * FROM t1 WHERE id = 42 AND name = 'O''Brien'")).To(Equal("SELECT * FROM t1 WHERE id = ? AND name = ?"))
+		Expect(normalizeQuery("select *\n  from users -- all users\n where id in (1, 2, 3);")).To(Equal("select * from users where id in (?)"))
+		Expect(normalizeQuery("/* api */ UPDATE users SET score = -1.5 WHERE id = $1")).To(Equal("UPDATE users SET score = ? WHERE id = $1"))
+		Expect(normalizeQuery(strings.Repeat("x", 300))).To(HaveLen(maxQueryTemplateLength))
+		truncated := normalizeQuery("x" + strings.Repeat("ж", 150))
+		Expect(utf8.ValidString(truncated)).To(BeTrue())
+		Expect(len(truncated)).To(Equal(maxQueryTemplateLength - 1))
+	})
+
+	It("should sanitize query templates in metric names", func() {
+		Expect(queryMetricName("SELECT a/b FROM t1 WHERE c[?] = ?")).To(Equal("SELECT a_b FROM t1 WHERE c(?) = ?"))
+		Expect(queryMetricName(otherQueryTemplate)).To(Equal(otherQueryTemplate))
+		name := queryMetricName("SELECT " + strings.Repeat("ж", 100))
+		Expect(utf8.ValidString(name)).To(BeTrue())
+		Expect(len(name)).To(BeNumerically("<=", maxQueryNameLength))
+	})
+
+	It("should report pool statistics", func() {
+		db := openDB(&fakeDriver{})
+		db.SetMaxOpenConns(1)
+		agent.AddDBStats(db, "fake")
+
+		conn, err := db.Conn(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		done := make(chan error)
+		go func() {
+			_, err := db.Exec("DELETE FROM users")
+			done <- err
+		}()
+		Eventually(func() int64 { return db.Stats().WaitCount }).Should(Equal(int64(1)))
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "Datastore/fake/Pool/open").Value).To(Equal(1.0))
+		Expect(findMetric(reporter.lastHarvest(), "Datastore/fake/Pool/inUse").Value).To(Equal(1.0))
+		Expect(findMetric(reporter.lastHarvest(), "Datastore/fake/Pool/maxOpen").Value).To(Equal(1.0))
+		Expect(findMetric(reporter.lastHarvest(), "Datastore/fake/Pool/waitCount").Value).To(Equal(1.0))
+
+		conn.Close()
+		Expect(<-done).To(Succeed())
+		db.SetMaxIdleConns(0)
+		agent.harvest()
+		harvest := reporter.lastHarvest()
+		Expect(findMetric(harvest, "Datastore/fake/Pool/open").Value).To(Equal(0.0))
+		Expect(findMetric(harvest, "Datastore/fake/Pool/waitCount").Value).To(Equal(0.0))
+		Expect(findMetric(harvest, "Datastore/fake/Pool/waitDuration").Units).To(Equal("ms"))
+		Expect(findMetric(harvest, "Datastore/fake/Pool/maxIdleClosed").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "Datastore/fake/Pool/maxIdleClosed").Labels).To(Equal(map[string]string{"datastore": "fake"}))
+	})
+})
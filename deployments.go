@@ -0,0 +1,93 @@
+package gorelic
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Deployment marks release of new version of reporting process
+type Deployment struct {
+	Revision    string
+	Description string
+	User        string
+	Timestamp   time.Time
+}
+
+// DeploymentReporter is implemented by reporters which can mark deployments on dashboards
+type DeploymentReporter interface {
+	ReportDeployment(deployment Deployment) error
+}
+
+// RecordDeployment sends deployment marker through all reporters implementing DeploymentReporter.
+// Deployment is sent immediately, errors of all reporters are returned together.
+func (agent *Agent) RecordDeployment(revision string, description string, user string) error {
+	deployment := Deployment{
+		Revision:    revision,
+		Description: description,
+		User:        user,
+		Timestamp:   agent.clock().Now(),
+	}
+
+	var errs []string
+	for _, reporter := range agent.runConfig().reporters {
+		if deploymentReporter, ok := reporter.(DeploymentReporter); ok {
+			if err := deploymentReporter.ReportDeployment(deployment); err != nil {
+				errs = append(errs, fmt.Sprintf("%T: %v", reporter, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("can not record deployment: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+var revisionFileNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// revisionFile returns file where revision of last started build is kept
+func (agent *Agent) revisionFile() string {
+	if agent.DeploymentRevisionFile != "" {
+		return agent.DeploymentRevisionFile
+	}
+	name := revisionFileNamePattern.ReplaceAllString(agent.NewrelicName, "_")
+	return filepath.Join(os.TempDir(), "gorelic-"+name+".revision")
+}
+
+// recordDeploymentOnRevisionChange records deployment if build revision differs from the one persisted by previous run.
+// Revision is persisted before deployment is sent, so failed deployment is not retried on the next start.
+func (agent *Agent) recordDeploymentOnRevisionChange() {
+	revision := agent.BuildInfo.Revision
+	if revision == "" {
+		agent.logger().Debug("Build revision is unknown, deployment is not recorded.")
+		return
+	}
+
+	path := agent.revisionFile()
+	previous, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		agent.logger().Warn("Can not read last revision.", "path", path, "error", err)
+		return
+	}
+	if strings.TrimSpace(string(previous)) == revision {
+		return
+	}
+	if err := ioutil.WriteFile(path, []byte(revision+"\n"), 0644); err != nil {
+		agent.logger().Warn("Can not persist revision.", "path", path, "error", err)
+		return
+	}
+
+	description := "Build revision " + revision
+	if len(previous) > 0 {
+		description = fmt.Sprintf("Build revision changed from %s to %s", strings.TrimSpace(string(previous)), revision)
+	}
+	if err := agent.RecordDeployment(revision, description, os.Getenv("USER")); err != nil {
+		agent.stats.recordError("deployment", err)
+		agent.logger().Error("Can not record deployment.", "revision", revision, "error", err)
+	}
+}
@@ -0,0 +1,156 @@
+package gorelic
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type deploymentRecordingReporter struct {
+	recordingReporter
+	deployments []Deployment
+	err         error
+}
+
+func (reporter *deploymentRecordingReporter) ReportDeployment(deployment Deployment) error {
+	reporter.deployments = append(reporter.deployments, deployment)
+	return reporter.err
+}
+
+// annotationServer records requests of annotation reporters
+func annotationServer(requests *[]*http.Request, bodies *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		*requests = append(*requests, req)
+		*bodies = append(*bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+var _ = Describe("Deployments", func() {
+	var agent *Agent
+	var reporter *deploymentRecordingReporter
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		reporter = &deploymentRecordingReporter{}
+		agent.AddReporter(reporter)
+		agent.AddReporter(&recordingReporter{})
+	})
+
+	It("should pass deployment to reporters supporting it", func() {
+		Expect(agent.RecordDeployment("abc123", "Release 1.2", "alice")).To(Succeed())
+		Expect(reporter.deployments).To(HaveLen(1))
+		Expect(reporter.deployments[0].Revision).To(Equal("abc123"))
+		Expect(reporter.deployments[0].Description).To(Equal("Release 1.2"))
+		Expect(reporter.deployments[0].User).To(Equal("alice"))
+		Expect(reporter.deployments[0].Timestamp).NotTo(BeZero())
+	})
+
+	It("should return reporter errors", func() {
+		reporter.err = errors.New("unavailable")
+		Expect(agent.RecordDeployment("abc123", "", "")).To(MatchError(ContainSubstring("unavailable")))
+	})
+
+	Describe("on revision change", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "gorelic-deployments")
+			Expect(err).NotTo(HaveOccurred())
+			agent.DeploymentRevisionFile = filepath.Join(dir, "revision")
+			agent.BuildInfo = &BuildInfo{Revision: "abc123"}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should record deployment once per revision", func() {
+			agent.recordDeploymentOnRevisionChange()
+			agent.recordDeploymentOnRevisionChange()
+			Expect(reporter.deployments).To(HaveLen(1))
+			Expect(reporter.deployments[0].Revision).To(Equal("abc123"))
+			Expect(ioutil.ReadFile(agent.DeploymentRevisionFile)).To(Equal([]byte("abc123\n")))
+
+			agent.BuildInfo.Revision = "def456"
+			agent.recordDeploymentOnRevisionChange()
+			Expect(reporter.deployments).To(HaveLen(2))
+			Expect(reporter.deployments[1].Description).To(Equal("Build revision changed from abc123 to def456"))
+		})
+
+		It("should not record deployment of unknown revision", func() {
+			agent.BuildInfo.Revision = ""
+			agent.recordDeploymentOnRevisionChange()
+			Expect(reporter.deployments).To(BeEmpty())
+		})
+	})
+
+	Describe("reporters", func() {
+		var requests []*http.Request
+		var bodies []string
+		var server *httptest.Server
+		deployment := Deployment{Revision: "abc123", Description: "Release, 1.2", User: "alice", Timestamp: time.Unix(1500000000, 0)}
+
+		BeforeEach(func() {
+			requests, bodies = nil, nil
+			server = annotationServer(&requests, &bodies)
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should post Graphite event", func() {
+			reporter := NewGraphiteAnnotationReporter(server.URL + "/events/")
+			reporter.Tags = []string{"api"}
+			Expect(reporter.ReportDeployment(deployment)).To(Succeed())
+			Expect(requests[0].URL.Path).To(Equal("/events/"))
+			Expect(bodies[0]).To(MatchJSON(`{"what":"Deployment abc123","tags":["deployment","api"],"data":"Release, 1.2 by alice","when":1500000000}`))
+		})
+
+		It("should write InfluxDB point", func() {
+			reporter := NewInfluxDBAnnotationReporter(server.URL+"/", "metrics")
+			Expect(reporter.ReportDeployment(deployment)).To(Succeed())
+			Expect(requests[0].URL.Path).To(Equal("/write"))
+			Expect(requests[0].URL.Query().Get("db")).To(Equal("metrics"))
+			Expect(bodies[0]).To(Equal(`events,type=deployment,revision=abc123 title="Deployment abc123",text="Release, 1.2 by alice",user="alice" 1500000000` + "\n"))
+
+			Expect(reporter.ReportDeployment(Deployment{Description: "Hotfix", Timestamp: time.Unix(1500000000, 0)})).To(Succeed())
+			Expect(bodies[1]).To(Equal(`events,type=deployment title="Deployment",text="Hotfix",user="" 1500000000` + "\n"))
+		})
+
+		It("should send Insights Deployment event", func() {
+			reporter := NewInsightsReporter("42", "key")
+			reporter.Endpoint = server.URL
+			Expect(reporter.ReportDeployment(deployment)).To(Succeed())
+			Expect(requests[0].Header.Get("X-Insert-Key")).To(Equal("key"))
+		})
+
+		It("should fail on unsuccessful response", func() {
+			reporter := NewGraphiteAnnotationReporter(server.URL + "/missing")
+			server.Config.Handler = http.NotFoundHandler()
+			Expect(reporter.ReportDeployment(deployment)).To(MatchError(ContainSubstring("404")))
+		})
+	})
+
+	It("should be exported as Prometheus info metric", func() {
+		reporter := NewPrometheusReporter("app")
+		reporter.Report(&Harvest{})
+		reporter.ReportDeployment(Deployment{Revision: "abc123", Description: "Release", User: "alice"})
+
+		w := httptest.NewRecorder()
+		reporter.ServeHTTP(w, nil)
+		Expect(w.Body.String()).To(Equal(`# TYPE app_deployment_info gauge
+app_deployment_info{description="Release",revision="abc123",user="alice"} 1
+`))
+	})
+})
@@ -0,0 +1,160 @@
+package gorelic
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxEventsPerHarvest is the size of events reservoir
+	DefaultMaxEventsPerHarvest = 10000
+
+	maxEventTypeLength           = 255
+	maxEventAttributes           = 254
+	maxEventAttributeNameLength  = 255
+	maxEventAttributeValueLength = 4096
+)
+
+var eventTypePattern = regexp.MustCompile(`^[a-zA-Z0-9:_ ]+$`)
+
+// Event is a discrete occurrence recorded with Agent.RecordEvent
+type Event struct {
+	Type       string
+	Timestamp  time.Time
+	Attributes map[string]interface{}
+}
+
+// eventReservoir keeps at most capacity events recorded since previous harvest.
+// When it is full, events are sampled, so every recorded event has the same chance to be kept.
+type eventReservoir struct {
+	sync.Mutex
+	capacity int
+	events   []Event
+	seen     int64
+	invalid  int64
+	// stats of events taken by last harvest
+	lastSeen    int64
+	lastSampled int64
+	lastInvalid int64
+}
+
+func newEventReservoir(capacity int) *eventReservoir {
+	return &eventReservoir{capacity: capacity}
+}
+
+func (reservoir *eventReservoir) add(event Event) {
+	reservoir.Lock()
+	defer reservoir.Unlock()
+
+	reservoir.seen++
+	if len(reservoir.events) < reservoir.capacity {
+		reservoir.events = append(reservoir.events, event)
+	} else if i := rand.Int63n(reservoir.seen); i < int64(reservoir.capacity) {
+		reservoir.events[i] = event
+	}
+}
+
+func (reservoir *eventReservoir) addInvalid() {
+	reservoir.Lock()
+	defer reservoir.Unlock()
+	reservoir.invalid++
+}
+
+// swap returns events recorded since previous harvest and starts a new reservoir
+func (reservoir *eventReservoir) swap() []Event {
+	reservoir.Lock()
+	defer reservoir.Unlock()
+
+	events := reservoir.events
+	reservoir.lastSeen = reservoir.seen
+	reservoir.lastSampled = reservoir.seen - int64(len(events))
+	reservoir.lastInvalid = reservoir.invalid
+	reservoir.events = nil
+	reservoir.seen = 0
+	reservoir.invalid = 0
+	return events
+}
+
+func (reservoir *eventReservoir) setCapacity(capacity int) {
+	reservoir.Lock()
+	defer reservoir.Unlock()
+	reservoir.capacity = capacity
+}
+
+// RecordEvent records event of eventType with attributes. Events are passed to reporters with the next harvest.
+// Attribute values could be strings, numbers or booleans. At most MaxEventsPerHarvest events are kept per harvest,
+// events over this limit are sampled. Invalid events are dropped and error is returned.
+func (agent *Agent) RecordEvent(eventType string, attrs map[string]interface{}) error {
+	event, err := newEvent(eventType, attrs, agent.clock().Now())
+	if err != nil {
+		agent.events.addInvalid()
+		return err
+	}
+	agent.events.add(event)
+	return nil
+}
+
+// newEvent validates event and copies its attributes
+func newEvent(eventType string, attrs map[string]interface{}, timestamp time.Time) (Event, error) {
+	if len(eventType) > maxEventTypeLength || !eventTypePattern.MatchString(eventType) {
+		return Event{}, fmt.Errorf("invalid event type %q: it should be up to %d letters, digits, colons, underscores or spaces", eventType, maxEventTypeLength)
+	}
+	if len(attrs) > maxEventAttributes {
+		return Event{}, fmt.Errorf("event %s has %d attributes, at most %d are allowed", eventType, len(attrs), maxEventAttributes)
+	}
+
+	attributes := make(map[string]interface{}, len(attrs))
+	for name, value := range attrs {
+		if name == "" || len(name) > maxEventAttributeNameLength {
+			return Event{}, fmt.Errorf("event %s attribute name %q should be 1 to %d bytes long", eventType, name, maxEventAttributeNameLength)
+		}
+		if name == "eventType" || name == "timestamp" {
+			return Event{}, fmt.Errorf("event %s attribute name %q is reserved", eventType, name)
+		}
+		switch value := value.(type) {
+		case string:
+			if len(value) > maxEventAttributeValueLength {
+				return Event{}, fmt.Errorf("event %s attribute %s is longer than %d bytes", eventType, name, maxEventAttributeValueLength)
+			}
+		case float32:
+			if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+				return Event{}, fmt.Errorf("event %s attribute %s is not a finite number", eventType, name)
+			}
+		case float64:
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				return Event{}, fmt.Errorf("event %s attribute %s is not a finite number", eventType, name)
+			}
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		default:
+			return Event{}, fmt.Errorf("event %s attribute %s has unsupported type %T", eventType, name, value)
+		}
+		attributes[name] = value
+	}
+	return Event{Type: eventType, Timestamp: timestamp, Attributes: attributes}, nil
+}
+
+// addEventMetricsToComponent adds self-metrics of events reservoir, they describe events taken by last harvest
+func addEventMetricsToComponent(component iComponent, reservoir *eventReservoir) {
+	stats := map[string]*int64{
+		"Agent/Events/Seen":            &reservoir.lastSeen,
+		"Agent/Events/Dropped/Sampled": &reservoir.lastSampled,
+		"Agent/Events/Dropped/Invalid": &reservoir.lastInvalid,
+	}
+	for name, value := range stats {
+		value := value
+		component.AddMetrica(&customMetrica{
+			name:  name,
+			units: "events",
+			value: func() float64 {
+				reservoir.Lock()
+				defer reservoir.Unlock()
+				return float64(*value)
+			},
+			metricType: CountMetric,
+		})
+	}
+}
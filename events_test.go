@@ -0,0 +1,133 @@
+package gorelic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Events", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		reporter = &recordingReporter{}
+		agent.AddReporter(reporter)
+	})
+
+	It("should pass recorded events to reporters once", func() {
+		Expect(agent.Run()).To(Succeed())
+		attrs := map[string]interface{}{"job": "backup", "duration": 1.5, "ok": false}
+		Expect(agent.RecordEvent("JobFailed", attrs)).To(Succeed())
+		attrs["job"] = "changed"
+
+		agent.harvest()
+		Expect(reporter.lastHarvest().Events).To(HaveLen(1))
+		event := reporter.lastHarvest().Events[0]
+		Expect(event.Type).To(Equal("JobFailed"))
+		Expect(event.Attributes).To(Equal(map[string]interface{}{"job": "backup", "duration": 1.5, "ok": false}))
+		Expect(event.Timestamp).NotTo(BeZero())
+		Expect(findMetric(reporter.lastHarvest(), "Agent/Events/Seen").Value).To(Equal(1.0))
+
+		agent.harvest()
+		Expect(reporter.lastHarvest().Events).To(BeEmpty())
+		Expect(findMetric(reporter.lastHarvest(), "Agent/Events/Seen").Value).To(Equal(0.0))
+	})
+
+	It("should sample events over reservoir size", func() {
+		agent.MaxEventsPerHarvest = 10
+		Expect(agent.Run()).To(Succeed())
+		for i := 0; i < 100; i++ {
+			Expect(agent.RecordEvent("CacheEvicted", map[string]interface{}{"i": i})).To(Succeed())
+		}
+
+		agent.harvest()
+		Expect(reporter.lastHarvest().Events).To(HaveLen(10))
+		Expect(findMetric(reporter.lastHarvest(), "Agent/Events/Seen").Value).To(Equal(100.0))
+		Expect(findMetric(reporter.lastHarvest(), "Agent/Events/Dropped/Sampled").Value).To(Equal(90.0))
+	})
+
+	It("should drop invalid events", func() {
+		Expect(agent.Run()).To(Succeed())
+		invalid := map[string]map[string]interface{}{
+			"Bad-Type":  nil,
+			"BadValue":  {"value": []int{1}},
+			"NaN":       {"value": math.NaN()},
+			"Reserved":  {"timestamp": 1},
+			"NoName":    {"": 1},
+			"LongValue": {"value": strings.Repeat("a", 4097)},
+		}
+		for eventType, attrs := range invalid {
+			Expect(agent.RecordEvent(eventType, attrs)).NotTo(Succeed(), eventType)
+		}
+
+		agent.harvest()
+		Expect(reporter.lastHarvest().Events).To(BeEmpty())
+		Expect(findMetric(reporter.lastHarvest(), "Agent/Events/Dropped/Invalid").Value).To(Equal(6.0))
+	})
+})
+
+var _ = Describe("InsightsReporter", func() {
+	It("should choose endpoint by insert key region", func() {
+		Expect(InsightsEndpoint("42", "NRII-key")).To(Equal("https://insights-collector.newrelic.com/v1/accounts/42/events"))
+		Expect(InsightsEndpoint("42", "eu01xxkey")).To(Equal("https://insights-collector.eu01.nr-data.net/v1/accounts/42/events"))
+	})
+
+	It("should send events in insert API format", func() {
+		var payloads [][]map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			Expect(req.URL.Path).To(Equal("/v1/accounts/42/events"))
+			Expect(req.Header.Get("X-Insert-Key")).To(Equal("key"))
+			Expect(req.Header.Get("Content-Encoding")).To(Equal("gzip"))
+
+			var body bytes.Buffer
+			body.ReadFrom(req.Body)
+			reader, err := gzip.NewReader(&body)
+			Expect(err).NotTo(HaveOccurred())
+			var payload []map[string]interface{}
+			Expect(json.NewDecoder(reader).Decode(&payload)).To(Succeed())
+			payloads = append(payloads, payload)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		reporter := NewInsightsReporter("42", "key")
+		reporter.Endpoint = server.URL + "/v1/accounts/42/events"
+		reporter.BatchSize = 2
+		timestamp := time.Unix(1500000000, 0)
+		Expect(reporter.Report(&Harvest{
+			Labels: map[string]string{"host": "web-1"},
+			Events: []Event{
+				{Type: "Deploy", Timestamp: timestamp, Attributes: map[string]interface{}{"revision": "abc"}},
+				{Type: "JobFailed", Timestamp: timestamp, Attributes: map[string]interface{}{"host": "worker-1"}},
+				{Type: "JobFailed", Timestamp: timestamp},
+			},
+		})).To(Succeed())
+
+		Expect(payloads).To(HaveLen(2))
+		Expect(payloads[0][0]).To(Equal(map[string]interface{}{
+			"eventType": "Deploy",
+			"timestamp": 1500000000000.0,
+			"revision":  "abc",
+			"host":      "web-1",
+		}))
+		Expect(payloads[0][1]).To(HaveKeyWithValue("host", "worker-1"))
+		Expect(payloads[1]).To(HaveLen(1))
+	})
+
+	It("should not send anything without events", func() {
+		reporter := NewInsightsReporter("42", "key")
+		reporter.Endpoint = "http://127.0.0.1:0/"
+		Expect(reporter.Report(&Harvest{})).To(Succeed())
+	})
+})
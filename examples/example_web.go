@@ -61,6 +61,7 @@ func doSomeJob(numRoutines int) {
 }
 
 func helloServer(w http.ResponseWriter, req *http.Request) {
+	numCalls.Add(1)
 	doSomeJob(5)
 	io.WriteString(w, "Did some work")
 }
@@ -73,6 +74,8 @@ func main() {
 	agent := gorelic.NewAgent()
 	agent.Verbose = true
 	agent.CollectHTTPStat = true
+	agent.CollectExpvarStat = true
+	agent.ExpvarDeltas = []string{"num_calls"}
 	agent.NewrelicLicense = *newrelicLicense
 	agent.AddCustomMetric(&WaveMetrica{
 		sawtoothMax:     10,
@@ -80,6 +83,6 @@ func main() {
 	})
 	agent.Run()
 
-	http.HandleFunc("/", agent.WrapHTTPHandlerFunc(helloServer))
+	http.HandleFunc("/", agent.WrapHTTPHandlerFunc(helloServer, "/"))
 	http.ListenAndServe(":8080", nil)
 }
@@ -0,0 +1,176 @@
+package gorelic
+
+import (
+	"encoding/json"
+	"expvar"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+const expvarMetricsPrefix = "Expvar/"
+
+// DefaultExpvarExclude skips variables published by expvar package itself.
+// Memory statistic is reported by memory allocator metrics.
+var DefaultExpvarExclude = []string{"memstats", "cmdline"}
+
+// expvarSource reports numeric expvar variables.
+// Variables are walked on every harvest, so variables published later are reported too.
+// Map and Func variables are reported by their numeric JSON leaves, nested keys are joined with slashes.
+type expvarSource struct {
+	sync.Mutex
+	include  []string
+	exclude  []string
+	deltas   []string
+	metricas map[string]*expvarMetrica
+}
+
+func newExpvarSource(include []string, exclude []string, deltas []string) (*expvarSource, error) {
+	for _, patterns := range [][]string{include, exclude, deltas} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &expvarSource{
+		include:  include,
+		exclude:  exclude,
+		deltas:   deltas,
+		metricas: make(map[string]*expvarMetrica),
+	}, nil
+}
+
+// iMetricaSource interface implementation
+func (source *expvarSource) Metricas() []nrpg.IMetrica {
+	source.Lock()
+	defer source.Unlock()
+
+	values := make(map[string]float64)
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !source.isWalked(kv.Key) {
+			return
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(kv.Value.String()), &value); err != nil {
+			return
+		}
+		source.walk(kv.Key, value, values)
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metricas := make(map[string]*expvarMetrica, len(values))
+	result := make([]nrpg.IMetrica, 0, len(values))
+	for _, name := range names {
+		metrica, ok := source.metricas[name]
+		if !ok {
+			metrica = &expvarMetrica{name: expvarMetricsPrefix + name, units: "value", delta: matchesAny(source.deltas, name)}
+		}
+		metrica.currentValue = values[name]
+		metricas[name] = metrica
+		result = append(result, metrica)
+	}
+	source.metricas = metricas
+	return result
+}
+
+// walk collects numeric leaves of decoded JSON value
+func (source *expvarSource) walk(name string, value interface{}, values map[string]float64) {
+	switch value := value.(type) {
+	case float64:
+		if source.isReported(name) {
+			values[name] = value
+		}
+	case map[string]interface{}:
+		for key, nested := range value {
+			source.walk(name+"/"+key, nested, values)
+		}
+	}
+}
+
+// isWalked checks if variable could contain reported values
+func (source *expvarSource) isWalked(key string) bool {
+	if matchesAny(source.exclude, key) {
+		return false
+	}
+	if len(source.include) == 0 {
+		return true
+	}
+	for _, pattern := range source.include {
+		if ok, _ := path.Match(strings.SplitN(pattern, "/", 2)[0], key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isReported checks name against include and exclude patterns.
+// All names are included if there are no include patterns.
+func (source *expvarSource) isReported(name string) bool {
+	if matchesAny(source.exclude, name) {
+		return false
+	}
+	return len(source.include) == 0 || matchesAny(source.include, name)
+}
+
+// matchesAny checks if name or any of its parents matches one of path.Match patterns,
+// so "memstats" pattern matches "memstats/Alloc" as well.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		for prefix := name; ; {
+			if ok, _ := path.Match(pattern, prefix); ok {
+				return true
+			}
+			i := strings.LastIndex(prefix, "/")
+			if i < 0 {
+				break
+			}
+			prefix = prefix[:i]
+		}
+	}
+	return false
+}
+
+// expvarMetrica reports value taken during last walk of expvar variables.
+// Delta metricas report increase since previous harvest.
+type expvarMetrica struct {
+	name          string
+	units         string
+	delta         bool
+	currentValue  float64
+	previousValue float64
+}
+
+// nrpg.IMetrica interface implementation.
+func (m *expvarMetrica) GetName() string { return m.name }
+
+func (m *expvarMetrica) GetUnits() string { return m.units }
+
+// TypedMetrica interface implementation.
+func (m *expvarMetrica) GetType() MetricType {
+	if m.delta {
+		return CountMetric
+	}
+	return GaugeMetric
+}
+
+func (m *expvarMetrica) GetValue() (float64, error) {
+	if !m.delta {
+		return m.currentValue, nil
+	}
+	value := m.currentValue - m.previousValue
+	if value < 0 {
+		// variable was reset
+		value = m.currentValue
+	}
+	m.previousValue = m.currentValue
+	return value, nil
+}
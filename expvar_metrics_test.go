@@ -0,0 +1,90 @@
+package gorelic
+
+import (
+	"expvar"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// expvar variables can not be unpublished, so they are shared by all tests
+var (
+	testExpvarCalls = expvar.NewInt("gorelic_test_calls")
+	testExpvarRatio = expvar.NewFloat("gorelic_test_ratio")
+	testExpvarMap   = expvar.NewMap("gorelic_test_map")
+)
+
+func init() {
+	testExpvarMap.Add("hits", 2)
+	testExpvarMap.AddFloat("load", 0.5)
+	testExpvarMap.Set("name", func() expvar.Var {
+		s := new(expvar.String)
+		s.Set("not a number")
+		return s
+	}())
+	expvar.Publish("gorelic_test_func", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"pool":  map[string]int{"idle": 3, "busy": 1},
+			"items": []int{1, 2},
+		}
+	}))
+}
+
+var _ = Describe("Expvar metrics", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		agent.CollectExpvarStat = true
+		agent.ExpvarInclude = []string{"gorelic_test_*"}
+		reporter = &recordingReporter{}
+		agent.AddReporter(reporter)
+		testExpvarCalls.Set(10)
+		testExpvarRatio.Set(0.25)
+	})
+
+	It("should report numeric variables and leaves", func() {
+		Expect(agent.Run()).To(Succeed())
+
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_calls").Value).To(Equal(10.0))
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_ratio").Value).To(Equal(0.25))
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_map/hits").Value).To(Equal(2.0))
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_map/load").Value).To(Equal(0.5))
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_map/name")).To(BeNil())
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_func/pool/idle").Value).To(Equal(3.0))
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_func/items")).To(BeNil())
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/memstats/Alloc")).To(BeNil())
+	})
+
+	It("should apply include and exclude patterns to nested names", func() {
+		agent.ExpvarInclude = []string{"gorelic_test_func/pool/*", "gorelic_test_calls"}
+		agent.ExpvarExclude = []string{"gorelic_test_func/pool/busy"}
+		Expect(agent.Run()).To(Succeed())
+
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_calls")).NotTo(BeNil())
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_func/pool/idle")).NotTo(BeNil())
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_func/pool/busy")).To(BeNil())
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_ratio")).To(BeNil())
+	})
+
+	It("should report increase of delta variables", func() {
+		agent.ExpvarDeltas = []string{"gorelic_test_calls"}
+		Expect(agent.Run()).To(Succeed())
+
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_calls").Value).To(Equal(10.0))
+
+		testExpvarCalls.Add(5)
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_calls").Value).To(Equal(5.0))
+		Expect(findMetric(reporter.lastHarvest(), "Expvar/gorelic_test_ratio").Value).To(Equal(0.25))
+	})
+
+	It("should fail to run with invalid pattern", func() {
+		agent.ExpvarExclude = []string{"["}
+		Expect(agent.Run()).NotTo(Succeed())
+	})
+})
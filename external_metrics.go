@@ -0,0 +1,394 @@
+package gorelic
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metrics "github.com/yvasiyarov/go-metrics"
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+const (
+	externalMetricsPrefix = "External/"
+
+	// DefaultExternalMaxDestinations is the number of destinations named by request host reported by WrapTransport,
+	// requests to other hosts are reported as "other" destination
+	DefaultExternalMaxDestinations = 100
+
+	otherExternalDestination = "other"
+)
+
+// External network error types
+const (
+	externalErrorDNS     = "dns"
+	externalErrorDial    = "dial"
+	externalErrorTLS     = "tls"
+	externalErrorTimeout = "timeout"
+	externalErrorOther   = "other"
+)
+
+var (
+	externalErrorTypes    = []string{externalErrorDNS, externalErrorDial, externalErrorTLS, externalErrorTimeout, externalErrorOther}
+	externalStatusClasses = []string{"2xx", "3xx", "4xx", "5xx"}
+)
+
+// WrapTransport instruments outbound HTTP requests sent with rt, nil rt means http.DefaultTransport.
+// Metrics are reported per destination under External/<name>/..., name is request host if empty,
+// at most ExternalMaxDestinations hosts are reported, the rest share "other" destination:
+// response time (until response headers), calls, status classes, network errors by type (dns, dial, tls,
+// timeout, other) and requests in flight (until response body is closed).
+// Connection phases are reported under External/<name>/Phases/...: dns, connect, tls, ttfb (from request written
+// to first response byte) timers and connectionReuse, percentage of requests sent over reused connections.
+// Requests with trace in context (see NewTraceContext) are recorded as External/<name> segments of the trace.
+//
+//	client := &http.Client{Transport: agent.WrapTransport(nil, "billing-api")}
+func (agent *Agent) WrapTransport(rt http.RoundTripper, name string) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	maxHosts := agent.ExternalMaxDestinations
+	if maxHosts <= 0 {
+		maxHosts = DefaultExternalMaxDestinations
+	}
+	return &externalTransport{transport: rt, name: name, maxHosts: maxHosts, externals: agent.externals, now: agent.clock().Now}
+}
+
+// externalTransport is http.RoundTripper recording metrics of outbound requests
+type externalTransport struct {
+	transport http.RoundTripper
+	name      string
+	maxHosts  int
+	externals *externalSource
+	now       func() time.Time
+}
+
+// http.RoundTripper interface implementation
+func (t *externalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var destination *externalDestination
+	if t.name != "" {
+		destination = t.externals.destination(t.name)
+	} else {
+		destination = t.externals.hostDestination(req.URL.Hostname(), t.maxHosts)
+	}
+	name := destination.name
+	if trace := TraceFromContext(req.Context()); trace != nil {
+		segment := trace.BeginSegment(externalMetricsPrefix + name)
+		defer segment.EndTrace()
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), newExternalPhases(destination, t.now).clientTrace()))
+	atomic.AddInt64(&destination.inFlight, 1)
+	startTime := t.now()
+	resp, err := t.transport.RoundTrip(req)
+	destination.timer.Update(t.now().Sub(startTime))
+	atomic.AddInt64(&destination.calls, 1)
+	if err != nil {
+		atomic.AddInt64(&destination.inFlight, -1)
+		destination.addError(externalErrorType(req.Context(), err))
+		return resp, err
+	}
+	destination.addStatus(resp.StatusCode)
+	if resp.Body == nil || resp.Body == http.NoBody {
+		atomic.AddInt64(&destination.inFlight, -1)
+	} else {
+		resp.Body = &inFlightBody{ReadCloser: resp.Body, inFlight: &destination.inFlight}
+	}
+	return resp, nil
+}
+
+// externalPhases records connection phases of one request, hooks may be called from dialing goroutines
+type externalPhases struct {
+	sync.Mutex
+	destination   *externalDestination
+	now           func() time.Time
+	dnsStart      time.Time
+	connectStarts map[string]time.Time
+	tlsStart      time.Time
+	wroteRequest  time.Time
+}
+
+func newExternalPhases(destination *externalDestination, now func() time.Time) *externalPhases {
+	return &externalPhases{destination: destination, now: now, connectStarts: make(map[string]time.Time)}
+}
+
+// clientTrace returns hooks recording durations of successful phases
+func (phases *externalPhases) clientTrace() *httptrace.ClientTrace {
+	destination := phases.destination
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { phases.begin(&phases.dnsStart) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			phases.end(&phases.dnsStart, destination.dns, info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			phases.Lock()
+			defer phases.Unlock()
+			phases.connectStarts[network+" "+addr] = phases.now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			phases.Lock()
+			defer phases.Unlock()
+			start, ok := phases.connectStarts[network+" "+addr]
+			delete(phases.connectStarts, network+" "+addr)
+			if ok && err == nil {
+				destination.connect.Update(phases.now().Sub(start))
+			}
+		},
+		TLSHandshakeStart: func() { phases.begin(&phases.tlsStart) },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			phases.end(&phases.tlsStart, destination.tls, err)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			atomic.AddInt64(&destination.connections, 1)
+			if info.Reused {
+				atomic.AddInt64(&destination.reusedConnections, 1)
+			}
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				phases.begin(&phases.wroteRequest)
+			}
+		},
+		GotFirstResponseByte: func() { phases.end(&phases.wroteRequest, destination.ttfb, nil) },
+	}
+}
+
+// begin records start time of phase
+func (phases *externalPhases) begin(start *time.Time) {
+	phases.Lock()
+	defer phases.Unlock()
+	*start = phases.now()
+}
+
+// end records duration of started phase unless it failed
+func (phases *externalPhases) end(start *time.Time, timer metrics.Timer, err error) {
+	phases.Lock()
+	defer phases.Unlock()
+	if !start.IsZero() && err == nil {
+		timer.Update(phases.now().Sub(*start))
+	}
+	*start = time.Time{}
+}
+
+// inFlightBody decrements in flight requests when body is read to the end or closed
+type inFlightBody struct {
+	io.ReadCloser
+	inFlight *int64
+	once     sync.Once
+}
+
+func (body *inFlightBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if err != nil {
+		body.done()
+	}
+	return n, err
+}
+
+func (body *inFlightBody) Close() error {
+	body.done()
+	return body.ReadCloser.Close()
+}
+
+func (body *inFlightBody) done() {
+	body.once.Do(func() { atomic.AddInt64(body.inFlight, -1) })
+}
+
+// externalErrorType classifies error of outbound request
+func externalErrorType(ctx context.Context, err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return externalErrorTimeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return externalErrorDNS
+	}
+	var headerErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &headerErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) || strings.Contains(err.Error(), "tls: ") {
+		return externalErrorTLS
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return externalErrorDial
+	}
+	return externalErrorOther
+}
+
+// externalDestination collects metrics of one destination, counters are reset on every harvest
+type externalDestination struct {
+	// atomic counters are first to be 64-bit aligned on 32-bit platforms
+	calls             int64
+	inFlight          int64
+	connections       int64
+	reusedConnections int64
+	// counters are indexed like externalStatusClasses and externalErrorTypes
+	statuses [4]int64
+	errors   [5]int64
+	name     string
+	timer    metrics.Timer
+	// timers of connection phases
+	dns     metrics.Timer
+	connect metrics.Timer
+	tls     metrics.Timer
+	ttfb    metrics.Timer
+}
+
+func (destination *externalDestination) addStatus(status int) {
+	if class := status/100 - 2; class >= 0 && class < len(destination.statuses) {
+		atomic.AddInt64(&destination.statuses[class], 1)
+	}
+}
+
+func (destination *externalDestination) addError(errorType string) {
+	for i, known := range externalErrorTypes {
+		if known == errorType {
+			atomic.AddInt64(&destination.errors[i], 1)
+			return
+		}
+	}
+}
+
+// externalSource reports metrics of all destinations
+type externalSource struct {
+	sync.Mutex
+	destinations map[string]*externalDestination
+	// hosts are destinations named by request host
+	hosts map[string]bool
+}
+
+func newExternalSource() *externalSource {
+	return &externalSource{destinations: make(map[string]*externalDestination), hosts: make(map[string]bool)}
+}
+
+// hostDestination returns destination named by request host, hosts over the limit share "other" destination
+func (source *externalSource) hostDestination(host string, maxHosts int) *externalDestination {
+	source.Lock()
+	if !source.hosts[host] {
+		if len(source.hosts) >= maxHosts {
+			host = otherExternalDestination
+		} else {
+			source.hosts[host] = true
+		}
+	}
+	source.Unlock()
+	return source.destination(host)
+}
+
+// destination returns destination by name, creating it on first call
+func (source *externalSource) destination(name string) *externalDestination {
+	source.Lock()
+	defer source.Unlock()
+	destination := source.destinations[name]
+	if destination == nil {
+		destination = &externalDestination{
+			name:    name,
+			timer:   metrics.NewTimer(),
+			dns:     metrics.NewTimer(),
+			connect: metrics.NewTimer(),
+			tls:     metrics.NewTimer(),
+			ttfb:    metrics.NewTimer(),
+		}
+		source.destinations[name] = destination
+	}
+	return destination
+}
+
+// iMetricaSource interface implementation. Counters are taken and reset, so they count requests since previous harvest.
+func (source *externalSource) Metricas() []nrpg.IMetrica {
+	source.Lock()
+	destinations := make([]*externalDestination, 0, len(source.destinations))
+	for _, destination := range source.destinations {
+		destinations = append(destinations, destination)
+	}
+	source.Unlock()
+	sort.Slice(destinations, func(i, j int) bool { return destinations[i].name < destinations[j].name })
+
+	var metricas []nrpg.IMetrica
+	for _, destination := range destinations {
+		labels := map[string]string{"host": destination.name}
+		prefix := externalMetricsPrefix + destination.name + "/"
+		timers := func(name string, timer metrics.Timer) {
+			metricas = append(metricas, labeledTimerMetricas(prefix+name, externalMetricsPrefix+name, labels, timer)...)
+		}
+		timers("responseTime", destination.timer)
+		timers("Phases/dns", destination.dns)
+		timers("Phases/connect", destination.connect)
+		timers("Phases/tls", destination.tls)
+		timers("Phases/ttfb", destination.ttfb)
+
+		value := func(name string, units string, value float64, metricType MetricType) {
+			metricas = append(metricas, newLabeledMetrica(prefix+name, externalMetricsPrefix+name, labels, units, value, metricType))
+		}
+		value("calls", "calls", float64(atomic.SwapInt64(&destination.calls, 0)), CountMetric)
+		value("inFlight", "requests", float64(atomic.LoadInt64(&destination.inFlight)), GaugeMetric)
+		for i, class := range externalStatusClasses {
+			value("status/"+class, "calls", float64(atomic.SwapInt64(&destination.statuses[i], 0)), CountMetric)
+		}
+		for i, errorType := range externalErrorTypes {
+			value("errors/"+errorType, "errors", float64(atomic.SwapInt64(&destination.errors[i], 0)), CountMetric)
+		}
+		connections, reused := atomic.SwapInt64(&destination.connections, 0), atomic.SwapInt64(&destination.reusedConnections, 0)
+		reusePercent := 0.0
+		if connections > 0 {
+			reusePercent = float64(reused) * 100 / float64(connections)
+		}
+		value("Phases/connectionReuse", "percent", reusePercent, GaugeMetric)
+	}
+	return metricas
+}
+
+// labeledMetrica is customMetrica with labels for dimensional reporters
+type labeledMetrica struct {
+	customMetrica
+	baseName string
+	labels   map[string]string
+}
+
+// newLabeledMetrica returns labeledMetrica reporting value
+func newLabeledMetrica(name string, baseName string, labels map[string]string, units string, value float64, metricType MetricType) *labeledMetrica {
+	return &labeledMetrica{
+		customMetrica: customMetrica{name: name, units: units, value: func() float64 { return value }, metricType: metricType},
+		baseName:      baseName,
+		labels:        labels,
+	}
+}
+
+// LabeledMetrica interface implementation
+func (m *labeledMetrica) GetLabels() (string, map[string]string) {
+	return m.baseName, m.labels
+}
+
+// labeledTimerMetricas returns mean, max, min and percentile95 of timer in ms as <name>/<stat> metricas
+func labeledTimerMetricas(name string, baseName string, labels map[string]string, timer metrics.Timer) []nrpg.IMetrica {
+	newBase := func(stat string) *baseTimerMetrica {
+		return &baseTimerMetrica{
+			name:       name + "/" + stat,
+			baseName:   baseName + "/" + stat,
+			labels:     labels,
+			units:      "ms",
+			dataSource: timer,
+		}
+	}
+	return []nrpg.IMetrica{
+		&timerMeanMetrica{newBase("mean")},
+		&timerMaxMetrica{newBase("max")},
+		&timerMinMetrica{newBase("min")},
+		&timerPercentile95Metrica{newBase("percentile95")},
+	}
+}
@@ -0,0 +1,188 @@
+package gorelic
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("External metrics", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+	var server *httptest.Server
+	var client *http.Client
+
+	get := func(path string) {
+		resp, err := client.Get(server.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		reporter = &recordingReporter{}
+		agent.AddReporter(reporter)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/fail" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			w.Write([]byte("ok"))
+		}))
+		client = &http.Client{Transport: agent.WrapTransport(nil, "billing")}
+		Expect(agent.Run()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should count calls by status class", func() {
+		get("/")
+		get("/")
+		get("/fail")
+		agent.harvest()
+
+		harvest := reporter.lastHarvest()
+		Expect(findMetric(harvest, "External/billing/calls").Value).To(Equal(3.0))
+		Expect(findMetric(harvest, "External/billing/status/2xx").Value).To(Equal(2.0))
+		Expect(findMetric(harvest, "External/billing/status/5xx").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "External/billing/errors/dial").Value).To(Equal(0.0))
+
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "External/billing/calls").Value).To(Equal(0.0))
+	})
+
+	It("should report response time with host label", func() {
+		get("/")
+		agent.harvest()
+
+		metric := findMetric(reporter.lastHarvest(), "External/billing/responseTime/max")
+		Expect(metric).NotTo(BeNil())
+		Expect(metric.Units).To(Equal("ms"))
+		Expect(metric.BaseName).To(Equal("External/responseTime/max"))
+		Expect(metric.Labels).To(Equal(map[string]string{"host": "billing"}))
+	})
+
+	It("should use request host by default", func() {
+		client.Transport = agent.WrapTransport(nil, "")
+		get("/")
+		agent.harvest()
+
+		Expect(findMetric(reporter.lastHarvest(), "External/127.0.0.1/calls").Value).To(Equal(1.0))
+	})
+
+	It("should report hosts over the limit as other destination", func() {
+		agent.ExternalMaxDestinations = 1
+		client.Transport = agent.WrapTransport(nil, "")
+		get("/")
+		_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Get("http://localhost:" + port + "/")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		get("/")
+		agent.harvest()
+
+		Expect(findMetric(reporter.lastHarvest(), "External/127.0.0.1/calls").Value).To(Equal(2.0))
+		Expect(findMetric(reporter.lastHarvest(), "External/other/calls").Value).To(Equal(1.0))
+		Expect(findMetric(reporter.lastHarvest(), "External/localhost/calls")).To(BeNil())
+	})
+
+	It("should count requests in flight until body is closed", func() {
+		resp, err := client.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "External/billing/inFlight").Value).To(Equal(1.0))
+
+		resp.Body.Close()
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "External/billing/inFlight").Value).To(Equal(0.0))
+	})
+
+	It("should count network errors by type", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		address := listener.Addr().String()
+		listener.Close()
+
+		_, err = client.Get("http://" + address)
+		Expect(err).To(HaveOccurred())
+		agent.harvest()
+
+		harvest := reporter.lastHarvest()
+		Expect(findMetric(harvest, "External/billing/errors/dial").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "External/billing/calls").Value).To(Equal(1.0))
+		Expect(findMetric(harvest, "External/billing/inFlight").Value).To(Equal(0.0))
+	})
+
+	It("should classify errors", func() {
+		ctx := context.Background()
+		Expect(externalErrorType(ctx, &net.DNSError{Err: "no such host", Name: "billing"})).To(Equal(externalErrorDNS))
+		Expect(externalErrorType(ctx, &net.OpError{Op: "dial", Err: errors.New("refused")})).To(Equal(externalErrorDial))
+		Expect(externalErrorType(ctx, timeoutError{})).To(Equal(externalErrorTimeout))
+		Expect(externalErrorType(ctx, errors.New("remote error: tls: bad certificate"))).To(Equal(externalErrorTLS))
+		Expect(externalErrorType(ctx, errors.New("unexpected EOF"))).To(Equal(externalErrorOther))
+
+		expired, cancel := context.WithTimeout(ctx, time.Nanosecond)
+		defer cancel()
+		<-expired.Done()
+		Expect(externalErrorType(expired, errors.New("canceled"))).To(Equal(externalErrorTimeout))
+	})
+
+	It("should time connection phases", func() {
+		tlsServer := httptest.NewTLSServer(server.Config.Handler)
+		defer tlsServer.Close()
+		client.Transport = agent.WrapTransport(tlsServer.Client().Transport, "billing")
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(tlsServer.URL)
+			Expect(err).NotTo(HaveOccurred())
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		agent.harvest()
+
+		destination := agent.externals.destination("billing")
+		Expect(destination.connect.Count()).To(Equal(int64(1)))
+		Expect(destination.tls.Count()).To(Equal(int64(1)))
+		Expect(destination.ttfb.Count()).To(Equal(int64(2)))
+		harvest := reporter.lastHarvest()
+		Expect(findMetric(harvest, "External/billing/Phases/tls/max").Units).To(Equal("ms"))
+		Expect(findMetric(harvest, "External/billing/Phases/tls/max").BaseName).To(Equal("External/Phases/tls/max"))
+		Expect(findMetric(harvest, "External/billing/Phases/connectionReuse").Value).To(Equal(50.0))
+
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "External/billing/Phases/connectionReuse").Value).To(Equal(0.0))
+	})
+
+	It("should time DNS lookup", func() {
+		_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Get("http://localhost:" + port)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		Expect(agent.externals.destination("billing").dns.Count()).To(Equal(int64(1)))
+	})
+
+	It("should record requests as trace segments", func() {
+		trace := agent.Tracer.BeginTrace("checkout")
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Do(req.WithContext(NewTraceContext(req.Context(), trace)))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		trace.EndTrace()
+		agent.harvest()
+
+		Expect(findMetric(reporter.lastHarvest(), "Trace/checkout/External/billing/max")).NotTo(BeNil())
+		Expect(TraceFromContext(context.Background())).To(BeNil())
+	})
+})
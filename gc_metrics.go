@@ -2,19 +2,19 @@ package gorelic
 
 import (
 	metrics "github.com/yvasiyarov/go-metrics"
-	nrpg "github.com/yvasiyarov/newrelic_platform_go"
 	"time"
 )
 
-func newGCMetricaDataSource(pollInterval int) goMetricaDataSource {
+func newGCMetricaDataSource(pollInterval int, clock Clock, stop <-chan struct{}) goMetricaDataSource {
 	r := metrics.NewRegistry()
 
 	metrics.RegisterDebugGCStats(r)
-	go metrics.CaptureDebugGCStats(r, time.Duration(pollInterval)*time.Second)
+	go captureEvery(clock, time.Duration(pollInterval)*time.Second, stop, func() { metrics.CaptureDebugGCStatsOnce(r) })
 	return goMetricaDataSource{r}
 }
 
-func addGCMetricsToComponent(component nrpg.IComponent, pollInterval int) {
+// addGCMetricsToComponent adds GC metricas, statistic is captured until stop is closed
+func addGCMetricsToComponent(component iComponent, pollInterval int, clock Clock, stop <-chan struct{}) {
 	metrics := []*baseGoMetrica{
 		&baseGoMetrica{
 			name:          "NumberOfGCCalls",
@@ -28,7 +28,7 @@ func addGCMetricsToComponent(component nrpg.IComponent, pollInterval int) {
 		},
 	}
 
-	ds := newGCMetricaDataSource(pollInterval)
+	ds := newGCMetricaDataSource(pollInterval, clock, stop)
 	for _, m := range metrics {
 		m.basePath = "Runtime/GC/"
 		m.dataSource = ds
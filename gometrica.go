@@ -15,6 +15,13 @@ const (
 	noHistogramFunctions
 )
 
+const (
+	meterRate1 = iota
+	meterRate5
+	meterRate15
+	meterRateMean
+)
+
 type goMetricaDataSource struct {
 	metrics.Registry
 }
@@ -24,6 +31,16 @@ func (ds goMetricaDataSource) GetGaugeValue(key string) (float64, error) {
 		return 0, fmt.Errorf("metrica with name %s is not registered\n", key)
 	} else if gauge, ok := valueContainer.(metrics.Gauge); ok {
 		return float64(gauge.Value()), nil
+	} else if gauge, ok := valueContainer.(metrics.GaugeFloat64); ok {
+		return gauge.Value(), nil
+	} else if counter, ok := valueContainer.(metrics.Counter); ok {
+		return float64(counter.Count()), nil
+	} else if meter, ok := valueContainer.(metrics.Meter); ok {
+		return float64(meter.Count()), nil
+	} else if timer, ok := valueContainer.(metrics.Timer); ok {
+		return float64(timer.Count()), nil
+	} else if histogram, ok := valueContainer.(metrics.Histogram); ok {
+		return float64(histogram.Count()), nil
 	} else {
 		return 0, fmt.Errorf("metrica container has unexpected type: %T\n", valueContainer)
 	}
@@ -54,6 +71,27 @@ func (ds goMetricaDataSource) GetHistogramValue(key string, statFunction int, pe
 	}
 }
 
+func (ds goMetricaDataSource) GetMeterValue(key string, statFunction int) (float64, error) {
+	if valueContainer := ds.Get(key); valueContainer == nil {
+		return 0, fmt.Errorf("metrica with name %s is not registered\n", key)
+	} else if meter, ok := valueContainer.(metrics.Meter); ok {
+		switch statFunction {
+		default:
+			return 0, fmt.Errorf("unsupported stat function for meter: %d\n", statFunction)
+		case meterRate1:
+			return meter.Rate1(), nil
+		case meterRate5:
+			return meter.Rate5(), nil
+		case meterRate15:
+			return meter.Rate15(), nil
+		case meterRateMean:
+			return meter.RateMean(), nil
+		}
+	} else {
+		return 0, fmt.Errorf("metrica container has unexpected type: %T\n", valueContainer)
+	}
+}
+
 type baseGoMetrica struct {
 	dataSource    goMetricaDataSource
 	basePath      string
@@ -94,6 +132,9 @@ func (metrica *gaugeIncMetrica) GetValue() (float64, error) {
 	return value, err
 }
 
+// TypedMetrica interface implementation.
+func (metrica *gaugeIncMetrica) GetType() MetricType { return CountMetric }
+
 type histogramMetrica struct {
 	*baseGoMetrica
 	statFunction    int
@@ -103,3 +144,12 @@ type histogramMetrica struct {
 func (metrica *histogramMetrica) GetValue() (float64, error) {
 	return metrica.dataSource.GetHistogramValue(metrica.dataSourceKey, metrica.statFunction, metrica.percentileValue)
 }
+
+type meterMetrica struct {
+	*baseGoMetrica
+	statFunction int
+}
+
+func (metrica *meterMetrica) GetValue() (float64, error) {
+	return metrica.dataSource.GetMeterValue(metrica.dataSourceKey, metrica.statFunction)
+}
@@ -0,0 +1,131 @@
+package gorelictest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/earlonrails/gorelic"
+)
+
+// FakeClock is gorelic.Clock which time is changed with Advance only.
+// Timers and tickers fire when clock is advanced past their deadlines.
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is timer or ticker of FakeClock, period of timer is zero
+type fakeWaiter struct {
+	clock    *FakeClock
+	deadline time.Time
+	period   time.Duration
+	c        chan time.Time
+}
+
+// NewFakeClock creates FakeClock showing now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements gorelic.Clock interface
+func (clock *FakeClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return clock.now
+}
+
+// NewTimer implements gorelic.Clock interface
+func (clock *FakeClock) NewTimer(d time.Duration) gorelic.Timer {
+	return &fakeTimer{clock.add(d, 0)}
+}
+
+// NewTicker implements gorelic.Clock interface, it panics if d is not positive like time.NewTicker
+func (clock *FakeClock) NewTicker(d time.Duration) gorelic.Ticker {
+	if d <= 0 {
+		panic("gorelictest: non-positive interval for NewTicker")
+	}
+	return &fakeTicker{clock.add(d, d)}
+}
+
+// Advance moves clock forward by d firing timers and tickers which deadlines passed, earliest first.
+// Ticker fires once even if several periods passed, like time.Ticker with slow receiver.
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.now = clock.now.Add(d)
+	sort.SliceStable(clock.waiters, func(i, j int) bool {
+		return clock.waiters[i].deadline.Before(clock.waiters[j].deadline)
+	})
+	pending := clock.waiters[:0]
+	for _, waiter := range clock.waiters {
+		if waiter.deadline.After(clock.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		select {
+		case waiter.c <- waiter.deadline:
+		default:
+		}
+		if waiter.period > 0 {
+			for !waiter.deadline.After(clock.now) {
+				waiter.deadline = waiter.deadline.Add(waiter.period)
+			}
+			pending = append(pending, waiter)
+		}
+	}
+	clock.waiters = pending
+}
+
+// add registers waiter firing after d
+func (clock *FakeClock) add(d time.Duration, period time.Duration) *fakeWaiter {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	waiter := &fakeWaiter{clock: clock, deadline: clock.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	clock.waiters = append(clock.waiters, waiter)
+	return waiter
+}
+
+// remove unregisters waiter and tells if it was registered
+func (clock *FakeClock) remove(waiter *fakeWaiter) bool {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	for i, other := range clock.waiters {
+		if other == waiter {
+			clock.waiters = append(clock.waiters[:i], clock.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// nextTimer returns the earliest deadline of timers, tickers are not counted
+func (clock *FakeClock) nextTimer() (time.Time, bool) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	var next time.Time
+	found := false
+	for _, waiter := range clock.waiters {
+		if waiter.period == 0 && (!found || waiter.deadline.Before(next)) {
+			next, found = waiter.deadline, true
+		}
+	}
+	return next, found
+}
+
+type fakeTimer struct{ *fakeWaiter }
+
+// C implements gorelic.Timer interface
+func (timer *fakeTimer) C() <-chan time.Time { return timer.c }
+
+// Stop implements gorelic.Timer interface
+func (timer *fakeTimer) Stop() bool { return timer.clock.remove(timer.fakeWaiter) }
+
+type fakeTicker struct{ *fakeWaiter }
+
+// C implements gorelic.Ticker interface
+func (ticker *fakeTicker) C() <-chan time.Time { return ticker.c }
+
+// Stop implements gorelic.Ticker interface
+func (ticker *fakeTicker) Stop() { ticker.clock.remove(ticker.fakeWaiter) }
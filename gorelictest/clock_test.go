@@ -0,0 +1,80 @@
+package gorelictest
+
+import (
+	"time"
+
+	"github.com/earlonrails/gorelic"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FakeClock", func() {
+	var clock *FakeClock
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		clock = NewFakeClock(start)
+	})
+
+	It("should fire timers when advanced", func() {
+		timer := clock.NewTimer(time.Minute)
+		clock.Advance(59 * time.Second)
+		Expect(timer.C()).NotTo(Receive())
+		clock.Advance(time.Second)
+		Expect(timer.C()).To(Receive(Equal(start.Add(time.Minute))))
+		Expect(clock.Now()).To(Equal(start.Add(time.Minute)))
+		Expect(timer.Stop()).To(BeFalse())
+
+		stopped := clock.NewTimer(time.Second)
+		Expect(stopped.Stop()).To(BeTrue())
+		clock.Advance(time.Second)
+		Expect(stopped.C()).NotTo(Receive())
+	})
+
+	It("should fire tickers once per advance", func() {
+		ticker := clock.NewTicker(10 * time.Second)
+		clock.Advance(35 * time.Second)
+		Expect(ticker.C()).To(Receive(Equal(start.Add(10 * time.Second))))
+		Expect(ticker.C()).NotTo(Receive())
+		clock.Advance(5 * time.Second)
+		Expect(ticker.C()).To(Receive(Equal(start.Add(40 * time.Second))))
+
+		ticker.Stop()
+		clock.Advance(time.Minute)
+		Expect(ticker.C()).NotTo(Receive())
+	})
+})
+
+var _ = Describe("Agent clock", func() {
+	var t *recordingT
+
+	BeforeEach(func() {
+		t = &recordingT{}
+	})
+
+	It("should harvest when clock is advanced", func() {
+		agent := New(t, gorelic.WithPollInterval(time.Minute))
+		jobs := agent.Counter("jobs", "jobs")
+		jobs.Inc(30)
+
+		agent.Advance(59 * time.Second)
+		Expect(agent.Recorder.Harvests()).To(BeEmpty())
+		agent.Advance(time.Second)
+		Expect(agent.Recorder.Harvests()).To(HaveLen(1))
+		Expect(agent.AssertMetric("Custom/jobs/rate", 0.5)).To(BeTrue())
+
+		agent.Advance(3 * time.Minute)
+		harvests := agent.Recorder.Harvests()
+		Expect(harvests).To(HaveLen(4))
+		Expect(harvests[3].Time).To(Equal(agent.Clock.Now()))
+		Expect(harvests[3].Duration).To(Equal(time.Minute))
+		Expect(t.errors).To(BeEmpty())
+	})
+
+	It("should time traces with the clock", func() {
+		agent := New(t)
+		agent.Tracer.Trace("db", func() { agent.Clock.Advance(250 * time.Millisecond) })
+		agent.TriggerHarvest()
+		Expect(agent.FindMetric("Trace/db/max").Value).To(Equal(250.0))
+	})
+})
@@ -0,0 +1,229 @@
+// Package gorelictest helps to test instrumentation: it runs agent reporting to in-memory Recorder
+// and checks metrics of harvests triggered on demand, without network access.
+//
+//	agent := gorelictest.New(t, gorelic.WithHTTPStat(true))
+//	handler := agent.WrapHTTPHandlerFunc(users, "/users")
+//	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+//	agent.TriggerHarvest()
+//	agent.AssertMetric("http/requests", 1)
+//
+// Agent time is told by FakeClock, Advance moves it forward and waits for scheduled harvests:
+//
+//	jobs := agent.Counter("jobs", "jobs")
+//	jobs.Inc(30)
+//	agent.Advance(time.Minute)
+//	agent.AssertMetric("Custom/jobs/rate", 0.5)
+package gorelictest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earlonrails/gorelic"
+)
+
+// T is the part of *testing.T used by Agent, GinkgoT() implements it as well
+type T interface {
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Recorder is in-memory reporter capturing every harvest
+type Recorder struct {
+	lock     sync.Mutex
+	harvests []*gorelic.Harvest
+}
+
+// NewRecorder creates empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Report implements gorelic.MetricsReporter interface
+func (recorder *Recorder) Report(harvest *gorelic.Harvest) error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.harvests = append(recorder.harvests, harvest)
+	return nil
+}
+
+// Harvests returns all captured harvests, oldest first
+func (recorder *Recorder) Harvests() []*gorelic.Harvest {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return append([]*gorelic.Harvest(nil), recorder.harvests...)
+}
+
+// LastHarvest returns the latest captured harvest, nil if nothing is captured yet
+func (recorder *Recorder) LastHarvest() *gorelic.Harvest {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if len(recorder.harvests) == 0 {
+		return nil
+	}
+	return recorder.harvests[len(recorder.harvests)-1]
+}
+
+// Reset forgets captured harvests
+func (recorder *Recorder) Reset() {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.harvests = nil
+}
+
+// MetricNames returns sorted names of metrics of the last harvest
+func (recorder *Recorder) MetricNames() []string {
+	harvest := recorder.LastHarvest()
+	if harvest == nil {
+		return nil
+	}
+	names := make([]string, 0, len(harvest.Metrics))
+	for _, metric := range harvest.Metrics {
+		names = append(names, metric.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FindMetric returns metric of the last harvest with exactly this name or, if there is none,
+// the first one starting with prefix. It returns nil if nothing matches.
+func (recorder *Recorder) FindMetric(prefix string) *gorelic.Metric {
+	harvest := recorder.LastHarvest()
+	if harvest == nil {
+		return nil
+	}
+	var found *gorelic.Metric
+	for i := range harvest.Metrics {
+		metric := &harvest.Metrics[i]
+		if metric.Name == prefix {
+			return metric
+		}
+		if found == nil && strings.HasPrefix(metric.Name, prefix) {
+			found = metric
+		}
+	}
+	return found
+}
+
+// waitTimeout limits waiting for harvest goroutine
+const waitTimeout = 5 * time.Second
+
+// Agent is running gorelic.Agent reporting to Recorder, its time is told by Clock
+type Agent struct {
+	*gorelic.Agent
+	Recorder *Recorder
+	Clock    *FakeClock
+	t        T
+}
+
+// New creates and runs agent configured with options, its only reporter is Recorder.
+// Agent uses FakeClock starting at 2020-01-01 00:00:00 UTC, so harvests happen only when it is advanced.
+// GC and memory allocator metrics are disabled unless enabled by options.
+// Agent is stopped when test finishes if t has Cleanup method like *testing.T, otherwise call Stop.
+// Test fails immediately if agent can not be created or started.
+func New(t T, opts ...gorelic.Option) *Agent {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	recorder := NewRecorder()
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	// GC and memory collectors share go-metrics globals, so they are enabled only if asked by options.
+	defaults := []gorelic.Option{gorelic.WithClock(clock), gorelic.WithGCStat(false, 0), gorelic.WithMemoryStat(false, 0)}
+	opts = append(defaults, opts...)
+	agent, err := gorelic.New(append(opts, gorelic.WithReporter(recorder))...)
+	if err != nil {
+		t.Fatalf("gorelictest: can not create agent: %v", err)
+		return nil
+	}
+	if err := agent.Run(); err != nil {
+		t.Fatalf("gorelictest: can not run agent: %v", err)
+		return nil
+	}
+	if c, ok := t.(interface{ Cleanup(func()) }); ok {
+		c.Cleanup(agent.Stop)
+	}
+	if !waitFor(func() bool { _, ok := clock.nextTimer(); return ok }) {
+		t.Fatalf("gorelictest: harvest loop is not started")
+		return nil
+	}
+	return &Agent{Agent: agent, Recorder: recorder, Clock: clock, t: t}
+}
+
+// Advance moves Clock forward by d. Harvests scheduled in this period happen before it returns,
+// so their metrics are captured by Recorder and rates are calculated for exact intervals.
+func (agent *Agent) Advance(d time.Duration) {
+	if h, ok := agent.t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	deadline := agent.Clock.Now().Add(d)
+	for {
+		next, ok := agent.Clock.nextTimer()
+		if !ok || next.After(deadline) {
+			break
+		}
+		harvests := agent.Stats().Harvests
+		agent.Clock.Advance(next.Sub(agent.Clock.Now()))
+		// Harvest is done when harvest loop waits for the next one.
+		done := waitFor(func() bool {
+			_, ok := agent.Clock.nextTimer()
+			return ok && agent.Stats().Harvests > harvests
+		})
+		if !done {
+			agent.t.Fatalf("gorelictest: harvest scheduled at %v did not happen", next)
+			return
+		}
+	}
+	agent.Clock.Advance(deadline.Sub(agent.Clock.Now()))
+}
+
+// TriggerHarvest harvests metrics now and returns captured harvest
+func (agent *Agent) TriggerHarvest() *gorelic.Harvest {
+	agent.HarvestNow()
+	return agent.Recorder.LastHarvest()
+}
+
+// waitFor checks condition until it is true or waitTimeout passes
+func waitFor(condition func() bool) bool {
+	for start := time.Now(); time.Since(start) < waitTimeout; time.Sleep(time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
+
+// MetricNames returns sorted names of metrics of the last harvest
+func (agent *Agent) MetricNames() []string {
+	return agent.Recorder.MetricNames()
+}
+
+// FindMetric returns metric of the last harvest with this name or prefix, see Recorder.FindMetric
+func (agent *Agent) FindMetric(prefix string) *gorelic.Metric {
+	return agent.Recorder.FindMetric(prefix)
+}
+
+// AssertMetric checks that the last harvest has metric with this name and value.
+// Test is marked as failed otherwise, result tells if assertion succeeded.
+func (agent *Agent) AssertMetric(name string, value float64) bool {
+	if h, ok := agent.t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	harvest := agent.Recorder.LastHarvest()
+	if harvest == nil {
+		agent.t.Errorf("gorelictest: metric %q: no harvest captured, call TriggerHarvest first", name)
+		return false
+	}
+	for _, metric := range harvest.Metrics {
+		if metric.Name == name {
+			if metric.Value != value {
+				agent.t.Errorf("gorelictest: metric %q: expected %v, got %v", name, value, metric.Value)
+				return false
+			}
+			return true
+		}
+	}
+	agent.t.Errorf("gorelictest: metric %q not found, harvested metrics:\n\t%s", name, strings.Join(agent.MetricNames(), "\n\t"))
+	return false
+}
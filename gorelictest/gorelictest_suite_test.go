@@ -0,0 +1,13 @@
+package gorelictest
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestGorelictest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Gorelictest Suite")
+}
@@ -0,0 +1,100 @@
+package gorelictest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/earlonrails/gorelic"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recordingT records failures and cleanups instead of failing the spec
+type recordingT struct {
+	errors   []string
+	fatal    bool
+	cleanups []func()
+}
+
+func (t *recordingT) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.fatal = true
+}
+
+var _ = Describe("Agent", func() {
+	var t *recordingT
+
+	BeforeEach(func() {
+		t = &recordingT{}
+	})
+
+	AfterEach(func() {
+		for _, cleanup := range t.cleanups {
+			cleanup()
+		}
+	})
+
+	It("should capture triggered harvests", func() {
+		agent := New(t, gorelic.WithHTTPStat(true))
+		handler := agent.WrapHTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {}, "/users")
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+		agent.Tracer.Trace("db", func() {})
+
+		harvest := agent.TriggerHarvest()
+		Expect(harvest).NotTo(BeNil())
+		Expect(agent.Recorder.Harvests()).To(Equal([]*gorelic.Harvest{harvest}))
+		Expect(agent.AssertMetric("http/requests", 1)).To(BeTrue())
+		Expect(agent.MetricNames()).To(ContainElement("http/responseTime/max"))
+		Expect(agent.FindMetric("Trace/").Labels).To(HaveKeyWithValue("trace", "db"))
+		Expect(t.errors).To(BeEmpty())
+
+		agent.Recorder.Reset()
+		Expect(agent.Recorder.LastHarvest()).To(BeNil())
+	})
+
+	It("should stop agent on cleanup", func() {
+		agent := New(t)
+		Expect(t.cleanups).To(HaveLen(1))
+		t.cleanups[0]()
+		Expect(agent.Stats().Running).To(BeFalse())
+		_, scheduled := agent.Clock.nextTimer()
+		Expect(scheduled).To(BeFalse())
+	})
+
+	It("should find metric by name before prefix", func() {
+		agent := New(t)
+		agent.Gauge("Custom/queue/size", "items").Update(3)
+		agent.Gauge("Custom/queue", "items").Update(5)
+		agent.TriggerHarvest()
+		Expect(agent.FindMetric("Custom/queue").Value).To(Equal(5.0))
+		Expect(agent.FindMetric("Custom/queue/").Value).To(Equal(3.0))
+		Expect(agent.FindMetric("Custom/missing")).To(BeNil())
+	})
+
+	It("should fail assertions", func() {
+		agent := New(t)
+		Expect(agent.AssertMetric("Custom/queue", 1)).To(BeFalse())
+		Expect(t.errors[0]).To(ContainSubstring("no harvest captured"))
+
+		agent.Gauge("Custom/queue", "items").Update(5)
+		agent.TriggerHarvest()
+		Expect(agent.AssertMetric("Custom/queue", 1)).To(BeFalse())
+		Expect(t.errors[1]).To(Equal(`gorelictest: metric "Custom/queue": expected 1, got 5`))
+		Expect(agent.AssertMetric("Custom/missing", 1)).To(BeFalse())
+		Expect(t.errors[2]).To(ContainSubstring("Custom/queue"))
+	})
+
+	It("should stop test if agent is invalid", func() {
+		Expect(New(t, gorelic.WithName(""))).To(BeNil())
+		Expect(t.fatal).To(BeTrue())
+	})
+})
@@ -0,0 +1,306 @@
+package gorelic
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+// Metric is a value of single metrica taken during harvest.
+type Metric struct {
+	// Name is flattened metric path, all labels are encoded in it
+	Name  string
+	Units string
+	Value float64
+	// BaseName is metric path without label values, Labels are per-metric dimensions.
+	// BaseName is equal to Name for metrics without labels.
+	BaseName string
+	Labels   map[string]string
+	// Type tells dimensional backends how to aggregate value, Summary is set for summary metrics only.
+	Type    MetricType
+	Summary *MetricSummary
+	// dimensional metrics are not sent to NewRelic platform, their flattened names would only add to its metric count
+	dimensional bool
+}
+
+// MetricType describes how metric value is aggregated
+type MetricType string
+
+const (
+	// GaugeMetric is a value at the moment of harvest
+	GaugeMetric MetricType = "gauge"
+	// CountMetric is a number of events since previous harvest
+	CountMetric MetricType = "count"
+	// SummaryMetric is a distribution of values recorded since previous harvest
+	SummaryMetric MetricType = "summary"
+)
+
+// MetricSummary describes distribution of values recorded since previous harvest
+type MetricSummary struct {
+	Count float64
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+// Harvest is a snapshot of all metrics taken once in NewrelicPollInterval.
+type Harvest struct {
+	Time time.Time
+	// Duration is time passed since previous harvest
+	Duration time.Duration
+	Metrics  []Metric
+	// Events are recorded with Agent.RecordEvent since previous harvest
+	Events []Event
+	// Metadata describes reporting process: agent, build and runtime info.
+	// Reporters supporting labels/attributes should attach it to metrics.
+	Metadata map[string]string
+	// Labels are global dimensions of all metrics, like host or region.
+	Labels map[string]string
+}
+
+// MetricLabels returns global labels merged with labels of metric. Metric labels take precedence.
+func (harvest *Harvest) MetricLabels(metric Metric) map[string]string {
+	labels := make(map[string]string, len(harvest.Labels)+len(metric.Labels))
+	for key, value := range harvest.Labels {
+		labels[key] = value
+	}
+	for key, value := range metric.Labels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// MetricsReporter sends harvested metrics to monitoring system.
+// Each harvest is passed to all reporters, so Report should not modify it.
+type MetricsReporter interface {
+	Report(harvest *Harvest) error
+}
+
+// LabeledMetrica is implemented by metricas which have structured form of their flattened name.
+// NewRelic platform reporter uses flattened name, dimensional reporters use base name and labels.
+type LabeledMetrica interface {
+	nrpg.IMetrica
+	GetLabels() (baseName string, labels map[string]string)
+}
+
+// TypedMetrica is implemented by metricas which are not gauges
+type TypedMetrica interface {
+	nrpg.IMetrica
+	GetType() MetricType
+}
+
+// SummaryMetrica is implemented by metricas of SummaryMetric type.
+// Flattened reporters, like NewRelic platform one, skip summaries.
+type SummaryMetrica interface {
+	TypedMetrica
+	GetSummary() (MetricSummary, error)
+}
+
+// dimensionalMetrica is implemented by metricas reported by dimensional reporters only
+type dimensionalMetrica interface {
+	dimensionalOnly() bool
+}
+
+// iComponent is the part of nrpg.IComponent used by collectors.
+// Metricas are added to it, sent data is cleared after each harvest.
+type iComponent interface {
+	AddMetrica(model nrpg.IMetrica)
+	ClearSentData()
+}
+
+// iMetricaSource provides metricas which could change between harvests
+type iMetricaSource interface {
+	Metricas() []nrpg.IMetrica
+}
+
+// metricaRegistry keeps all metricas reported by agent.
+// Metricas could be added at any time, for example by Tracer.
+type metricaRegistry struct {
+	sync.Mutex
+	metricas []nrpg.IMetrica
+	sources  []iMetricaSource
+}
+
+func newMetricaRegistry() *metricaRegistry {
+	return &metricaRegistry{metricas: make([]nrpg.IMetrica, 0)}
+}
+
+// iComponent interface implementation
+func (registry *metricaRegistry) AddMetrica(model nrpg.IMetrica) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.metricas = append(registry.metricas, model)
+}
+
+// addSource adds source, metricas of which are taken on every harvest
+func (registry *metricaRegistry) addSource(source iMetricaSource) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.sources = append(registry.sources, source)
+}
+
+// allMetricas returns added metricas followed by metricas of all sources
+func (registry *metricaRegistry) allMetricas() []nrpg.IMetrica {
+	registry.Lock()
+	metricas := registry.metricas[:len(registry.metricas):len(registry.metricas)]
+	sources := registry.sources[:len(registry.sources):len(registry.sources)]
+	registry.Unlock()
+
+	for _, source := range sources {
+		metricas = append(metricas, source.Metricas()...)
+	}
+	return metricas
+}
+
+// resettableMetrica is implemented by metricas which report values accumulated since previous harvest
+type resettableMetrica interface {
+	ClearSentData()
+}
+
+// iComponent interface implementation. Resettable metricas are cleared after every harvest.
+// Metricas of sources are created on every harvest, so they are not cleared.
+func (registry *metricaRegistry) ClearSentData() {
+	registry.Lock()
+	metricas := registry.metricas[:len(registry.metricas):len(registry.metricas)]
+	registry.Unlock()
+
+	for _, metrica := range metricas {
+		if resettable, ok := metrica.(resettableMetrica); ok {
+			resettable.ClearSentData()
+		}
+	}
+}
+
+// metricaError is returned by collect for metrica which value could not be taken
+type metricaError struct {
+	name string
+	err  error
+}
+
+func (e *metricaError) Error() string {
+	return fmt.Sprintf("can not get metrica %s: %v", e.name, e.err)
+}
+
+// collect gets value of every metrica. Metricas which failed are skipped and their errors are returned.
+func (registry *metricaRegistry) collect() ([]Metric, []error) {
+	metricas := registry.allMetricas()
+	values := make([]Metric, 0, len(metricas))
+	var errs []error
+	for _, metrica := range metricas {
+		value, err := metrica.GetValue()
+		if err != nil {
+			errs = append(errs, &metricaError{metrica.GetName(), err})
+			continue
+		}
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			value = 0
+		}
+		metric := Metric{Name: metrica.GetName(), Units: metrica.GetUnits(), Value: value, Type: GaugeMetric}
+		metric.BaseName = metric.Name
+		if labeled, ok := metrica.(LabeledMetrica); ok {
+			metric.BaseName, metric.Labels = labeled.GetLabels()
+		}
+		if typed, ok := metrica.(TypedMetrica); ok {
+			metric.Type = typed.GetType()
+		}
+		if dimensional, ok := metrica.(dimensionalMetrica); ok {
+			metric.dimensional = dimensional.dimensionalOnly()
+		}
+		if summary, ok := metrica.(SummaryMetrica); ok && metric.Type == SummaryMetric {
+			summaryValues, err := summary.GetSummary()
+			if err != nil {
+				errs = append(errs, &metricaError{metrica.GetName(), fmt.Errorf("can not get summary: %v", err)})
+				continue
+			}
+			metric.Summary = &summaryValues
+		}
+		values = append(values, metric)
+	}
+	return values, errs
+}
+
+// logMetricaErrors warns about metrica which value can not be taken once, errors of following harvests
+// are logged at debug level while it keeps failing. It is called under harvestLock.
+func (agent *Agent) logMetricaErrors(errs []error) {
+	failing := make(map[string]bool, len(errs))
+	for _, err := range errs {
+		metricaErr, ok := err.(*metricaError)
+		if !ok {
+			agent.logger().Warn("Can not get metric value.", "error", err)
+			continue
+		}
+		if agent.failingMetricas[metricaErr.name] {
+			agent.logger().Debug("Can not get metric value.", "metric", metricaErr.name, "error", metricaErr.err)
+		} else {
+			agent.logger().Warn("Can not get metric value.", "metric", metricaErr.name, "error", metricaErr.err)
+		}
+		failing[metricaErr.name] = true
+	}
+	agent.failingMetricas = failing
+}
+
+// HarvestNow collects all metrics and passes them to reporters without waiting for poll interval,
+// next harvest happens as scheduled. It is useful in tests and before shutdown.
+func (agent *Agent) HarvestNow() {
+	agent.harvest()
+}
+
+// harvest collects all metrics and passes them to reporters
+func (agent *Agent) harvest() {
+	agent.harvestLock.Lock()
+	defer agent.harvestLock.Unlock()
+
+	config := agent.runConfig()
+	clock := agent.clock()
+	startTime := clock.Now()
+	duration := config.pollInterval
+	if !agent.lastHarvest.IsZero() {
+		duration = startTime.Sub(agent.lastHarvest)
+	}
+
+	events := agent.events.swap()
+	values, errs := agent.registry.collect()
+	agent.logMetricaErrors(errs)
+	harvest := &Harvest{
+		Time:     startTime,
+		Duration: duration,
+		Metrics:  values,
+		Events:   events,
+		Metadata: config.metadata,
+		Labels:   config.labels,
+	}
+	agent.stats.setRegistered(agent.registeredHTTPPaths(), agent.Tracer.count())
+	for i, reporter := range config.reporters {
+		attemptTime := clock.Now()
+		err := reporter.Report(harvest)
+		if err != nil {
+			agent.logger().Error("Can not report metrics.", "reporter", reporterName(reporter, i, config.reporters), "error", err)
+		}
+		agent.stats.recordReport(i, config.reporters, attemptTime, err)
+	}
+	agent.stats.recordHarvest(startTime, clock.Now().Sub(startTime), values, errs)
+
+	agent.component.ClearSentData()
+	agent.lastHarvest = startTime
+}
+
+// harvestLoop harvests metrics once in NewrelicPollInterval until agent is stopped.
+// Interval changed by Reconfigure is applied immediately.
+func (agent *Agent) harvestLoop() {
+	defer close(agent.harvestLoopDone)
+	for {
+		timer := agent.clock().NewTimer(agent.runConfig().pollInterval)
+		select {
+		case <-timer.C():
+			agent.harvest()
+		case <-agent.pollIntervalChanged:
+			timer.Stop()
+		case <-agent.stopped:
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package gorelic
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSysRoot - where sys filesystem is mounted
+	DefaultSysRoot = "/sys"
+
+	// diskstats reports sizes in 512 bytes sectors regardless of device sector size
+	diskSectorSize = 512
+
+	// host data is read once per harvest, so network and disk counters are sampled every harvest
+	hostQueryInterval = 1
+)
+
+// DefaultHostMountPoints - filesystems usage of which is reported by host collector
+var DefaultHostMountPoints = []string{"/"}
+
+// host data source fabrica
+func newHostMetricaDataSource(procRoot string, sysRoot string, mountPoints []string, now func() time.Time) iSystemMetricaDataSource {
+	var ds iSystemMetricaDataSource
+	switch runtime.GOOS {
+	default:
+		ds = &systemMetricaDataSource{}
+	case "linux":
+		ds = newLinuxHostMetricaDataSource(procRoot, sysRoot, mountPoints, time.Second*hostQueryInterval, now)
+	}
+	return ds
+}
+
+// Linux implementation of host level iSystemMetricaDataSource
+type linuxHostMetricaDataSource struct {
+	procRoot      string
+	sysRoot       string
+	mountPoints   []string
+	queryInterval time.Duration
+	now           func() time.Time
+	lastUpdate    time.Time
+	hostData      map[string]float64
+}
+
+func newLinuxHostMetricaDataSource(procRoot string, sysRoot string, mountPoints []string, queryInterval time.Duration, now func() time.Time) *linuxHostMetricaDataSource {
+	return &linuxHostMetricaDataSource{
+		procRoot:      procRoot,
+		sysRoot:       sysRoot,
+		mountPoints:   mountPoints,
+		queryInterval: queryInterval,
+		now:           now,
+		hostData:      make(map[string]float64),
+	}
+}
+
+func (ds *linuxHostMetricaDataSource) GetValue(key string) (float64, error) {
+	if err := ds.checkAndUpdateData(); err != nil {
+		return 0, err
+	} else if val, ok := ds.hostData[key]; !ok {
+		return 0, fmt.Errorf("host data with key %s was not found", key)
+	} else {
+		return val, nil
+	}
+}
+
+func (ds *linuxHostMetricaDataSource) checkAndUpdateData() error {
+	startTime := ds.now()
+	if startTime.Sub(ds.lastUpdate) > ds.queryInterval {
+		hostData := make(map[string]float64)
+		if err := ds.readLoadAvg(hostData); err != nil {
+			return err
+		}
+		if err := ds.readMemInfo(hostData); err != nil {
+			return err
+		}
+		if err := ds.readNetDev(hostData); err != nil {
+			return err
+		}
+		if err := ds.readDiskStats(hostData); err != nil {
+			return err
+		}
+		for _, mountPoint := range ds.mountPoints {
+			readFilesystemUsage(mountPoint, hostData)
+		}
+		ds.hostData = hostData
+		ds.lastUpdate = startTime
+	}
+	return nil
+}
+
+// /proc/loadavg looks like "0.07 0.14 0.08 2/71 6130"
+func (ds *linuxHostMetricaDataSource) readLoadAvg(hostData map[string]float64) error {
+	raw, err := ioutil.ReadFile(filepath.Join(ds.procRoot, "loadavg"))
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) < 3 {
+		return fmt.Errorf("invalid format of loadavg: %q", raw)
+	}
+	for i, key := range []string{"load.1", "load.5", "load.15"} {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %v", key, err)
+		}
+		hostData[key] = v
+	}
+	return nil
+}
+
+// /proc/meminfo has "Key:   value kB" format. MemAvailable is not reported by kernels older than 3.14,
+// so it is estimated from free memory and page cache there.
+func (ds *linuxHostMetricaDataSource) readMemInfo(hostData map[string]float64) error {
+	raw, err := ioutil.ReadFile(filepath.Join(ds.procRoot, "meminfo"))
+	if err != nil {
+		return err
+	}
+	memInfo := parseProcStatus(raw)
+	values := make(map[string]float64)
+	for _, key := range []string{"MemTotal", "MemFree", "MemAvailable", "Buffers", "Cached", "SwapTotal", "SwapFree"} {
+		val, ok := memInfo[key]
+		if !ok {
+			continue
+		}
+		v, err := parseProcStatusValue(key, val)
+		if err != nil {
+			return err
+		}
+		values[key] = v
+	}
+
+	if _, ok := values["MemAvailable"]; !ok {
+		values["MemAvailable"] = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	hostData["memory.total"] = values["MemTotal"]
+	hostData["memory.available"] = values["MemAvailable"]
+	hostData["swap.total"] = values["SwapTotal"]
+	hostData["swap.free"] = values["SwapFree"]
+	return nil
+}
+
+// /proc/net/dev has 2 header lines followed by "iface: rx fields... tx fields..."
+func (ds *linuxHostMetricaDataSource) readNetDev(hostData map[string]float64) error {
+	raw, err := ioutil.ReadFile(filepath.Join(ds.procRoot, "net/dev"))
+	if err != nil {
+		return err
+	}
+	for iface, fields := range parseNetDev(raw) {
+		if len(fields) < 16 {
+			return fmt.Errorf("invalid format of net/dev for %s", iface)
+		}
+		for key, index := range map[string]int{
+			"rxBytes":   0,
+			"rxPackets": 1,
+			"rxErrors":  2,
+			"txBytes":   8,
+			"txPackets": 9,
+			"txErrors":  10,
+		} {
+			v, err := strconv.ParseFloat(fields[index], 64)
+			if err != nil {
+				return fmt.Errorf("invalid value of %s for %s: %v", key, iface, err)
+			}
+			hostData["net."+iface+"."+key] = v
+		}
+	}
+	return nil
+}
+
+// /proc/diskstats: "major minor name reads merged sectors ms writes merged sectors ms inProgress ioMs weightedMs ..."
+func (ds *linuxHostMetricaDataSource) readDiskStats(hostData map[string]float64) error {
+	raw, err := ioutil.ReadFile(filepath.Join(ds.procRoot, "diskstats"))
+	if err != nil {
+		return err
+	}
+	for device, fields := range parseDiskStats(raw) {
+		if !ds.isDisk(device) {
+			continue
+		}
+		if len(fields) < 10 {
+			return fmt.Errorf("invalid format of diskstats for %s", device)
+		}
+		for key, index := range map[string]int{
+			"reads":        0,
+			"readSectors":  2,
+			"writes":       4,
+			"writeSectors": 6,
+			"ioTime":       9,
+		} {
+			v, err := strconv.ParseFloat(fields[index], 64)
+			if err != nil {
+				return fmt.Errorf("invalid value of %s for %s: %v", key, device, err)
+			}
+			hostData["disk."+device+"."+key] = v
+		}
+		hostData["disk."+device+".readBytes"] = hostData["disk."+device+".readSectors"] * diskSectorSize
+		hostData["disk."+device+".writeBytes"] = hostData["disk."+device+".writeSectors"] * diskSectorSize
+	}
+	return nil
+}
+
+// isDisk filters out partitions and virtual loop/ram devices. Only whole disks are listed in /sys/block.
+func (ds *linuxHostMetricaDataSource) isDisk(device string) bool {
+	if strings.HasPrefix(device, "loop") || strings.HasPrefix(device, "ram") {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(ds.sysRoot, "block", device))
+	return err == nil
+}
+
+// interfaces returns network interfaces except loopback
+func (ds *linuxHostMetricaDataSource) interfaces() []string {
+	raw, err := ioutil.ReadFile(filepath.Join(ds.procRoot, "net/dev"))
+	if err != nil {
+		return nil
+	}
+	var interfaces []string
+	for iface := range parseNetDev(raw) {
+		if iface != "lo" {
+			interfaces = append(interfaces, iface)
+		}
+	}
+	return interfaces
+}
+
+// disks returns block devices reported by /proc/diskstats
+func (ds *linuxHostMetricaDataSource) disks() []string {
+	raw, err := ioutil.ReadFile(filepath.Join(ds.procRoot, "diskstats"))
+	if err != nil {
+		return nil
+	}
+	var disks []string
+	for device := range parseDiskStats(raw) {
+		if ds.isDisk(device) {
+			disks = append(disks, device)
+		}
+	}
+	return disks
+}
+
+func parseNetDev(raw []byte) map[string][]string {
+	stats := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		stats[strings.TrimSpace(parts[0])] = strings.Fields(parts[1])
+	}
+	return stats
+}
+
+func parseDiskStats(raw []byte) map[string][]string {
+	stats := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		stats[fields[2]] = fields[3:]
+	}
+	return stats
+}
+
+// mountPointName converts mount point to metric name part: "/" -> "root", "/var/lib" -> "var/lib"
+func mountPointName(mountPoint string) string {
+	if name := strings.Trim(mountPoint, "/"); name != "" {
+		return name
+	}
+	return "root"
+}
+
+func addHostMetricsToComponent(component iComponent, procRoot string, sysRoot string, mountPoints []string, now func() time.Time) {
+	ds := newHostMetricaDataSource(procRoot, sysRoot, mountPoints, now)
+	metrics := []*systemMetrica{
+		&systemMetrica{
+			sourceKey:    "load.1",
+			units:        "load",
+			newrelicName: "Host/Load/Avg1",
+		},
+		&systemMetrica{
+			sourceKey:    "load.5",
+			units:        "load",
+			newrelicName: "Host/Load/Avg5",
+		},
+		&systemMetrica{
+			sourceKey:    "load.15",
+			units:        "load",
+			newrelicName: "Host/Load/Avg15",
+		},
+		&systemMetrica{
+			sourceKey:    "memory.total",
+			units:        "bytes",
+			newrelicName: "Host/Memory/Total",
+		},
+		&systemMetrica{
+			sourceKey:    "memory.available",
+			units:        "bytes",
+			newrelicName: "Host/Memory/Available",
+		},
+		&systemMetrica{
+			sourceKey:    "swap.total",
+			units:        "bytes",
+			newrelicName: "Host/Memory/Swap/Total",
+		},
+		&systemMetrica{
+			sourceKey:    "swap.free",
+			units:        "bytes",
+			newrelicName: "Host/Memory/Swap/Free",
+		},
+	}
+
+	// Devices are discovered once, on start
+	if linuxDs, ok := ds.(*linuxHostMetricaDataSource); ok {
+		for _, iface := range linuxDs.interfaces() {
+			metrics = append(metrics, hostNetworkMetrics(iface)...)
+		}
+		for _, disk := range linuxDs.disks() {
+			metrics = append(metrics, hostDiskMetrics(disk)...)
+		}
+	}
+	for _, mountPoint := range mountPoints {
+		metrics = append(metrics, hostFilesystemMetrics(mountPoint)...)
+	}
+
+	for _, m := range metrics {
+		m.dataSource = ds
+		component.AddMetrica(m)
+	}
+}
+
+func hostNetworkMetrics(iface string) []*systemMetrica {
+	metrics := []*systemMetrica{
+		&systemMetrica{sourceKey: "rxBytes", units: "bytes", newrelicName: "ReceivedBytes"},
+		&systemMetrica{sourceKey: "txBytes", units: "bytes", newrelicName: "TransmittedBytes"},
+		&systemMetrica{sourceKey: "rxPackets", units: "packets", newrelicName: "ReceivedPackets"},
+		&systemMetrica{sourceKey: "txPackets", units: "packets", newrelicName: "TransmittedPackets"},
+		&systemMetrica{sourceKey: "rxErrors", units: "errors", newrelicName: "ReceiveErrors"},
+		&systemMetrica{sourceKey: "txErrors", units: "errors", newrelicName: "TransmitErrors"},
+	}
+	for _, m := range metrics {
+		m.sourceKey = "net." + iface + "." + m.sourceKey
+		m.newrelicName = "Host/Network/" + iface + "/" + m.newrelicName
+		m.incremental = true
+	}
+	return metrics
+}
+
+func hostDiskMetrics(disk string) []*systemMetrica {
+	metrics := []*systemMetrica{
+		&systemMetrica{sourceKey: "reads", units: "operations", newrelicName: "Reads"},
+		&systemMetrica{sourceKey: "writes", units: "operations", newrelicName: "Writes"},
+		&systemMetrica{sourceKey: "readBytes", units: "bytes", newrelicName: "ReadBytes"},
+		&systemMetrica{sourceKey: "writeBytes", units: "bytes", newrelicName: "WrittenBytes"},
+		&systemMetrica{sourceKey: "ioTime", units: "ms", newrelicName: "IOTime"},
+	}
+	for _, m := range metrics {
+		m.sourceKey = "disk." + disk + "." + m.sourceKey
+		m.newrelicName = "Host/Disk/" + disk + "/" + m.newrelicName
+		m.incremental = true
+	}
+	return metrics
+}
+
+func hostFilesystemMetrics(mountPoint string) []*systemMetrica {
+	metrics := []*systemMetrica{
+		&systemMetrica{sourceKey: "total", units: "bytes", newrelicName: "Total"},
+		&systemMetrica{sourceKey: "used", units: "bytes", newrelicName: "Used"},
+		&systemMetrica{sourceKey: "available", units: "bytes", newrelicName: "Available"},
+		&systemMetrica{sourceKey: "usedPercent", units: "percent", newrelicName: "UsedPercent"},
+	}
+	for _, m := range metrics {
+		m.sourceKey = "fs." + mountPoint + "." + m.sourceKey
+		m.newrelicName = "Host/Filesystem/" + mountPointName(mountPoint) + "/" + m.newrelicName
+	}
+	return metrics
+}
@@ -0,0 +1,118 @@
+package gorelic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Host metrics", func() {
+	var ds *linuxHostMetricaDataSource
+
+	BeforeEach(func() {
+		ds = newLinuxHostMetricaDataSource("testdata/host/proc", "testdata/host/sys", nil, time.Minute, time.Now)
+	})
+
+	It("should report load average", func() {
+		Expect(ds.GetValue("load.1")).To(Equal(1.5))
+		Expect(ds.GetValue("load.5")).To(Equal(0.75))
+		Expect(ds.GetValue("load.15")).To(Equal(0.25))
+	})
+
+	It("should report memory and swap", func() {
+		Expect(ds.GetValue("memory.total")).To(Equal(8000000.0 * 1024))
+		Expect(ds.GetValue("memory.available")).To(Equal(5000000.0 * 1024))
+		Expect(ds.GetValue("swap.total")).To(Equal(2000000.0 * 1024))
+		Expect(ds.GetValue("swap.free")).To(Equal(1500000.0 * 1024))
+	})
+
+	It("should estimate available memory on old kernels", func() {
+		root, err := ioutil.TempDir("", "gorelic-host")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(root)
+		writeFixtures(root, map[string]string{
+			"loadavg":   "0.00 0.00 0.00 1/10 1\n",
+			"meminfo":   "MemTotal: 1000 kB\nMemFree: 100 kB\nBuffers: 20 kB\nCached: 300 kB\n",
+			"net/dev":   "",
+			"diskstats": "",
+		})
+		ds = newLinuxHostMetricaDataSource(root, root, nil, time.Minute, time.Now)
+		Expect(ds.GetValue("memory.available")).To(Equal(420.0 * 1024))
+	})
+
+	It("should report network interfaces", func() {
+		Expect(ds.interfaces()).To(Equal([]string{"eth0"}))
+		Expect(ds.GetValue("net.eth0.rxBytes")).To(Equal(13627370.0))
+		Expect(ds.GetValue("net.eth0.rxPackets")).To(Equal(954.0))
+		Expect(ds.GetValue("net.eth0.rxErrors")).To(Equal(2.0))
+		Expect(ds.GetValue("net.eth0.txBytes")).To(Equal(130660.0))
+		Expect(ds.GetValue("net.eth0.txPackets")).To(Equal(1272.0))
+		Expect(ds.GetValue("net.eth0.txErrors")).To(Equal(1.0))
+	})
+
+	It("should report network counters increase of every harvest", func() {
+		root, err := ioutil.TempDir("", "gorelic-host")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(root)
+		netDev := func(rxBytes int) string {
+			return fmt.Sprintf("Inter-|\n face |\n  eth0: %d 1 0 0 0 0 0 0 100 1 0 0 0 0 0 0\n", rxBytes)
+		}
+		writeFixtures(root, map[string]string{
+			"loadavg":   "0.00 0.00 0.00 1/10 1\n",
+			"meminfo":   "MemTotal: 1000 kB\nMemAvailable: 100 kB\n",
+			"net/dev":   netDev(1000),
+			"diskstats": "",
+		})
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		ds = newLinuxHostMetricaDataSource(root, root, nil, time.Second*hostQueryInterval, func() time.Time { return now })
+		received := hostNetworkMetrics("eth0")[0]
+		received.dataSource = ds
+		Expect(received.GetValue()).To(Equal(0.0))
+
+		writeFixtures(root, map[string]string{"net/dev": netDev(1500)})
+		now = now.Add(time.Minute)
+		Expect(received.GetValue()).To(Equal(500.0))
+		writeFixtures(root, map[string]string{"net/dev": netDev(2500)})
+		now = now.Add(time.Minute)
+		Expect(received.GetValue()).To(Equal(1000.0))
+	})
+
+	It("should report whole disks only", func() {
+		disks := ds.disks()
+		sort.Strings(disks)
+		Expect(disks).To(Equal([]string{"nvme0n1", "sda"}))
+		Expect(ds.GetValue("disk.sda.reads")).To(Equal(1200.0))
+		Expect(ds.GetValue("disk.sda.writes")).To(Equal(800.0))
+		Expect(ds.GetValue("disk.sda.readBytes")).To(Equal(96000.0 * 512))
+		Expect(ds.GetValue("disk.sda.writeBytes")).To(Equal(64000.0 * 512))
+		Expect(ds.GetValue("disk.sda.ioTime")).To(Equal(1300.0))
+		_, err := ds.GetValue("disk.sda1.reads")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should report filesystem usage of configured mount points", func() {
+		if runtime.GOOS != "linux" {
+			Skip("filesystem usage is collected on Linux only")
+		}
+		mountPoint, err := filepath.Abs("testdata")
+		Expect(err).To(BeNil())
+		ds.mountPoints = []string{mountPoint}
+
+		total, err := ds.GetValue("fs." + mountPoint + ".total")
+		Expect(err).To(BeNil())
+		Expect(total).To(BeNumerically(">", 0))
+		Expect(ds.GetValue("fs." + mountPoint + ".usedPercent")).To(BeNumerically("<=", 100))
+	})
+
+	It("should name filesystem metrics by mount point", func() {
+		Expect(hostFilesystemMetrics("/")[0].GetName()).To(Equal("Host/Filesystem/root/Total"))
+		Expect(hostFilesystemMetrics("/var/lib/")[1].GetName()).To(Equal("Host/Filesystem/var/lib/Used"))
+	})
+})
@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package gorelic
+
+import "syscall"
+
+// readFilesystemUsage reports the same numbers as df does
+func readFilesystemUsage(mountPoint string, hostData map[string]float64) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(mountPoint, &stat); err != nil {
+		return
+	}
+	blockSize := float64(stat.Bsize)
+	total := float64(stat.Blocks) * blockSize
+	used := total - float64(stat.Bfree)*blockSize
+	available := float64(stat.Bavail) * blockSize
+
+	hostData["fs."+mountPoint+".total"] = total
+	hostData["fs."+mountPoint+".used"] = used
+	hostData["fs."+mountPoint+".available"] = available
+	if used+available > 0 {
+		hostData["fs."+mountPoint+".usedPercent"] = used / (used + available) * 100
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package gorelic
+
+// readFilesystemUsage is implemented for Linux only
+func readFilesystemUsage(mountPoint string, hostData map[string]float64) {}
@@ -0,0 +1,146 @@
+package gorelic
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+// inFlightGauge tracks requests in flight: current number, maximum and time-weighted average since previous harvest
+type inFlightGauge struct {
+	sync.Mutex
+	current int64
+	max     int64
+	// weightedSum is sum of current * time it lasted since windowStart, in request-nanoseconds
+	weightedSum float64
+	lastChange  time.Time
+	windowStart time.Time
+}
+
+// add changes number of requests in flight at now
+func (gauge *inFlightGauge) add(delta int64, now time.Time) {
+	gauge.Lock()
+	defer gauge.Unlock()
+	gauge.accumulate(now)
+	gauge.current += delta
+	if gauge.current > gauge.max {
+		gauge.max = gauge.current
+	}
+}
+
+// start begins the first window at now, requests served before are not averaged
+func (gauge *inFlightGauge) start(now time.Time) {
+	gauge.Lock()
+	defer gauge.Unlock()
+	gauge.weightedSum = 0
+	gauge.lastChange = now
+	gauge.windowStart = now
+}
+
+// accumulate adds time since last change to weightedSum. Window of gauge which is not started yet begins with the first call.
+func (gauge *inFlightGauge) accumulate(now time.Time) {
+	if gauge.windowStart.IsZero() {
+		gauge.windowStart = now
+	} else if elapsed := now.Sub(gauge.lastChange); elapsed > 0 {
+		gauge.weightedSum += float64(gauge.current) * float64(elapsed)
+	}
+	gauge.lastChange = now
+}
+
+// take returns current, max and average number of requests in flight since previous take and starts new window
+func (gauge *inFlightGauge) take(now time.Time) (current int64, max int64, average float64) {
+	gauge.Lock()
+	defer gauge.Unlock()
+	gauge.accumulate(now)
+	current, max, average = gauge.current, gauge.max, float64(gauge.current)
+	if window := now.Sub(gauge.windowStart); window > 0 {
+		average = gauge.weightedSum / float64(window)
+	}
+	gauge.max = gauge.current
+	gauge.weightedSum = 0
+	gauge.windowStart = now
+	return current, max, average
+}
+
+// httpInFlight keeps in flight gauges of all requests and of every path of WrapHTTPHandlerFunc.
+// Windows of gauges start with Run, gauges of paths wrapped later start when they are created.
+type httpInFlight struct {
+	sync.Mutex
+	total *inFlightGauge
+	paths map[string]*inFlightGauge
+	now   func() time.Time
+}
+
+func newHTTPInFlight() *httpInFlight {
+	return &httpInFlight{total: &inFlightGauge{}, paths: make(map[string]*inFlightGauge)}
+}
+
+// gauges returns gauges request to path should be counted in, empty path means total gauge only
+func (inFlight *httpInFlight) gauges(path string) []*inFlightGauge {
+	if path == "" {
+		return []*inFlightGauge{inFlight.total}
+	}
+	inFlight.Lock()
+	defer inFlight.Unlock()
+	gauge := inFlight.paths[path]
+	if gauge == nil {
+		gauge = &inFlightGauge{}
+		if inFlight.now != nil {
+			gauge.start(inFlight.now())
+		}
+		inFlight.paths[path] = gauge
+	}
+	return []*inFlightGauge{inFlight.total, gauge}
+}
+
+// httpInFlightSource reports in flight requests as http/inFlight/{current,max,average} and
+// http/path/<path>/inFlight/{current,max,average}
+type httpInFlightSource struct {
+	inFlight *httpInFlight
+	now      func() time.Time
+}
+
+// newHTTPInFlightSource starts windows of all gauges at now
+func newHTTPInFlightSource(inFlight *httpInFlight, now func() time.Time) *httpInFlightSource {
+	start := now()
+	inFlight.Lock()
+	inFlight.now = now
+	inFlight.total.start(start)
+	for _, gauge := range inFlight.paths {
+		gauge.start(start)
+	}
+	inFlight.Unlock()
+	return &httpInFlightSource{inFlight: inFlight, now: now}
+}
+
+// iMetricaSource interface implementation. Max and average are taken and reset, so they describe time since previous harvest.
+func (source *httpInFlightSource) Metricas() []nrpg.IMetrica {
+	now := source.now()
+	source.inFlight.Lock()
+	paths := make([]string, 0, len(source.inFlight.paths))
+	gauges := make(map[string]*inFlightGauge, len(source.inFlight.paths))
+	for path, gauge := range source.inFlight.paths {
+		paths = append(paths, path)
+		gauges[path] = gauge
+	}
+	source.inFlight.Unlock()
+	sort.Strings(paths)
+
+	var metricas []nrpg.IMetrica
+	add := func(prefix string, baseName string, labels map[string]string, gauge *inFlightGauge) {
+		current, max, average := gauge.take(now)
+		metricas = append(metricas,
+			newLabeledMetrica(prefix+"current", baseName+"current", labels, "requests", float64(current), GaugeMetric),
+			newLabeledMetrica(prefix+"max", baseName+"max", labels, "requests", float64(max), GaugeMetric),
+			newLabeledMetrica(prefix+"average", baseName+"average", labels, "requests", average, GaugeMetric),
+		)
+	}
+	add("http/inFlight/", "http/inFlight/", nil, source.inFlight.total)
+	for _, path := range paths {
+		add(fmt.Sprintf("http/path/%v/inFlight/", path), "http/path/inFlight/", map[string]string{"route": path}, gauges[path])
+	}
+	return metricas
+}
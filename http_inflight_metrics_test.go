@@ -0,0 +1,101 @@
+package gorelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP in flight metrics", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+	var clock *manualClock
+
+	value := func(name string) float64 {
+		metric := findMetric(reporter.lastHarvest(), name)
+		Expect(metric).NotTo(BeNil(), name)
+		return metric.Value
+	}
+
+	serve := func(handler http.Handler) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	BeforeEach(func() {
+		clock = &manualClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		reporter = &recordingReporter{}
+		var err error
+		agent, err = New(WithClock(clock), WithReporter(reporter), WithGCStat(false, 0), WithMemoryStat(false, 0))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should report current, max and time-weighted average", func() {
+		// orders request lasts 4s, users request runs during 2s of it
+		users := agent.WrapHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clock.now = clock.now.Add(2 * time.Second)
+		}))
+		orders := http.HandlerFunc(agent.WrapHTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clock.now = clock.now.Add(time.Second)
+			serve(users)
+			clock.now = clock.now.Add(time.Second)
+		}, "/orders"))
+		Expect(agent.Run()).To(Succeed())
+
+		// window starts with Run, so idle time before the first request is averaged too
+		clock.now = clock.now.Add(4 * time.Second)
+		serve(orders)
+		agent.harvest()
+		Expect(value("http/inFlight/current")).To(Equal(0.0))
+		Expect(value("http/inFlight/max")).To(Equal(2.0))
+		Expect(value("http/inFlight/average")).To(Equal(0.75))
+		Expect(value("http/path//orders/inFlight/max")).To(Equal(1.0))
+		Expect(value("http/path//orders/inFlight/average")).To(Equal(0.5))
+		metric := findMetric(reporter.lastHarvest(), "http/path//orders/inFlight/current")
+		Expect(metric.BaseName).To(Equal("http/path/inFlight/current"))
+		Expect(metric.Labels).To(Equal(map[string]string{"route": "/orders"}))
+
+		clock.now = clock.now.Add(time.Minute)
+		agent.harvest()
+		Expect(value("http/inFlight/max")).To(Equal(0.0))
+		Expect(value("http/inFlight/average")).To(Equal(0.0))
+	})
+
+	It("should start window of path wrapped after Run when it is wrapped", func() {
+		agent.CollectHTTPStat = true
+		Expect(agent.Run()).To(Succeed())
+		clock.now = clock.now.Add(4 * time.Second)
+		late := http.HandlerFunc(agent.WrapHTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clock.now = clock.now.Add(time.Second)
+		}, "/late"))
+		clock.now = clock.now.Add(time.Second)
+
+		serve(late)
+		agent.harvest()
+		Expect(value("http/path//late/inFlight/average")).To(Equal(0.5))
+		Expect(value("http/inFlight/average")).To(Equal(1.0 / 6))
+	})
+
+	It("should report requests in flight during harvest", func() {
+		slow := http.HandlerFunc(agent.WrapHTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clock.now = clock.now.Add(time.Second)
+			agent.harvest()
+			clock.now = clock.now.Add(time.Second)
+		}, "/slow"))
+		Expect(agent.Run()).To(Succeed())
+
+		serve(slow)
+		Expect(reporter.harvests).To(HaveLen(1))
+		Expect(value("http/inFlight/current")).To(Equal(1.0))
+		Expect(value("http/path//slow/inFlight/current")).To(Equal(1.0))
+		Expect(value("http/inFlight/average")).To(Equal(1.0))
+
+		clock.now = clock.now.Add(2 * time.Second)
+		agent.harvest()
+		Expect(value("http/inFlight/current")).To(Equal(0.0))
+		Expect(value("http/inFlight/max")).To(Equal(1.0))
+		Expect(value("http/inFlight/average")).To(Equal(1.0 / 3))
+	})
+})
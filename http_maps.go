@@ -31,6 +31,18 @@ var (
 		http.StatusHTTPVersionNotSupported:      true,
 	}
 
+	httpMethods = []string{
+		"GET",
+		"HEAD",
+		"POST",
+		"PUT",
+		"PATCH",
+		"DELETE",
+		"CONNECT",
+		"OPTIONS",
+		"TRACE",
+	}
+
 	httpStatuses = []int{
 		http.StatusContinue,
 		http.StatusSwitchingProtocols,
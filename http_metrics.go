@@ -5,7 +5,6 @@ import (
 	"time"
 
 	metrics "github.com/yvasiyarov/go-metrics"
-	nrpg "github.com/yvasiyarov/newrelic_platform_go"
 )
 
 type tHTTPHandlerFunc func(http.ResponseWriter, *http.Request)
@@ -14,6 +13,8 @@ type tHTTPHandler struct {
 	originalHandlerFunc tHTTPHandlerFunc
 	isFunc              bool
 	timer               metrics.Timer
+	now                 func() time.Time
+	inFlight            []*inFlightGauge
 }
 
 var httpTimer metrics.Timer
@@ -22,18 +23,29 @@ func newHTTPHandlerFunc(h tHTTPHandlerFunc) *tHTTPHandler {
 	return &tHTTPHandler{
 		isFunc:              true,
 		originalHandlerFunc: h,
+		now:                 time.Now,
 	}
 }
 func newHTTPHandler(h http.Handler) *tHTTPHandler {
 	return &tHTTPHandler{
 		isFunc:          false,
 		originalHandler: h,
+		now:             time.Now,
 	}
 }
 
 func (handler *tHTTPHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	startTime := time.Now()
-	defer handler.timer.UpdateSince(startTime)
+	startTime := handler.now()
+	for _, gauge := range handler.inFlight {
+		gauge.add(1, startTime)
+	}
+	defer func() {
+		endTime := handler.now()
+		handler.timer.Update(endTime.Sub(startTime))
+		for _, gauge := range handler.inFlight {
+			gauge.add(-1, endTime)
+		}
+	}()
 
 	if handler.isFunc {
 		handler.originalHandlerFunc(w, req)
@@ -42,7 +54,7 @@ func (handler *tHTTPHandler) ServeHTTP(w http.ResponseWriter, req *http.Request)
 	}
 }
 
-func addHTTPMericsToComponent(component nrpg.IComponent, timer metrics.Timer, reqCounter metrics.Counter, errCounter metrics.Counter) {
+func addHTTPMericsToComponent(component iComponent, timer metrics.Timer, reqCounter metrics.Counter, errCounter metrics.Counter) {
 	rate1 := &timerRate1Metrica{
 		baseTimerMetrica: &baseTimerMetrica{
 			name:       "http/throughput/1minute",
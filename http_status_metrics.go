@@ -2,16 +2,18 @@ package gorelic
 
 import (
 	"fmt"
+	"strconv"
 
 	metrics "github.com/yvasiyarov/go-metrics"
-	nrpg "github.com/yvasiyarov/newrelic_platform_go"
 )
 
 // New metrica collector - counter per each http status code.
 type counterByStatusMetrica struct {
-	counter metrics.Counter
-	name    string
-	units   string
+	counter  metrics.Counter
+	name     string
+	units    string
+	baseName string
+	labels   map[string]string
 }
 
 // metrics.IMetrica interface implementation.
@@ -21,13 +23,47 @@ func (m *counterByStatusMetrica) GetUnits() string { return m.units }
 
 func (m *counterByStatusMetrica) GetValue() (float64, error) { return float64(m.counter.Count()), nil }
 
+// TypedMetrica interface implementation. Counters are cleared after every harvest.
+func (m *counterByStatusMetrica) GetType() MetricType { return CountMetric }
+
+// LabeledMetrica interface implementation.
+func (m *counterByStatusMetrica) GetLabels() (string, map[string]string) {
+	if m.baseName == "" {
+		return m.name, nil
+	}
+	return m.baseName, m.labels
+}
+
 // addHTTPStatusMetricsToComponent initializes counter metrics for all http statuses and adds them to the component.
-func addHTTPStatusMetricsToComponent(component nrpg.IComponent, statusCounters map[int]metrics.Counter) {
+func addHTTPStatusMetricsToComponent(component iComponent, statusCounters map[int]metrics.Counter) {
 	for statusCode, counter := range statusCounters {
 		component.AddMetrica(&counterByStatusMetrica{
-			counter: counter,
-			name:    fmt.Sprintf("http/status/%d", statusCode),
-			units:   "count",
+			counter:  counter,
+			name:     fmt.Sprintf("http/status/%d", statusCode),
+			units:    "count",
+			baseName: "http/status",
+			labels:   map[string]string{"status": strconv.Itoa(statusCode)},
 		})
 	}
 }
+
+// counterByMethodMetrica counts requests by HTTP method, it is reported by dimensional reporters only
+type counterByMethodMetrica struct {
+	counterByStatusMetrica
+}
+
+// dimensionalMetrica interface implementation
+func (m *counterByMethodMetrica) dimensionalOnly() bool { return true }
+
+// addHTTPMethodMetricsToComponent initializes counter metrics for all http methods and adds them to the component.
+func addHTTPMethodMetricsToComponent(component iComponent, methodCounters map[string]metrics.Counter) {
+	for method, counter := range methodCounters {
+		component.AddMetrica(&counterByMethodMetrica{counterByStatusMetrica{
+			counter:  counter,
+			name:     "http/method/" + method,
+			units:    "count",
+			baseName: "http/method",
+			labels:   map[string]string{"method": method},
+		}})
+	}
+}
@@ -0,0 +1,136 @@
+package gorelic
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultInsightsBatchSize is maximum number of events sent in one payload
+	DefaultInsightsBatchSize = 2000
+)
+
+// InsightsEndpoint returns Insights insert API endpoint of account in region of insert key.
+// Region is encoded in key prefix, like "eu01xx".
+func InsightsEndpoint(accountID string, insertKey string) string {
+	host := "insights-collector.newrelic.com"
+	if strings.HasPrefix(insertKey, "eu") {
+		host = "insights-collector.eu01.nr-data.net"
+	}
+	return fmt.Sprintf("https://%s/v1/accounts/%s/events", host, accountID)
+}
+
+// InsightsReporter sends events recorded with Agent.RecordEvent to New Relic Insights insert API.
+// Metrics of harvest are ignored, so it is used together with metrics reporters:
+//
+//	agent.AddReporter(gorelic.NewInsightsReporter(accountID, insertKey))
+type InsightsReporter struct {
+	// atomic counter is first to be 64-bit aligned on 32-bit platforms
+	sentBytes int64
+
+	InsertKey string
+	Endpoint  string
+	// BatchSize is maximum number of events sent in one payload
+	BatchSize int
+	// All requests will be done using this client. Change it if you need
+	// to use a proxy.
+	Client http.Client
+}
+
+// NewInsightsReporter creates reporter sending events to account in region of insert key
+func NewInsightsReporter(accountID string, insertKey string) *InsightsReporter {
+	return &InsightsReporter{
+		InsertKey: insertKey,
+		Endpoint:  InsightsEndpoint(accountID, insertKey),
+		BatchSize: DefaultInsightsBatchSize,
+		Client:    http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// MetricsReporter interface implementation.
+// Events are sent as flat objects with eventType and timestamp (unix milliseconds) attributes,
+// harvest labels are added to every event.
+func (reporter *InsightsReporter) Report(harvest *Harvest) error {
+	events := make([]map[string]interface{}, 0, len(harvest.Events))
+	for _, event := range harvest.Events {
+		payload := make(map[string]interface{}, len(harvest.Labels)+len(event.Attributes)+2)
+		for key, value := range harvest.Labels {
+			payload[key] = value
+		}
+		for key, value := range event.Attributes {
+			payload[key] = value
+		}
+		payload["eventType"] = event.Type
+		payload["timestamp"] = event.Timestamp.UnixNano() / int64(time.Millisecond)
+		events = append(events, payload)
+	}
+
+	batchSize := reporter.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultInsightsBatchSize
+	}
+	header := http.Header{}
+	header.Set("X-Insert-Key", reporter.InsertKey)
+
+	var errs []error
+	for start := 0; start < len(events); start += batchSize {
+		end := start + batchSize
+		if end > len(events) {
+			end = len(events)
+		}
+		body, err := compressJSON(events[start:end])
+		if err == nil {
+			size := int64(body.Len())
+			if err = postCompressedJSON(reporter.Client, reporter.Endpoint, header, body); err == nil {
+				atomic.AddInt64(&reporter.sentBytes, size)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// Validate checks insert key and endpoint, it is called by New and Run
+func (reporter *InsightsReporter) Validate() error {
+	if reporter.InsertKey == "" {
+		return errors.New("InsertKey: must not be empty")
+	}
+	if err := validateURL(reporter.Endpoint, "http", "https"); err != nil {
+		return fmt.Errorf("Endpoint: %v", err)
+	}
+	return nil
+}
+
+// PayloadReporter interface implementation
+func (reporter *InsightsReporter) SentBytes() int64 {
+	return atomic.LoadInt64(&reporter.sentBytes)
+}
+
+// DeploymentReporter interface implementation. Deployment is sent immediately as Deployment event.
+func (reporter *InsightsReporter) ReportDeployment(deployment Deployment) error {
+	event := map[string]interface{}{
+		"eventType":   "Deployment",
+		"timestamp":   deployment.Timestamp.UnixNano() / int64(time.Millisecond),
+		"revision":    deployment.Revision,
+		"description": deployment.Description,
+		"user":        deployment.User,
+	}
+	body, err := compressJSON([]map[string]interface{}{event})
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("X-Insert-Key", reporter.InsertKey)
+	size := int64(body.Len())
+	if err := postCompressedJSON(reporter.Client, reporter.Endpoint, header, body); err != nil {
+		return err
+	}
+	atomic.AddInt64(&reporter.sentBytes, size)
+	return nil
+}
@@ -0,0 +1,120 @@
+package gorelic
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// LogLevel is severity of agent message
+type LogLevel int
+
+// Log levels in order of severity
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (level LogLevel) String() string {
+	switch level {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(level))
+}
+
+// Logger receives all messages of agent and reporters.
+// Fields are passed as alternating keys and values, like in log/slog:
+//
+//	logger.Warn("can not get metric value", "metric", "Custom/queue", "error", err)
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// stdLogger writes messages of level or higher to standard library logger
+type stdLogger struct {
+	logger *log.Logger
+	level  LogLevel
+}
+
+// NewStdLogger creates Logger writing messages of level or higher with standard library logger.
+// Messages are formatted as "gorelic: LEVEL message key=value ...". Nil logger writes to stderr with standard flags.
+func NewStdLogger(logger *log.Logger, level LogLevel) Logger {
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return &stdLogger{logger: logger, level: level}
+}
+
+// Logger interface implementation
+func (l *stdLogger) Debug(msg string, keyvals ...interface{}) { l.log(LogDebug, msg, keyvals) }
+
+// Logger interface implementation
+func (l *stdLogger) Info(msg string, keyvals ...interface{}) { l.log(LogInfo, msg, keyvals) }
+
+// Logger interface implementation
+func (l *stdLogger) Warn(msg string, keyvals ...interface{}) { l.log(LogWarn, msg, keyvals) }
+
+// Logger interface implementation
+func (l *stdLogger) Error(msg string, keyvals ...interface{}) { l.log(LogError, msg, keyvals) }
+
+func (l *stdLogger) log(level LogLevel, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+	var line bytes.Buffer
+	fmt.Fprintf(&line, "gorelic: %s %s", level, msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fmt.Fprintf(&line, " %v=%s", keyvals[i], logValue(value))
+	}
+	l.logger.Output(3, line.String())
+}
+
+// logValue formats field value, values with spaces or quotes are quoted
+func logValue(value interface{}) string {
+	text := fmt.Sprint(value)
+	if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+		return fmt.Sprintf("%q", text)
+	}
+	return text
+}
+
+// logger returns Logger of agent. Without Logger set, warnings and errors are written to stderr,
+// debug messages are written as well if Verbose is set.
+func (agent *Agent) logger() Logger {
+	if agent.Logger != nil {
+		return agent.Logger
+	}
+	verbose := agent.Verbose
+	agent.configLock.Lock()
+	if agent.config != nil {
+		verbose = agent.config.verbose
+	}
+	agent.configLock.Unlock()
+	if verbose {
+		return verboseLogger
+	}
+	return defaultLogger
+}
+
+var (
+	defaultLogger = NewStdLogger(nil, LogWarn)
+	verboseLogger = NewStdLogger(nil, LogDebug)
+)
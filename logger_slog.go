@@ -0,0 +1,42 @@
+//go:build go1.21
+// +build go1.21
+
+package gorelic
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogLogger passes messages to log/slog logger
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger creates Logger passing messages and fields to log/slog logger. Nil logger means slog.Default().
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger}
+}
+
+// Logger interface implementation
+func (l *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+// Logger interface implementation
+func (l *slogLogger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+// Logger interface implementation
+func (l *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
+
+// Logger interface implementation
+func (l *slogLogger) Error(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelError, msg, keyvals...)
+}
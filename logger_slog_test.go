@@ -0,0 +1,34 @@
+//go:build go1.21
+// +build go1.21
+
+package gorelic
+
+import (
+	"bytes"
+	"log/slog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Slog logger", func() {
+	It("should pass levels and fields", func() {
+		var out bytes.Buffer
+		handler := slog.NewTextHandler(&out, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+			ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+				if attr.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return attr
+			},
+		})
+		logger := NewSlogLogger(slog.New(handler))
+		logger.Debug("hidden")
+		logger.Warn("can not get metric value", "metric", "Custom/queue")
+		logger.Error("can not report metrics", "reporter", "MetricAPIReporter")
+		Expect(out.String()).To(Equal(`level=WARN msg="can not get metric value" metric=Custom/queue
+level=ERROR msg="can not report metrics" reporter=MetricAPIReporter
+`))
+	})
+})
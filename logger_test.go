@@ -0,0 +1,97 @@
+package gorelic
+
+import (
+	"bytes"
+	"errors"
+	"log"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type logEntry struct {
+	level   LogLevel
+	msg     string
+	keyvals []interface{}
+}
+
+// recordingLogger keeps all messages
+type recordingLogger struct {
+	entries []logEntry
+}
+
+func (l *recordingLogger) Debug(msg string, keyvals ...interface{}) {
+	l.entries = append(l.entries, logEntry{LogDebug, msg, keyvals})
+}
+
+func (l *recordingLogger) Info(msg string, keyvals ...interface{}) {
+	l.entries = append(l.entries, logEntry{LogInfo, msg, keyvals})
+}
+
+func (l *recordingLogger) Warn(msg string, keyvals ...interface{}) {
+	l.entries = append(l.entries, logEntry{LogWarn, msg, keyvals})
+}
+
+func (l *recordingLogger) Error(msg string, keyvals ...interface{}) {
+	l.entries = append(l.entries, logEntry{LogError, msg, keyvals})
+}
+
+func (l *recordingLogger) levels(level LogLevel) []logEntry {
+	var entries []logEntry
+	for _, entry := range l.entries {
+		if entry.level == level {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+var _ = Describe("Logger", func() {
+	It("should write messages of level and higher with fields", func() {
+		var out bytes.Buffer
+		logger := NewStdLogger(log.New(&out, "", 0), LogWarn)
+		logger.Debug("debug")
+		logger.Info("info")
+		logger.Warn("can not get metric value", "metric", "Custom/queue", "error", errors.New("queue closed"))
+		logger.Error("odd", "key")
+		Expect(out.String()).To(Equal(`gorelic: WARN can not get metric value metric=Custom/queue error="queue closed"
+gorelic: ERROR odd key=(MISSING)
+`))
+	})
+
+	It("should use Verbose without custom logger", func() {
+		agent := NewAgent()
+		Expect(agent.logger()).To(BeIdenticalTo(defaultLogger))
+		agent.Verbose = true
+		Expect(agent.logger()).To(BeIdenticalTo(verboseLogger))
+		logger := &recordingLogger{}
+		agent.Logger = logger
+		Expect(agent.logger()).To(BeIdenticalTo(logger))
+	})
+
+	It("should route agent messages", func() {
+		logger := &recordingLogger{}
+		agent := NewAgent()
+		agent.Logger = logger
+		agent.AddReporter(&failingReporter{err: errors.New("unavailable")})
+		agent.AddCustomMetric(&failingMetrica{})
+		Expect(agent.Run()).To(Succeed())
+		Expect(logger.levels(LogDebug)).NotTo(BeEmpty())
+
+		agent.harvest()
+		warnings := logger.levels(LogWarn)
+		Expect(warnings).To(HaveLen(1))
+		Expect(warnings[0].msg).To(Equal("Can not get metric value."))
+		Expect(warnings[0].keyvals[:2]).To(Equal([]interface{}{"metric", "Custom/failing"}))
+
+		errs := logger.levels(LogError)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].keyvals).To(Equal([]interface{}{"reporter", "failingReporter", "error", errors.New("unavailable")}))
+
+		// Metrica which keeps failing is not warned about again
+		agent.harvest()
+		Expect(logger.levels(LogWarn)).To(HaveLen(1))
+		debugs := logger.levels(LogDebug)
+		Expect(debugs[len(debugs)-1].msg).To(Equal("Can not get metric value."))
+	})
+})
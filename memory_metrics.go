@@ -2,20 +2,20 @@ package gorelic
 
 import (
 	metrics "github.com/yvasiyarov/go-metrics"
-	"github.com/yvasiyarov/newrelic_platform_go"
 	"time"
 )
 
-func newMemoryMetricaDataSource(pollInterval int) goMetricaDataSource {
+func newMemoryMetricaDataSource(pollInterval int, clock Clock, stop <-chan struct{}) goMetricaDataSource {
 	r := metrics.NewRegistry()
 
 	metrics.RegisterRuntimeMemStats(r)
 	metrics.CaptureRuntimeMemStatsOnce(r)
-	go metrics.CaptureRuntimeMemStats(r, time.Duration(pollInterval)*time.Second)
+	go captureEvery(clock, time.Duration(pollInterval)*time.Second, stop, func() { metrics.CaptureRuntimeMemStatsOnce(r) })
 	return goMetricaDataSource{r}
 }
 
-func addMemoryMericsToComponent(component newrelic_platform_go.IComponent, pollInterval int) {
+// addMemoryMericsToComponent adds memory allocator metricas, statistic is captured until stop is closed
+func addMemoryMericsToComponent(component iComponent, pollInterval int, clock Clock, stop <-chan struct{}) {
 	gaugeMetrics := []*baseGoMetrica{
 		//Memory in use metrics
 		&baseGoMetrica{
@@ -44,7 +44,7 @@ func addMemoryMericsToComponent(component newrelic_platform_go.IComponent, pollI
 			dataSourceKey: "runtime.MemStats.MCacheInuse",
 		},
 	}
-	ds := newMemoryMetricaDataSource(pollInterval)
+	ds := newMemoryMetricaDataSource(pollInterval, clock, stop)
 	for _, m := range gaugeMetrics {
 		m.basePath = "Runtime/Memory/"
 		m.dataSource = ds
@@ -0,0 +1,264 @@
+package gorelic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MetricAPIEndpointUS is New Relic Metric API endpoint for US region accounts
+	MetricAPIEndpointUS = "https://metric-api.newrelic.com/metric/v1"
+	// MetricAPIEndpointEU is New Relic Metric API endpoint for EU region accounts
+	MetricAPIEndpointEU = "https://metric-api.eu.newrelic.com/metric/v1"
+
+	// DefaultMetricAPIMaxPayloadSize is the limit of compressed payload accepted by Metric API
+	DefaultMetricAPIMaxPayloadSize = 1000000
+	// DefaultMetricAPIBatchSize is maximum number of metrics sent in one payload
+	DefaultMetricAPIBatchSize = 5000
+)
+
+// MetricAPIEndpoint returns Metric API endpoint of license key region.
+// Region is encoded in license key prefix, like "eu01xx".
+func MetricAPIEndpoint(license string) string {
+	if strings.HasPrefix(license, "eu") {
+		return MetricAPIEndpointEU
+	}
+	return MetricAPIEndpointUS
+}
+
+// MetricAPIReporter sends metrics to New Relic dimensional Metric API.
+// Metrics are sent by their base names, global and per-metric labels are sent as attributes,
+// harvest metadata is sent as common attributes.
+//
+//	agent.AddReporter(gorelic.NewMetricAPIReporter(license))
+type MetricAPIReporter struct {
+	// atomic counter is first to be 64-bit aligned on 32-bit platforms
+	sentBytes int64
+
+	License  string
+	Endpoint string
+	// CommonAttributes are attached to every metric, harvest metadata and labels are added to them
+	CommonAttributes map[string]interface{}
+	// MaxPayloadSize is the limit of compressed payload size, larger batches are split
+	MaxPayloadSize int
+	// BatchSize is maximum number of metrics sent in one payload
+	BatchSize int
+	// All requests will be done using this client. Change it if you need
+	// to use a proxy.
+	Client http.Client
+}
+
+// NewMetricAPIReporter creates reporter sending metrics to endpoint of license key region.
+// Host name and instrumentation provider are added to common attributes.
+func NewMetricAPIReporter(license string) *MetricAPIReporter {
+	attributes := map[string]interface{}{
+		"instrumentation.provider": "gorelic",
+	}
+	if host, err := os.Hostname(); err == nil {
+		attributes["host.name"] = host
+	}
+	return &MetricAPIReporter{
+		License:          license,
+		Endpoint:         MetricAPIEndpoint(license),
+		CommonAttributes: attributes,
+		MaxPayloadSize:   DefaultMetricAPIMaxPayloadSize,
+		BatchSize:        DefaultMetricAPIBatchSize,
+		Client:           http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// metricAPIPayload is one element of Metric API request body.
+// Common block is applied to all metrics of the element.
+type metricAPIPayload struct {
+	Common  metricAPICommon   `json:"common"`
+	Metrics []metricAPIMetric `json:"metrics"`
+}
+
+type metricAPICommon struct {
+	Timestamp  int64                  `json:"timestamp"`
+	IntervalMs int64                  `json:"interval.ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type metricAPIMetric struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Value      interface{}            `json:"value"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type metricAPISummary struct {
+	Count float64 `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// MetricsReporter interface implementation.
+// Metrics are sent in batches of BatchSize, batches exceeding MaxPayloadSize are split in halves.
+func (reporter *MetricAPIReporter) Report(harvest *Harvest) error {
+	common := metricAPICommon{
+		Timestamp:  harvest.Time.UnixNano() / int64(time.Millisecond),
+		IntervalMs: int64(harvest.Duration / time.Millisecond),
+		Attributes: make(map[string]interface{}),
+	}
+	for key, value := range harvest.Metadata {
+		common.Attributes[key] = value
+	}
+	for key, value := range reporter.CommonAttributes {
+		common.Attributes[key] = value
+	}
+	for key, value := range harvest.Labels {
+		common.Attributes[key] = value
+	}
+
+	metrics := make([]metricAPIMetric, 0, len(harvest.Metrics))
+	for _, metric := range harvest.Metrics {
+		metrics = append(metrics, newMetricAPIMetric(metric))
+	}
+
+	batchSize := reporter.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultMetricAPIBatchSize
+	}
+	var errs []error
+	for start := 0; start < len(metrics); start += batchSize {
+		end := start + batchSize
+		if end > len(metrics) {
+			end = len(metrics)
+		}
+		if err := reporter.send(common, metrics[start:end]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+func newMetricAPIMetric(metric Metric) metricAPIMetric {
+	result := metricAPIMetric{
+		Name:       strings.Replace(metric.BaseName, "/", ".", -1),
+		Type:       string(metric.Type),
+		Value:      metric.Value,
+		Attributes: make(map[string]interface{}, len(metric.Labels)+1),
+	}
+	if metric.Type == SummaryMetric && metric.Summary != nil {
+		result.Value = metricAPISummary(*metric.Summary)
+	} else if metric.Type != CountMetric {
+		result.Type = string(GaugeMetric)
+	}
+	for key, value := range metric.Labels {
+		result.Attributes[key] = value
+	}
+	if metric.Units != "" {
+		result.Attributes["units"] = metric.Units
+	}
+	return result
+}
+
+// send posts batch, splitting it while compressed payload is too large
+func (reporter *MetricAPIReporter) send(common metricAPICommon, metrics []metricAPIMetric) error {
+	body, err := compressJSON([]metricAPIPayload{{Common: common, Metrics: metrics}})
+	if err != nil {
+		return err
+	}
+	if reporter.MaxPayloadSize > 0 && body.Len() > reporter.MaxPayloadSize {
+		if len(metrics) == 1 {
+			return fmt.Errorf("metric %s exceeds payload size limit of %d bytes", metrics[0].Name, reporter.MaxPayloadSize)
+		}
+		half := len(metrics) / 2
+		var errs []error
+		for _, batch := range [][]metricAPIMetric{metrics[:half], metrics[half:]} {
+			if err := reporter.send(common, batch); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return joinErrors(errs)
+	}
+	header := http.Header{}
+	header.Set("X-License-Key", reporter.License)
+	size := int64(body.Len())
+	if err := postCompressedJSON(reporter.Client, reporter.Endpoint, header, body); err != nil {
+		return err
+	}
+	atomic.AddInt64(&reporter.sentBytes, size)
+	return nil
+}
+
+// Validate checks license and endpoint, it is called by New and Run
+func (reporter *MetricAPIReporter) Validate() error {
+	if reporter.License == "" {
+		return errors.New("License: must not be empty")
+	}
+	if err := validateURL(reporter.Endpoint, "http", "https"); err != nil {
+		return fmt.Errorf("Endpoint: %v", err)
+	}
+	return nil
+}
+
+// PayloadReporter interface implementation
+func (reporter *MetricAPIReporter) SentBytes() int64 {
+	return atomic.LoadInt64(&reporter.sentBytes)
+}
+
+// joinErrors returns the only error as is, several errors are joined into one
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// compressJSON encodes payload to gzip compressed JSON
+func compressJSON(payload interface{}) (*bytes.Buffer, error) {
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	if err := json.NewEncoder(writer).Encode(payload); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return &body, nil
+}
+
+// postCompressedJSON sends gzip compressed JSON body, any non 2xx response is an error
+func postCompressedJSON(client http.Client, endpoint string, header http.Header, body io.Reader) error {
+	req, err := http.NewRequest("POST", endpoint, body)
+	if err != nil {
+		return err
+	}
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("User-Agent", "gorelic/"+CurrentAgentVersion)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	response, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &httpStatusError{endpoint, resp.Status, resp.StatusCode, strings.TrimSpace(string(response))}
+	}
+	return nil
+}
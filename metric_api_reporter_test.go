@@ -0,0 +1,222 @@
+package gorelic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// metricAPICollector accepts Metric API requests and validates their schema
+type metricAPICollector struct {
+	sync.Mutex
+	server   *httptest.Server
+	payloads [][]metricAPIPayload
+	sizes    []int
+	errors   []error
+	status   int
+}
+
+func newMetricAPICollector() *metricAPICollector {
+	collector := &metricAPICollector{status: http.StatusAccepted}
+	collector.server = httptest.NewServer(http.HandlerFunc(collector.serve))
+	return collector
+}
+
+func (collector *metricAPICollector) serve(w http.ResponseWriter, req *http.Request) {
+	collector.Lock()
+	defer collector.Unlock()
+
+	payload, size, err := validateMetricAPIRequest(req)
+	if err != nil {
+		collector.errors = append(collector.errors, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	collector.payloads = append(collector.payloads, payload)
+	collector.sizes = append(collector.sizes, size)
+	w.WriteHeader(collector.status)
+	fmt.Fprint(w, `{"requestId":"test"}`)
+}
+
+func validateMetricAPIRequest(req *http.Request) ([]metricAPIPayload, int, error) {
+	if req.Method != "POST" || req.URL.Path != "/metric/v1" {
+		return nil, 0, fmt.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+	}
+	if req.Header.Get("X-License-Key") == "" {
+		return nil, 0, fmt.Errorf("license key header is missing")
+	}
+	if req.Header.Get("Content-Encoding") != "gzip" || req.Header.Get("Content-Type") != "application/json" {
+		return nil, 0, fmt.Errorf("unexpected content headers %v", req.Header)
+	}
+
+	var body bytes.Buffer
+	size, _ := body.ReadFrom(req.Body)
+	reader, err := gzip.NewReader(&body)
+	if err != nil {
+		return nil, 0, err
+	}
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	var payload []metricAPIPayload
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, 0, err
+	}
+
+	for _, element := range payload {
+		if element.Common.Timestamp <= 0 {
+			return nil, 0, fmt.Errorf("timestamp is missing")
+		}
+		for _, metric := range element.Metrics {
+			if metric.Name == "" {
+				return nil, 0, fmt.Errorf("metric name is missing")
+			}
+			switch metric.Type {
+			case "gauge":
+				if _, ok := metric.Value.(float64); !ok {
+					return nil, 0, fmt.Errorf("gauge %s value is not a number", metric.Name)
+				}
+			case "count":
+				if _, ok := metric.Value.(float64); !ok || element.Common.IntervalMs <= 0 {
+					return nil, 0, fmt.Errorf("count %s has no number value or interval", metric.Name)
+				}
+			case "summary":
+				value, ok := metric.Value.(map[string]interface{})
+				if !ok || len(value) != 4 || element.Common.IntervalMs <= 0 {
+					return nil, 0, fmt.Errorf("summary %s has invalid value or no interval", metric.Name)
+				}
+				for _, key := range []string{"count", "sum", "min", "max"} {
+					if _, ok := value[key].(float64); !ok {
+						return nil, 0, fmt.Errorf("summary %s has no %s", metric.Name, key)
+					}
+				}
+			default:
+				return nil, 0, fmt.Errorf("metric %s has unknown type %q", metric.Name, metric.Type)
+			}
+		}
+	}
+	return payload, int(size), nil
+}
+
+func (collector *metricAPICollector) metrics() []metricAPIMetric {
+	collector.Lock()
+	defer collector.Unlock()
+	var result []metricAPIMetric
+	for _, payload := range collector.payloads {
+		for _, element := range payload {
+			result = append(result, element.Metrics...)
+		}
+	}
+	return result
+}
+
+var _ = Describe("MetricAPIReporter", func() {
+	var collector *metricAPICollector
+	var reporter *MetricAPIReporter
+	var harvest *Harvest
+
+	BeforeEach(func() {
+		collector = newMetricAPICollector()
+		reporter = NewMetricAPIReporter("license")
+		reporter.Endpoint = collector.server.URL + "/metric/v1"
+		harvest = &Harvest{
+			Time:     time.Unix(1500000000, 0),
+			Duration: time.Minute,
+			Metadata: map[string]string{"go.version": "go1.21"},
+			Labels:   map[string]string{"region": "eu"},
+			Metrics: []Metric{
+				{Name: "Runtime/General/NOGoroutines", BaseName: "Runtime/General/NOGoroutines", Units: "goroutines", Value: 12, Type: GaugeMetric},
+				{Name: "http/status/200", BaseName: "http/status", Labels: map[string]string{"status": "200"}, Units: "count", Value: 3, Type: CountMetric},
+				{Name: "Custom/payload", BaseName: "Custom/payload", Units: "bytes", Value: 2, Type: SummaryMetric, Summary: &MetricSummary{Count: 2, Sum: 30, Min: 10, Max: 20}},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		collector.server.Close()
+	})
+
+	It("should choose endpoint by license region", func() {
+		Expect(MetricAPIEndpoint("0123456789abcdef")).To(Equal(MetricAPIEndpointUS))
+		Expect(MetricAPIEndpoint("eu01xx0123456789")).To(Equal(MetricAPIEndpointEU))
+		Expect(NewMetricAPIReporter("eu01xx0123456789").Endpoint).To(Equal(MetricAPIEndpointEU))
+	})
+
+	It("should send gauge, count and summary metrics with attributes", func() {
+		Expect(reporter.Report(harvest)).To(Succeed())
+		Expect(collector.errors).To(BeEmpty())
+		Expect(collector.payloads).To(HaveLen(1))
+
+		common := collector.payloads[0][0].Common
+		Expect(common.Timestamp).To(Equal(int64(1500000000000)))
+		Expect(common.IntervalMs).To(Equal(int64(60000)))
+		Expect(common.Attributes).To(HaveKeyWithValue("go.version", "go1.21"))
+		Expect(common.Attributes).To(HaveKeyWithValue("region", "eu"))
+		Expect(common.Attributes).To(HaveKeyWithValue("instrumentation.provider", "gorelic"))
+		Expect(common.Attributes).To(HaveKey("host.name"))
+
+		metrics := collector.metrics()
+		Expect(metrics).To(HaveLen(3))
+		Expect(metrics[0].Name).To(Equal("Runtime.General.NOGoroutines"))
+		Expect(metrics[0].Type).To(Equal("gauge"))
+		Expect(metrics[0].Value).To(Equal(12.0))
+		Expect(metrics[1].Name).To(Equal("http.status"))
+		Expect(metrics[1].Type).To(Equal("count"))
+		Expect(metrics[1].Attributes).To(Equal(map[string]interface{}{"status": "200", "units": "count"}))
+		Expect(metrics[2].Type).To(Equal("summary"))
+		Expect(metrics[2].Value).To(Equal(map[string]interface{}{"count": 2.0, "sum": 30.0, "min": 10.0, "max": 20.0}))
+	})
+
+	It("should split metrics into batches", func() {
+		reporter.BatchSize = 2
+		Expect(reporter.Report(harvest)).To(Succeed())
+		Expect(collector.payloads).To(HaveLen(2))
+		Expect(collector.metrics()).To(HaveLen(3))
+	})
+
+	It("should split payloads exceeding size limit", func() {
+		for i := 0; i < 200; i++ {
+			name := fmt.Sprintf("Custom/metric%d", i)
+			harvest.Metrics = append(harvest.Metrics, Metric{Name: name, BaseName: name, Value: float64(i)})
+		}
+		reporter.MaxPayloadSize = 1024
+		Expect(reporter.Report(harvest)).To(Succeed())
+		Expect(len(collector.payloads)).To(BeNumerically(">", 1))
+		for _, size := range collector.sizes {
+			Expect(size).To(BeNumerically("<=", 1024))
+		}
+		Expect(collector.metrics()).To(HaveLen(203))
+	})
+
+	It("should fail when single metric exceeds size limit", func() {
+		reporter.MaxPayloadSize = 10
+		harvest.Metrics = harvest.Metrics[:1]
+		Expect(reporter.Report(harvest)).To(MatchError(ContainSubstring("exceeds payload size limit")))
+	})
+
+	It("should report errors of both split halves", func() {
+		reporter.MaxPayloadSize = 10
+		harvest.Metrics = harvest.Metrics[:2]
+		err := reporter.Report(harvest)
+		Expect(err).To(MatchError(ContainSubstring("Runtime.General.NOGoroutines")))
+		Expect(err).To(MatchError(ContainSubstring("http.status")))
+	})
+
+	It("should return error on unsuccessful response", func() {
+		collector.status = http.StatusForbidden
+		Expect(reporter.Report(harvest)).To(MatchError(ContainSubstring("403")))
+		Expect(reporter.SentBytes()).To(BeZero())
+	})
+
+	It("should count bytes of sent payloads", func() {
+		Expect(reporter.Report(harvest)).To(Succeed())
+		Expect(reporter.SentBytes()).To(BeNumerically("==", collector.sizes[0]))
+	})
+})
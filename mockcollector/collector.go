@@ -0,0 +1,340 @@
+// Package mockcollector is a local stand-in for New Relic ingest endpoints: platform plugin API,
+// Metric API and Event (Insights insert) API. It checks keys and payload schemas, keeps received
+// payloads for inspection and can inject failures, latency and throttling.
+//
+//	server := mockcollector.NewServer()
+//	defer server.Close()
+//	agent, _ := gorelic.New(gorelic.WithLicense(license), gorelic.WithClient(server.Client()))
+package mockcollector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIs served by Collector
+const (
+	APIPlatform = "platform"
+	APIMetric   = "metric"
+	APIEvent    = "event"
+)
+
+// Paths of APIs, Event API path is /v1/accounts/<account id>/events
+const (
+	PlatformPath  = "/platform/v1/metrics"
+	MetricAPIPath = "/metric/v1"
+)
+
+const (
+	// DefaultMaxPayloads is the number of payloads kept by Collector
+	DefaultMaxPayloads = 1000
+	// maxBodySize is the limit of decompressed request body
+	maxBodySize = 10 << 20
+)
+
+var (
+	eventPathPattern = regexp.MustCompile(`^/v1/accounts/([0-9]+)/events$`)
+	eventTypePattern = regexp.MustCompile(`^[A-Za-z0-9_:]+$`)
+)
+
+// Collector is http.Handler implementing New Relic ingest APIs, JSON and web views of received payloads.
+// Zero value accepts any non empty key.
+type Collector struct {
+	// License is the only license key accepted by platform plugin and Metric APIs, empty accepts any key
+	License string
+	// InsertKey is the only key accepted by Event API, empty accepts any key
+	InsertKey string
+	// MaxPayloads is the number of kept payloads, the oldest ones are dropped. Zero means DefaultMaxPayloads.
+	MaxPayloads int
+
+	lock     sync.Mutex
+	payloads []Payload
+	lastID   int
+	faults   []*Fault
+}
+
+// New creates Collector accepting only license and insertKey, empty keys accept any key
+func New(license string, insertKey string) *Collector {
+	return &Collector{License: license, InsertKey: insertKey}
+}
+
+// Payload is a request received by Collector
+type Payload struct {
+	ID   int       `json:"id"`
+	Time time.Time `json:"time"`
+	API  string    `json:"api"`
+	Path string    `json:"path"`
+	// Key is license or insert key of request
+	Key string `json:"key"`
+	// Status is HTTP status of response, Error explains non 2xx ones
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Body is decompressed JSON body, Raw is set instead if body is not valid JSON
+	Body json.RawMessage `json:"body,omitempty"`
+	Raw  string          `json:"raw,omitempty"`
+}
+
+// Decode decodes Body into value, like PlatformPayload, []MetricAPIPayload or []map[string]interface{} of events
+func (payload Payload) Decode(value interface{}) error {
+	if payload.Body == nil {
+		return fmt.Errorf("payload %d has no JSON body", payload.ID)
+	}
+	return json.Unmarshal(payload.Body, value)
+}
+
+// Fault changes responses of matching requests
+type Fault struct {
+	// API is APIPlatform, APIMetric or APIEvent, empty matches all APIs
+	API string `json:"api,omitempty"`
+	// Status replaces response status, zero keeps normal handling
+	Status int `json:"status,omitempty"`
+	// Latency delays response
+	Latency time.Duration `json:"latency,omitempty"`
+	// RetryAfter is sent in Retry-After header in seconds, if positive
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// Count is the number of affected requests, zero affects all requests until ClearFaults
+	Count int `json:"count,omitempty"`
+}
+
+// InjectFault adds fault, the first matching fault is applied to request
+func (collector *Collector) InjectFault(fault Fault) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	collector.faults = append(collector.faults, &fault)
+}
+
+// ClearFaults removes all faults
+func (collector *Collector) ClearFaults() {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	collector.faults = nil
+}
+
+// Faults returns active faults, Count is the number of requests left
+func (collector *Collector) Faults() []Fault {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	faults := make([]Fault, 0, len(collector.faults))
+	for _, fault := range collector.faults {
+		faults = append(faults, *fault)
+	}
+	return faults
+}
+
+// takeFault returns fault for request of api and counts it
+func (collector *Collector) takeFault(api string) *Fault {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	for i, fault := range collector.faults {
+		if fault.API != "" && fault.API != api {
+			continue
+		}
+		taken := *fault
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				collector.faults = append(collector.faults[:i], collector.faults[i+1:]...)
+			}
+		}
+		return &taken
+	}
+	return nil
+}
+
+// Payloads returns received payloads of api, oldest first. Empty api means all APIs.
+func (collector *Collector) Payloads(api string) []Payload {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	payloads := make([]Payload, 0, len(collector.payloads))
+	for _, payload := range collector.payloads {
+		if api == "" || payload.API == api {
+			payloads = append(payloads, payload)
+		}
+	}
+	return payloads
+}
+
+// Payload returns payload by ID
+func (collector *Collector) Payload(id int) (Payload, bool) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	for _, payload := range collector.payloads {
+		if payload.ID == id {
+			return payload, true
+		}
+	}
+	return Payload{}, false
+}
+
+// Reset forgets received payloads
+func (collector *Collector) Reset() {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	collector.payloads = nil
+}
+
+func (collector *Collector) store(payload Payload) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	collector.lastID++
+	payload.ID = collector.lastID
+	max := collector.MaxPayloads
+	if max <= 0 {
+		max = DefaultMaxPayloads
+	}
+	collector.payloads = append(collector.payloads, payload)
+	if len(collector.payloads) > max {
+		collector.payloads = collector.payloads[len(collector.payloads)-max:]
+	}
+}
+
+// ServeHTTP implements http.Handler interface
+func (collector *Collector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.URL.Path == PlatformPath:
+		collector.ingest(w, req, APIPlatform, req.Header.Get("X-License-Key"), collector.License, validatePlatform)
+	case req.URL.Path == MetricAPIPath:
+		key := req.Header.Get("Api-Key")
+		if key == "" {
+			key = req.Header.Get("X-License-Key")
+		}
+		collector.ingest(w, req, APIMetric, key, collector.License, validateMetricAPI)
+	case eventPathPattern.MatchString(req.URL.Path):
+		collector.ingest(w, req, APIEvent, req.Header.Get("X-Insert-Key"), collector.InsertKey, validateEvents)
+	default:
+		collector.serveView(w, req)
+	}
+}
+
+// ingest handles request of api: applies faults, checks key and body, stores payload
+func (collector *Collector) ingest(w http.ResponseWriter, req *http.Request, api string, key string, expectedKey string, validate func(body []byte) error) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	payload := Payload{Time: time.Now(), API: api, Path: req.URL.Path, Key: key}
+	body, err := readBody(req)
+	if err == nil && json.Valid(body) {
+		payload.Body = body
+	} else {
+		payload.Raw = string(body)
+	}
+
+	status, response := http.StatusOK, interface{}(map[string]string{"status": "ok"})
+	if api == APIMetric {
+		status, response = http.StatusAccepted, map[string]string{"requestId": strconv.Itoa(int(payload.Time.UnixNano()))}
+	} else if api == APIEvent {
+		response = map[string]interface{}{"success": true}
+	}
+
+	fault := collector.takeFault(api)
+	if fault != nil && fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-req.Context().Done():
+		}
+	}
+	switch {
+	case fault != nil && fault.Status != 0:
+		status, payload.Error = fault.Status, "injected fault"
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(fault.RetryAfter))
+		}
+	case key == "" || (expectedKey != "" && key != expectedKey):
+		status, payload.Error = http.StatusForbidden, "invalid or missing key"
+	case err != nil:
+		status, payload.Error = http.StatusBadRequest, err.Error()
+	case !strings.HasPrefix(req.Header.Get("Content-Type"), "application/json"):
+		status, payload.Error = http.StatusUnsupportedMediaType, "Content-Type should be application/json"
+	default:
+		if err := validate(body); err != nil {
+			status, payload.Error = http.StatusBadRequest, err.Error()
+		}
+	}
+	payload.Status = status
+	collector.store(payload)
+	if payload.Error != "" {
+		response = map[string]string{"error": payload.Error}
+	}
+	writeJSON(w, status, response)
+}
+
+// readBody reads request body, decompressing gzip one
+func readBody(req *http.Request) ([]byte, error) {
+	var reader io.Reader = http.MaxBytesReader(nil, req.Body, maxBodySize)
+	switch req.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("can not decompress body: %v", err)
+		}
+		defer gzipReader.Close()
+		reader = io.LimitReader(gzipReader, maxBodySize+1)
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", req.Header.Get("Content-Encoding"))
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return body, fmt.Errorf("can not read body: %v", err)
+	}
+	if len(body) > maxBodySize {
+		return nil, fmt.Errorf("body exceeds %d bytes", maxBodySize)
+	}
+	return body, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	body, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// decodePayload decodes JSON of collector API. Unknown fields are ignored like real collector does,
+// required fields are checked by validators.
+func decodePayload(body []byte, value interface{}) error {
+	if err := json.Unmarshal(body, value); err != nil {
+		return fmt.Errorf("invalid payload: %v", err)
+	}
+	return nil
+}
+
+// decodeObject decodes JSON object which must have all required keys, other keys are ignored
+func decodeObject(body []byte, value interface{}, required ...string) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+	for _, key := range required {
+		if _, ok := fields[key]; !ok {
+			return fmt.Errorf("%s is missing", key)
+		}
+	}
+	return json.Unmarshal(body, value)
+}
+
+// decodeStrict decodes JSON rejecting unknown fields, it is used for requests of mock own API
+func decodeStrict(body []byte, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("invalid payload: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package mockcollector
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestMockcollector(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Mockcollector Suite")
+}
@@ -0,0 +1,145 @@
+package mockcollector
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/earlonrails/gorelic"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collector", func() {
+	license := "0123456789abcdef0123456789abcdef01234567"
+	var server *Server
+
+	post := func(path string, key string, body string) *http.Response {
+		req, _ := http.NewRequest("POST", server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-License-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp
+	}
+
+	BeforeEach(func() {
+		server = NewServer()
+		server.License = license
+		server.InsertKey = "insert-key"
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should receive platform plugin metrics", func() {
+		agent, err := gorelic.New(gorelic.WithLicense(license), gorelic.WithName("billing"), gorelic.WithClient(server.Client()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(agent.Run()).To(Succeed())
+		agent.HarvestNow()
+
+		payloads := server.Payloads(APIPlatform)
+		Expect(payloads).To(HaveLen(1))
+		Expect(payloads[0].Status).To(Equal(http.StatusOK), payloads[0].Error)
+		Expect(payloads[0].Key).To(Equal(license))
+		var payload PlatformPayload
+		Expect(payloads[0].Decode(&payload)).To(Succeed())
+		Expect(payload.Components[0].Name).To(Equal("billing"))
+		_, ok := payload.Components[0].Value("Component/Runtime/General/NOGoroutines[goroutines]")
+		Expect(ok).To(BeTrue())
+		Expect(agent.Stats().Reporters[0].Successes).To(Equal(int64(1)))
+	})
+
+	It("should receive Metric API metrics and events", func() {
+		metricAPI := gorelic.NewMetricAPIReporter(license)
+		metricAPI.Endpoint = server.MetricAPIEndpoint()
+		insights := gorelic.NewInsightsReporter("42", "insert-key")
+		insights.Endpoint = server.EventAPIEndpoint("42")
+		agent, err := gorelic.New(gorelic.WithReporter(metricAPI), gorelic.WithReporter(insights))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(agent.Run()).To(Succeed())
+		agent.Counter("jobs", "jobs").Inc(3)
+		Expect(agent.RecordEvent("Job", map[string]interface{}{"queue": "mail"})).To(Succeed())
+		agent.HarvestNow()
+
+		metrics := server.Payloads(APIMetric)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].Status).To(Equal(http.StatusAccepted), metrics[0].Error)
+		var metricPayloads []MetricAPIPayload
+		Expect(metrics[0].Decode(&metricPayloads)).To(Succeed())
+		Expect(metricPayloads[0].Metrics).NotTo(BeEmpty())
+
+		events := server.Payloads(APIEvent)
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Status).To(Equal(http.StatusOK), events[0].Error)
+		var eventPayloads []map[string]interface{}
+		Expect(events[0].Decode(&eventPayloads)).To(Succeed())
+		Expect(eventPayloads[0]).To(HaveKeyWithValue("eventType", "Job"))
+		Expect(eventPayloads[0]).To(HaveKeyWithValue("queue", "mail"))
+	})
+
+	It("should check keys and schemas", func() {
+		Expect(post(PlatformPath, "wrong-license", `{}`).StatusCode).To(Equal(http.StatusForbidden))
+		Expect(post(PlatformPath, license, `{"agent": {"host": "h", "version": "1"}, "components": []}`).StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(post(PlatformPath, license, `{"agent": {"host": "h", "version": "1"}, "components": [{"name": "n", "guid": "g", "duration": 60, "metrics": {"queue": 1}}]}`).StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(post(MetricAPIPath, license, `[{"metrics": [{"name": "jobs", "type": "count", "value": 1}]}]`).StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(post(MetricAPIPath, license, `[{"metrics": [{"name": "jobs", "type": "count", "value": 1, "interval.ms": 1000}]}]`).StatusCode).To(Equal(http.StatusAccepted))
+		Expect(post(MetricAPIPath, license, `[{"metrics": [{"name": "jobs", "type": "summary", "value": {"count": 1, "sum": 2}, "interval.ms": 1000}]}]`).StatusCode).To(Equal(http.StatusBadRequest))
+		// fields collector does not know are ignored, like URL field of some newrelic_platform_go versions
+		Expect(post(PlatformPath, license, `{"URL": "https://platform-api.newrelic.com", "agent": {"host": "h", "version": "1"}, "components": [{"name": "n", "guid": "g", "duration": 60, "metrics": {"Component/queue[items]": {"min": 1, "max": 2, "total": 3, "count": 2, "sum_of_squares": 5}}}]}`).StatusCode).To(Equal(http.StatusOK))
+		Expect(post("/v1/accounts/42/events", "", `[{"eventType": "Job"}]`).StatusCode).To(Equal(http.StatusForbidden))
+
+		payloads := server.Payloads("")
+		Expect(payloads).To(HaveLen(8))
+		Expect(payloads[2].Error).To(ContainSubstring(`"queue" should be like Component/<name>[<units>]`))
+		Expect(payloads[3].Error).To(ContainSubstring("requires interval.ms"))
+	})
+
+	It("should inject faults", func() {
+		server.InjectFault(Fault{API: APIMetric, Status: http.StatusTooManyRequests, RetryAfter: 5, Count: 1})
+		server.InjectFault(Fault{Latency: 50 * time.Millisecond, Count: 1})
+
+		req, _ := http.NewRequest("POST", server.MetricAPIEndpoint(), strings.NewReader(`[]`))
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(resp.Header.Get("Retry-After")).To(Equal("5"))
+
+		startTime := time.Now()
+		post(PlatformPath, "wrong-license", `{}`)
+		Expect(time.Since(startTime)).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(server.Faults()).To(BeEmpty())
+
+		resp = post("/faults", "", `{"api": "event", "status": 503, "latency": "1ms"}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		Expect(server.Faults()).To(Equal([]Fault{{API: APIEvent, Status: 503, Latency: time.Millisecond}}))
+	})
+
+	It("should show payloads", func() {
+		post(MetricAPIPath, license, `[{"metrics": [{"name": "jobs", "value": 1}]}]`)
+		post(MetricAPIPath, license, `not json`)
+
+		resp, err := http.Get(server.URL + "/payloads?api=metric")
+		Expect(err).NotTo(HaveOccurred())
+		var payloads []Payload
+		Expect(json.NewDecoder(resp.Body).Decode(&payloads)).To(Succeed())
+		resp.Body.Close()
+		Expect(payloads).To(HaveLen(2))
+		Expect(payloads[1].Raw).To(Equal("not json"))
+
+		resp, err = http.Get(server.URL + "/")
+		Expect(err).NotTo(HaveOccurred())
+		page, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		Expect(string(page)).To(ContainSubstring(`&#34;name&#34;: &#34;jobs&#34;`))
+
+		req, _ := http.NewRequest("DELETE", server.URL+"/payloads", nil)
+		_, err = http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.Payloads("")).To(BeEmpty())
+	})
+})
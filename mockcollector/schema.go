@@ -0,0 +1,199 @@
+package mockcollector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PlatformPayload is request body of platform plugin API
+type PlatformPayload struct {
+	Agent      PlatformAgent       `json:"agent"`
+	Components []PlatformComponent `json:"components"`
+}
+
+// PlatformAgent describes reporting process
+type PlatformAgent struct {
+	Host    string `json:"host"`
+	Version string `json:"version"`
+	Pid     int    `json:"pid"`
+}
+
+// PlatformComponent holds metrics of component, keys are like "Component/http/requests[count]".
+// Values are numbers or aggregated values.
+type PlatformComponent struct {
+	Name     string                     `json:"name"`
+	GUID     string                     `json:"guid"`
+	Duration int                        `json:"duration"`
+	Metrics  map[string]json.RawMessage `json:"metrics"`
+}
+
+// PlatformAggregatedValue is metric value aggregated from several values
+type PlatformAggregatedValue struct {
+	Min          float64 `json:"min"`
+	Max          float64 `json:"max"`
+	Total        float64 `json:"total"`
+	Count        int     `json:"count"`
+	SumOfSquares float64 `json:"sum_of_squares"`
+}
+
+// Value returns metric value, aggregated values are reported as their total
+func (component PlatformComponent) Value(name string) (float64, bool) {
+	raw, ok := component.Metrics[name]
+	if !ok {
+		return 0, false
+	}
+	var value float64
+	if json.Unmarshal(raw, &value) == nil {
+		return value, true
+	}
+	var aggregated PlatformAggregatedValue
+	if json.Unmarshal(raw, &aggregated) == nil {
+		return aggregated.Total, true
+	}
+	return 0, false
+}
+
+// MetricAPIPayload is element of Metric API request body
+type MetricAPIPayload struct {
+	Common  *MetricAPICommon  `json:"common,omitempty"`
+	Metrics []MetricAPIMetric `json:"metrics"`
+}
+
+// MetricAPICommon is applied to all metrics of payload element
+type MetricAPICommon struct {
+	Timestamp  int64                  `json:"timestamp,omitempty"`
+	IntervalMs int64                  `json:"interval.ms,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// MetricAPIMetric is single metric of Metric API, Value is a number or summary object
+type MetricAPIMetric struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type,omitempty"`
+	Value      json.RawMessage        `json:"value"`
+	Timestamp  int64                  `json:"timestamp,omitempty"`
+	IntervalMs int64                  `json:"interval.ms,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// MetricAPISummary is value of summary metric
+type MetricAPISummary struct {
+	Count float64 `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// validatePlatform checks platform plugin API payload
+func validatePlatform(body []byte) error {
+	var payload PlatformPayload
+	if err := decodePayload(body, &payload); err != nil {
+		return err
+	}
+	if payload.Agent.Host == "" {
+		return errors.New("agent.host: must not be empty")
+	}
+	if payload.Agent.Version == "" {
+		return errors.New("agent.version: must not be empty")
+	}
+	if len(payload.Components) == 0 {
+		return errors.New("components: must not be empty")
+	}
+	for i, component := range payload.Components {
+		if component.Name == "" {
+			return fmt.Errorf("components[%d].name: must not be empty", i)
+		}
+		if component.GUID == "" {
+			return fmt.Errorf("components[%d].guid: must not be empty", i)
+		}
+		if component.Duration < 0 {
+			return fmt.Errorf("components[%d].duration: must not be negative, got %d", i, component.Duration)
+		}
+		for name, raw := range component.Metrics {
+			if !strings.HasPrefix(name, "Component/") || !strings.HasSuffix(name, "]") || !strings.Contains(name, "[") {
+				return fmt.Errorf("components[%d].metrics: %q should be like Component/<name>[<units>]", i, name)
+			}
+			var value float64
+			var aggregated PlatformAggregatedValue
+			if json.Unmarshal(raw, &value) != nil && decodeObject(raw, &aggregated, "min", "max", "total", "count", "sum_of_squares") != nil {
+				return fmt.Errorf("components[%d].metrics: %q should be a number or aggregated value", i, name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateMetricAPI checks Metric API payload
+func validateMetricAPI(body []byte) error {
+	var payloads []MetricAPIPayload
+	if err := decodePayload(body, &payloads); err != nil {
+		return err
+	}
+	if len(payloads) == 0 {
+		return errors.New("payload must not be empty")
+	}
+	for i, payload := range payloads {
+		for j, metric := range payload.Metrics {
+			path := fmt.Sprintf("[%d].metrics[%d]", i, j)
+			if metric.Name == "" {
+				return fmt.Errorf("%s.name: must not be empty", path)
+			}
+			intervalMs := metric.IntervalMs
+			if intervalMs == 0 && payload.Common != nil {
+				intervalMs = payload.Common.IntervalMs
+			}
+			var number float64
+			var summary MetricAPISummary
+			switch metric.Type {
+			case "", "gauge":
+				if json.Unmarshal(metric.Value, &number) != nil {
+					return fmt.Errorf("%s.value: gauge %s should be a number", path, metric.Name)
+				}
+			case "count":
+				if json.Unmarshal(metric.Value, &number) != nil {
+					return fmt.Errorf("%s.value: count %s should be a number", path, metric.Name)
+				}
+				if intervalMs <= 0 {
+					return fmt.Errorf("%s: count %s requires interval.ms", path, metric.Name)
+				}
+			case "summary":
+				if decodeObject(metric.Value, &summary, "count", "sum", "min", "max") != nil {
+					return fmt.Errorf("%s.value: summary %s should have count, sum, min and max", path, metric.Name)
+				}
+				if intervalMs <= 0 {
+					return fmt.Errorf("%s: summary %s requires interval.ms", path, metric.Name)
+				}
+			default:
+				return fmt.Errorf("%s.type: unknown type %q of %s", path, metric.Type, metric.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateEvents checks Event API payload
+func validateEvents(body []byte) error {
+	var events []map[string]interface{}
+	if err := decodePayload(body, &events); err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return errors.New("payload must not be empty")
+	}
+	for i, event := range events {
+		eventType, _ := event["eventType"].(string)
+		if !eventTypePattern.MatchString(eventType) {
+			return fmt.Errorf("[%d].eventType: %q should be letters, digits, _ or :", i, eventType)
+		}
+		for key, value := range event {
+			switch value.(type) {
+			case string, float64, bool:
+			default:
+				return fmt.Errorf("[%d].%s: should be a string, number or boolean", i, key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package mockcollector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+)
+
+// Server is Collector listening on local address, for tests
+type Server struct {
+	*Collector
+	// URL is base URL of server, like http://127.0.0.1:41234
+	URL    string
+	server *httptest.Server
+}
+
+// NewServer starts Server accepting any key, set License and InsertKey of Collector to check keys
+func NewServer() *Server {
+	collector := New("", "")
+	server := httptest.NewServer(collector)
+	return &Server{Collector: collector, URL: server.URL, server: server}
+}
+
+// Close shuts server down
+func (server *Server) Close() {
+	server.server.Close()
+}
+
+// Client returns HTTP client sending all requests to server, whatever their host is.
+// Pass it to gorelic.WithClient, so platform plugin reporter sends metrics to server.
+func (server *Server) Client() http.Client {
+	return http.Client{Transport: NewTransport(server.URL, nil)}
+}
+
+// MetricAPIEndpoint returns Endpoint for gorelic.MetricAPIReporter
+func (server *Server) MetricAPIEndpoint() string {
+	return server.URL + MetricAPIPath
+}
+
+// EventAPIEndpoint returns Endpoint for gorelic.InsightsReporter
+func (server *Server) EventAPIEndpoint(accountID string) string {
+	return server.URL + "/v1/accounts/" + accountID + "/events"
+}
+
+// redirectTransport sends requests to collector keeping their paths
+type redirectTransport struct {
+	target    *url.URL
+	transport http.RoundTripper
+}
+
+// NewTransport returns RoundTripper sending all requests to collector at baseURL keeping their paths,
+// so New Relic endpoints could be replaced without changing reporters. Nil transport means http.DefaultTransport.
+func NewTransport(baseURL string, transport http.RoundTripper) http.RoundTripper {
+	target, err := url.Parse(baseURL)
+	if err != nil || target.Host == "" {
+		panic("mockcollector: invalid collector URL " + baseURL)
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &redirectTransport{target: target, transport: transport}
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	redirected := req.Clone(req.Context())
+	redirected.URL.Scheme = t.target.Scheme
+	redirected.URL.Host = t.target.Host
+	redirected.Host = t.target.Host
+	return t.transport.RoundTrip(redirected)
+}
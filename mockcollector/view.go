@@ -0,0 +1,152 @@
+package mockcollector
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// faultRequest is Fault in JSON view, latency is a duration string like "250ms"
+type faultRequest struct {
+	API        string `json:"api,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	Latency    string `json:"latency,omitempty"`
+	RetryAfter int    `json:"retryAfter,omitempty"`
+	Count      int    `json:"count,omitempty"`
+}
+
+// serveView serves inspection and control endpoints:
+//
+//	GET    /                 web page with received payloads and faults
+//	GET    /payloads[?api=]  received payloads as JSON
+//	GET    /payloads/<id>    single payload
+//	DELETE /payloads         forget payloads
+//	GET    /faults           active faults
+//	POST   /faults           inject fault, like {"api": "platform", "status": 429, "retryAfter": 5, "count": 1}
+//	DELETE /faults           clear faults
+func (collector *Collector) serveView(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	switch {
+	case path == "" && req.Method == http.MethodGet:
+		collector.servePage(w)
+	case path == "/payloads" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, collector.Payloads(req.URL.Query().Get("api")))
+	case path == "/payloads" && req.Method == http.MethodDelete:
+		collector.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(path, "/payloads/") && req.Method == http.MethodGet:
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "/payloads/"))
+		payload, ok := collector.Payload(id)
+		if err != nil || !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "payload not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, payload)
+	case path == "/faults" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, faultRequests(collector.Faults()))
+	case path == "/faults" && req.Method == http.MethodPost:
+		var request faultRequest
+		if err := decodeStrict(readAll(req), &request); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		fault := Fault{API: request.API, Status: request.Status, RetryAfter: request.RetryAfter, Count: request.Count}
+		if request.Latency != "" {
+			latency, err := time.ParseDuration(request.Latency)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "latency: " + err.Error()})
+				return
+			}
+			fault.Latency = latency
+		}
+		collector.InjectFault(fault)
+		writeJSON(w, http.StatusCreated, faultRequests([]Fault{fault})[0])
+	case path == "/faults" && req.Method == http.MethodDelete:
+		collector.ClearFaults()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+func faultRequests(faults []Fault) []faultRequest {
+	requests := make([]faultRequest, 0, len(faults))
+	for _, fault := range faults {
+		request := faultRequest{API: fault.API, Status: fault.Status, RetryAfter: fault.RetryAfter, Count: fault.Count}
+		if fault.Latency > 0 {
+			request.Latency = fault.Latency.String()
+		}
+		requests = append(requests, request)
+	}
+	return requests
+}
+
+func readAll(req *http.Request) []byte {
+	var body bytes.Buffer
+	body.ReadFrom(http.MaxBytesReader(nil, req.Body, maxBodySize))
+	return body.Bytes()
+}
+
+// pagePayload is Payload shown on web page
+type pagePayload struct {
+	Payload
+	Body string
+}
+
+func (collector *Collector) servePage(w http.ResponseWriter) {
+	payloads := collector.Payloads("")
+	shown := make([]pagePayload, 0, len(payloads))
+	for i := len(payloads) - 1; i >= 0; i-- {
+		payload := payloads[i]
+		body := payload.Raw
+		var indented bytes.Buffer
+		if payload.Body != nil && json.Indent(&indented, payload.Body, "", "  ") == nil {
+			body = indented.String()
+		}
+		shown = append(shown, pagePayload{payload, body})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	pageTemplate.Execute(w, map[string]interface{}{
+		"Payloads": shown,
+		"Faults":   faultRequests(collector.Faults()),
+	})
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>gorelic mock collector</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+pre { margin: 0; max-height: 30em; overflow: auto; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>gorelic mock collector</h1>
+<p><a href="/payloads">payloads JSON</a> · <a href="/faults">faults JSON</a></p>
+<h2>Faults</h2>
+{{if .Faults}}<table>
+<tr><th>API</th><th>Status</th><th>Latency</th><th>Retry-After</th><th>Requests left</th></tr>
+{{range .Faults}}<tr><td>{{or .API "all"}}</td><td>{{.Status}}</td><td>{{.Latency}}</td><td>{{.RetryAfter}}</td><td>{{if .Count}}{{.Count}}{{else}}all{{end}}</td></tr>
+{{end}}</table>{{else}}<p>No faults.</p>{{end}}
+<h2>Payloads</h2>
+{{if .Payloads}}<table>
+<tr><th>ID</th><th>Time</th><th>API</th><th>Status</th><th>Body</th></tr>
+{{range .Payloads}}<tr>
+<td><a href="/payloads/{{.ID}}">{{.ID}}</a></td>
+<td>{{.Time.Format "15:04:05.000"}}</td>
+<td>{{.API}}</td>
+<td>{{.Status}}{{if .Error}}<div class="error">{{.Error}}</div>{{end}}</td>
+<td><pre>{{.Body}}</pre></td>
+</tr>
+{{end}}</table>{{else}}<p>Nothing received yet.</p>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,370 @@
+package gorelic
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+// Option configures Agent created with New
+type Option func(agent *Agent) error
+
+var (
+	licensePattern   = regexp.MustCompile(`^[0-9A-Za-z]{40}$`)
+	agentGUIDPattern = regexp.MustCompile(`^[0-9A-Za-z_-]+(\.[0-9A-Za-z_-]+)+$`)
+)
+
+// maxAgentNameLength is the longest component name accepted by NewRelic
+const maxAgentNameLength = 255
+
+// New creates Agent with default settings changed by options. Settings are validated with Validate,
+// so invalid license, name, GUID, intervals or reporters are reported before Run.
+//
+//	agent, err := gorelic.New(gorelic.WithLicense(license), gorelic.WithHTTPStat(true))
+func New(opts ...Option) (*Agent, error) {
+	agent := NewAgent()
+	for _, opt := range opts {
+		if err := opt(agent); err != nil {
+			return nil, err
+		}
+	}
+	if err := agent.Validate(); err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
+
+// Validate checks all settings of agent. Run does the same checks, except format of license key.
+func (agent *Agent) Validate() error {
+	if agent.NewrelicLicense != "" && !licensePattern.MatchString(agent.NewrelicLicense) {
+		return errors.New("NewrelicLicense: must be 40 letters and digits")
+	}
+	return agent.validate()
+}
+
+// validate checks settings which break agent locally
+func (agent *Agent) validate() error {
+	if agent.NewrelicLicense == "" && len(agent.Reporters) == 0 {
+		return errors.New("please, pass a valid newrelic license key")
+	}
+	name := strings.TrimSpace(agent.NewrelicName)
+	if name == "" {
+		return errors.New("NewrelicName: must not be empty")
+	}
+	if len(name) > maxAgentNameLength {
+		return fmt.Errorf("NewrelicName: must be at most %d characters", maxAgentNameLength)
+	}
+	if !agentGUIDPattern.MatchString(agent.AgentGUID) {
+		return fmt.Errorf("AgentGUID: %q should be dot separated identifier, like %q", agent.AgentGUID, DefaultAgentGuid)
+	}
+	intervals := []struct {
+		name  string
+		value int
+	}{
+		{"NewrelicPollInterval", agent.NewrelicPollInterval},
+		{"GCPollInterval", agent.GCPollInterval},
+		{"MemoryAllocatorPollInterval", agent.MemoryAllocatorPollInterval},
+		{"SystemPollInterval", agent.SystemPollInterval},
+	}
+	for _, interval := range intervals {
+		if interval.value <= 0 {
+			return fmt.Errorf("%s: must be positive, got %d", interval.name, interval.value)
+		}
+	}
+	if agent.MaxEventsPerHarvest < 0 {
+		return fmt.Errorf("MaxEventsPerHarvest: must not be negative, got %d", agent.MaxEventsPerHarvest)
+	}
+	if agent.DatastoreMaxQueries < 0 {
+		return fmt.Errorf("DatastoreMaxQueries: must not be negative, got %d", agent.DatastoreMaxQueries)
+	}
+	if agent.ExternalMaxDestinations < 0 {
+		return fmt.Errorf("ExternalMaxDestinations: must not be negative, got %d", agent.ExternalMaxDestinations)
+	}
+	for key := range agent.Labels {
+		if key == "" {
+			return errors.New("Labels: label name must not be empty")
+		}
+	}
+	for i, reporter := range agent.Reporters {
+		if reporter == nil {
+			return fmt.Errorf("Reporters[%d]: must not be nil", i)
+		}
+		if validator, ok := reporter.(interface{ Validate() error }); ok {
+			if err := validator.Validate(); err != nil {
+				return fmt.Errorf("Reporters[%d] %s: %v", i, reporterName(reporter, i, agent.Reporters), err)
+			}
+		}
+	}
+	return nil
+}
+
+// seconds converts option interval to whole seconds
+func seconds(option string, interval time.Duration) (int, error) {
+	if interval < time.Second {
+		return 0, fmt.Errorf("%s: interval should be at least 1s, got %v", option, interval)
+	}
+	return int(interval / time.Second), nil
+}
+
+// WithLicense sets NewRelic license key, NewRelic reporter is used only if it is set
+func WithLicense(license string) Option {
+	return func(agent *Agent) error {
+		agent.NewrelicLicense = license
+		return nil
+	}
+}
+
+// WithName sets component name in NewRelic dashboard
+func WithName(name string) Option {
+	return func(agent *Agent) error {
+		agent.NewrelicName = name
+		return nil
+	}
+}
+
+// WithPollInterval sets how often metrics are harvested and reported, in whole seconds
+func WithPollInterval(interval time.Duration) Option {
+	return func(agent *Agent) (err error) {
+		agent.NewrelicPollInterval, err = seconds("WithPollInterval", interval)
+		return err
+	}
+}
+
+// WithVerbose enables debug messages of default logger
+func WithVerbose(verbose bool) Option {
+	return func(agent *Agent) error {
+		agent.Verbose = verbose
+		return nil
+	}
+}
+
+// WithLogger sets logger of agent and reporters messages
+func WithLogger(logger Logger) Option {
+	return func(agent *Agent) error {
+		agent.Logger = logger
+		return nil
+	}
+}
+
+// WithClock sets clock of harvest loop, collectors, counters and timers, nil means SystemClock
+func WithClock(clock Clock) Option {
+	return func(agent *Agent) error {
+		agent.Clock = clock
+		return nil
+	}
+}
+
+// WithGCStat enables garbage collector metrics collected every interval
+func WithGCStat(enabled bool, interval time.Duration) Option {
+	return func(agent *Agent) (err error) {
+		agent.CollectGcStat = enabled
+		if enabled {
+			agent.GCPollInterval, err = seconds("WithGCStat", interval)
+		}
+		return err
+	}
+}
+
+// WithMemoryStat enables memory allocator metrics collected every interval
+func WithMemoryStat(enabled bool, interval time.Duration) Option {
+	return func(agent *Agent) (err error) {
+		agent.CollectMemoryStat = enabled
+		if enabled {
+			agent.MemoryAllocatorPollInterval, err = seconds("WithMemoryStat", interval)
+		}
+		return err
+	}
+}
+
+// WithHTTPStat enables HTTP metrics, it is enabled by WrapHTTPHandler and WrapHTTPHandlerFunc as well
+func WithHTTPStat(enabled bool) Option {
+	return func(agent *Agent) error {
+		agent.CollectHTTPStat = enabled
+		return nil
+	}
+}
+
+// WithContainerStat enables cgroup metrics read from cgroupRoot, empty root means DefaultCgroupRoot
+func WithContainerStat(enabled bool, cgroupRoot string) Option {
+	return func(agent *Agent) error {
+		agent.CollectContainerStat = enabled
+		if cgroupRoot != "" {
+			agent.CgroupRoot = cgroupRoot
+		}
+		return nil
+	}
+}
+
+// WithHostStat enables host metrics, filesystem usage is reported for mountPoints or DefaultHostMountPoints
+func WithHostStat(enabled bool, mountPoints ...string) Option {
+	return func(agent *Agent) error {
+		agent.CollectHostStat = enabled
+		if len(mountPoints) > 0 {
+			agent.HostMountPoints = append([]string(nil), mountPoints...)
+		}
+		return nil
+	}
+}
+
+// WithSocketStat enables TCP sockets metrics of the process
+func WithSocketStat(enabled bool) Option {
+	return func(agent *Agent) error {
+		agent.CollectSocketStat = enabled
+		return nil
+	}
+}
+
+// WithSystemPollInterval sets how often process and socket statistic is read
+func WithSystemPollInterval(interval time.Duration) Option {
+	return func(agent *Agent) (err error) {
+		agent.SystemPollInterval, err = seconds("WithSystemPollInterval", interval)
+		return err
+	}
+}
+
+// WithProcRoot sets where proc and sys filesystems are mounted, empty values keep defaults
+func WithProcRoot(procRoot string, sysRoot string) Option {
+	return func(agent *Agent) error {
+		if procRoot != "" {
+			agent.ProcRoot = procRoot
+		}
+		if sysRoot != "" {
+			agent.SysRoot = sysRoot
+		}
+		return nil
+	}
+}
+
+// WithExpvarStat enables expvar metrics. Nil patterns keep defaults, patterns are validated by Run.
+func WithExpvarStat(enabled bool, include []string, exclude []string, deltas []string) Option {
+	return func(agent *Agent) error {
+		agent.CollectExpvarStat = enabled
+		if include != nil {
+			agent.ExpvarInclude = include
+		}
+		if exclude != nil {
+			agent.ExpvarExclude = exclude
+		}
+		if deltas != nil {
+			agent.ExpvarDeltas = deltas
+		}
+		if enabled {
+			if _, err := newExpvarSource(agent.ExpvarInclude, agent.ExpvarExclude, agent.ExpvarDeltas); err != nil {
+				return fmt.Errorf("WithExpvarStat: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// WithAgentGUID sets plugin GUID and version, change it only for your own plugin
+func WithAgentGUID(guid string, version string) Option {
+	return func(agent *Agent) error {
+		agent.AgentGUID = guid
+		if version != "" {
+			agent.AgentVersion = version
+		}
+		return nil
+	}
+}
+
+// WithLabels adds global labels of all metrics
+func WithLabels(labels map[string]string) Option {
+	return func(agent *Agent) error {
+		for key, value := range labels {
+			agent.Labels[key] = value
+		}
+		return nil
+	}
+}
+
+// WithMetadata adds key/value pairs attached to every harvest
+func WithMetadata(metadata map[string]string) Option {
+	return func(agent *Agent) error {
+		for key, value := range metadata {
+			agent.Metadata[key] = value
+		}
+		return nil
+	}
+}
+
+// WithReporter adds reporter harvested metrics are sent to
+func WithReporter(reporter MetricsReporter) Option {
+	return func(agent *Agent) error {
+		if reporter == nil {
+			return errors.New("WithReporter: reporter must not be nil")
+		}
+		agent.AddReporter(reporter)
+		return nil
+	}
+}
+
+// WithCustomMetric adds metric collected on every harvest
+func WithCustomMetric(metric nrpg.IMetrica) Option {
+	return func(agent *Agent) error {
+		if metric == nil {
+			return errors.New("WithCustomMetric: metric must not be nil")
+		}
+		agent.AddCustomMetric(metric)
+		return nil
+	}
+}
+
+// WithMaxEventsPerHarvest sets how many events are kept per harvest
+func WithMaxEventsPerHarvest(max int) Option {
+	return func(agent *Agent) error {
+		agent.MaxEventsPerHarvest = max
+		return nil
+	}
+}
+
+// WithAutoRecordDeployment records deployment on start if build revision changed,
+// revision is persisted to revisionFile, empty one means default location
+func WithAutoRecordDeployment(enabled bool, revisionFile string) Option {
+	return func(agent *Agent) error {
+		agent.AutoRecordDeployment = enabled
+		agent.DeploymentRevisionFile = revisionFile
+		return nil
+	}
+}
+
+// WithStatusRedactSecrets sets if StatusHandler hides license and reporters keys
+func WithStatusRedactSecrets(redact bool) Option {
+	return func(agent *Agent) error {
+		agent.StatusRedactSecrets = redact
+		return nil
+	}
+}
+
+// WithDatastoreQueryMetrics sets if drivers wrapped later with WrapDriver or WrapConnector report metrics
+// per normalized query template, at most maxQueries templates per datastore, zero means DefaultDatastoreMaxQueries
+func WithDatastoreQueryMetrics(enabled bool, maxQueries int) Option {
+	return func(agent *Agent) error {
+		agent.DatastoreQueryMetrics = enabled
+		if maxQueries != 0 {
+			agent.DatastoreMaxQueries = maxQueries
+		}
+		return nil
+	}
+}
+
+// WithClient sets HTTP client of NewRelic reporter, change it if you need to use a proxy
+func WithClient(client http.Client) Option {
+	return func(agent *Agent) error {
+		agent.Client = client
+		return nil
+	}
+}
+
+// WithConfigFile applies JSON or YAML config file and environment variables, see LoadConfig.
+// Empty path means environment variables only.
+func WithConfigFile(path string) Option {
+	return func(agent *Agent) error {
+		return agent.LoadConfig(path)
+	}
+}
@@ -0,0 +1,100 @@
+package gorelic
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("New", func() {
+	license := "0123456789abcdef0123456789abcdef01234567"
+
+	It("should apply options", func() {
+		reporter := &recordingReporter{}
+		agent, err := New(
+			WithLicense(license),
+			WithName("billing"),
+			WithPollInterval(30*time.Second),
+			WithGCStat(true, 5*time.Second),
+			WithMemoryStat(false, 0),
+			WithHTTPStat(true),
+			WithHostStat(true, "/", "/data"),
+			WithLabels(map[string]string{"env": "prod"}),
+			WithReporter(reporter),
+			WithStatusRedactSecrets(false),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(agent.NewrelicLicense).To(Equal(license))
+		Expect(agent.NewrelicName).To(Equal("billing"))
+		Expect(agent.NewrelicPollInterval).To(Equal(30))
+		Expect(agent.GCPollInterval).To(Equal(5))
+		Expect(agent.CollectMemoryStat).To(BeFalse())
+		Expect(agent.MemoryAllocatorPollInterval).To(Equal(DefaultMemoryAllocatorPollIntervalInSeconds))
+		Expect(agent.CollectHTTPStat).To(BeTrue())
+		Expect(agent.HostMountPoints).To(Equal([]string{"/", "/data"}))
+		Expect(agent.Labels).To(Equal(map[string]string{"env": "prod"}))
+		Expect(agent.Reporters).To(Equal([]MetricsReporter{reporter}))
+		Expect(agent.StatusRedactSecrets).To(BeFalse())
+	})
+
+	It("should reject invalid options", func() {
+		_, err := New(WithLicense(license), WithGCStat(true, 0))
+		Expect(err).To(MatchError("WithGCStat: interval should be at least 1s, got 0s"))
+
+		_, err = New(WithLicense(license), WithExpvarStat(true, []string{"["}, nil, nil))
+		Expect(err).To(MatchError(ContainSubstring("WithExpvarStat")))
+
+		_, err = New(WithReporter(nil))
+		Expect(err).To(MatchError("WithReporter: reporter must not be nil"))
+	})
+
+	It("should validate settings", func() {
+		_, err := New()
+		Expect(err).To(MatchError("please, pass a valid newrelic license key"))
+
+		_, err = New(WithLicense("YOUR NEWRELIC LICENSE KEY THERE"))
+		Expect(err).To(MatchError("NewrelicLicense: must be 40 letters and digits"))
+
+		_, err = New(WithLicense(license), WithName(" "))
+		Expect(err).To(MatchError("NewrelicName: must not be empty"))
+
+		_, err = New(WithLicense(license), WithAgentGUID("GoRelic", ""))
+		Expect(err).To(MatchError(ContainSubstring("AgentGUID")))
+
+		_, err = New(WithLicense(license), WithMaxEventsPerHarvest(-1))
+		Expect(err).To(MatchError("MaxEventsPerHarvest: must not be negative, got -1"))
+
+		_, err = New(WithLicense(license), WithDatastoreQueryMetrics(true, -1))
+		Expect(err).To(MatchError("DatastoreMaxQueries: must not be negative, got -1"))
+
+		_, err = New(WithReporter(NewMetricAPIReporter("")))
+		Expect(err).To(MatchError("Reporters[0] MetricAPIReporter: License: must not be empty"))
+
+		_, err = New(WithReporter(NewInfluxDBAnnotationReporter("influx:8086", "events")))
+		Expect(err).To(MatchError(ContainSubstring("Reporters[0] InfluxDBAnnotationReporter: URL")))
+	})
+
+	Describe("Run", func() {
+		It("should validate intervals", func() {
+			agent := NewAgent()
+			agent.AddReporter(&recordingReporter{})
+			agent.GCPollInterval = 0
+			Expect(agent.Run()).To(MatchError("GCPollInterval: must be positive, got 0"))
+		})
+
+		It("should make configuration immutable", func() {
+			reporter := &recordingReporter{}
+			agent, err := New(WithReporter(reporter), WithLabels(map[string]string{"env": "prod"}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(agent.Run()).To(Succeed())
+			Expect(agent.Run()).To(MatchError("agent is already running"))
+
+			agent.Labels["env"] = "dev"
+			agent.AddReporter(&recordingReporter{})
+			agent.harvest()
+			Expect(reporter.harvests[0].Labels).To(Equal(map[string]string{"env": "prod"}))
+			Expect(agent.Stats().Reporters).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,153 @@
+package gorelic
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+// platformReporter sends metrics to NewRelic platform plugin API using newrelic_platform_go.
+type platformReporter struct {
+	name      string
+	guid      string
+	verbose   bool
+	plugin    *nrpg.NewrelicPlugin
+	transport *countingTransport
+	// unsent are counts collector did not take, they are added to counts of the next report
+	unsent map[string]Metric
+}
+
+func newPlatformReporter(name string, guid string, version string, license string, pollInterval int, client http.Client, verbose bool) *platformReporter {
+	transport := &countingTransport{transport: client.Transport}
+	client.Transport = transport
+	plugin := nrpg.NewNewrelicPlugin(version, license, pollInterval)
+	plugin.Client = client
+	plugin.Verbose = verbose
+
+	return &platformReporter{
+		name:      name,
+		guid:      guid,
+		verbose:   verbose,
+		plugin:    plugin,
+		transport: transport,
+	}
+}
+
+// Reporter interface implementation.
+// Harvested values are wrapped into metricas of a new component, plugin aggregates values with the same name.
+// Counts collector did not take are added to the next report, like newrelic_platform_go does with
+// components it keeps on failure. Plugin extends duration of the next report itself.
+func (reporter *platformReporter) Report(harvest *Harvest) error {
+	component := nrpg.NewPluginComponent(reporter.name, reporter.guid, reporter.verbose)
+	unsent := reporter.unsent
+	counts := make(map[string]Metric)
+	add := func(key string, metric Metric) {
+		component.AddMetrica(&harvestedMetrica{metric})
+		if metric.Type != CountMetric {
+			return
+		}
+		if count, ok := counts[key]; ok {
+			metric.Value += count.Value
+		}
+		counts[key] = metric
+	}
+	for _, metric := range harvest.Metrics {
+		if !platformReported(metric) {
+			continue
+		}
+		key := reporter.plugin.GetMetricaKey(&harvestedMetrica{metric})
+		if previous, ok := unsent[key]; ok && metric.Type == CountMetric {
+			metric.Value += previous.Value
+			delete(unsent, key)
+		}
+		add(key, metric)
+	}
+	// counts which are not harvested this time
+	keys := make([]string, 0, len(unsent))
+	for key := range unsent {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		add(key, unsent[key])
+	}
+
+	reporter.plugin.ComponentModels = []nrpg.IComponent{component}
+	err := reporter.plugin.Harvest()
+	if err != nil {
+		if status := reporter.transport.status(); status >= 400 {
+			err = &httpStatusError{nrpg.NEWRELIC_API_URL, http.StatusText(status), status, strings.TrimSpace(err.Error())}
+		}
+	}
+	if platformDataSent(err) {
+		reporter.unsent = nil
+	} else {
+		reporter.unsent = counts
+	}
+	return err
+}
+
+// platformReported tells whether metric is sent to NewRelic platform.
+// Summary statistics are reported as separate metrics, dimensional metrics are left to dimensional reporters.
+func platformReported(metric Metric) bool {
+	return metric.Type != SummaryMetric && !metric.dimensional
+}
+
+// platformDataSent tells whether collector accepted or discarded reported data, so it should not be sent again.
+// Collector discards too large payloads, other failures keep data for the next harvest.
+func platformDataSent(err error) bool {
+	if err == nil {
+		return true
+	}
+	statusErr, ok := err.(*httpStatusError)
+	return ok && statusErr.code == http.StatusRequestEntityTooLarge
+}
+
+// PayloadReporter interface implementation
+func (reporter *platformReporter) SentBytes() int64 {
+	return atomic.LoadInt64(&reporter.transport.sentBytes)
+}
+
+// countingTransport counts size of requests collector accepted and keeps status code of last response
+type countingTransport struct {
+	// atomic counters are first to be 64-bit aligned on 32-bit platforms
+	sentBytes  int64
+	lastStatus int64
+	transport  http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+		if status < 300 && req.ContentLength > 0 {
+			atomic.AddInt64(&t.sentBytes, req.ContentLength)
+		}
+	}
+	atomic.StoreInt64(&t.lastStatus, int64(status))
+	return resp, err
+}
+
+func (t *countingTransport) status() int {
+	return int(atomic.LoadInt64(&t.lastStatus))
+}
+
+// harvestedMetrica returns value which was already taken during harvest
+type harvestedMetrica struct {
+	metric Metric
+}
+
+// nrpg.IMetrica interface implementation.
+func (m *harvestedMetrica) GetName() string { return m.metric.Name }
+
+func (m *harvestedMetrica) GetUnits() string { return m.metric.Units }
+
+func (m *harvestedMetrica) GetValue() (float64, error) { return m.metric.Value, nil }
@@ -0,0 +1,167 @@
+package gorelic
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrometheusReporter exposes last harvest in Prometheus text format.
+// Metrics are exported by their base names, global and per-metric labels are exported as Prometheus labels.
+// Gauges are exported with values of last harvest, counts are summed up into <name>_total counters.
+// Last deployment is exported as <namespace>_deployment_info metric with revision, description and user labels.
+// Add it with Agent.AddReporter and serve it on metrics endpoint:
+//
+//	reporter := gorelic.NewPrometheusReporter("myapp")
+//	agent.AddReporter(reporter)
+//	http.Handle("/metrics", reporter)
+type PrometheusReporter struct {
+	sync.Mutex
+	// Namespace is prepended to every metric name
+	Namespace  string
+	harvest    *Harvest
+	deployment *Deployment
+	// counters are totals of counts of all harvests
+	counters map[prometheusSeries]float64
+}
+
+type prometheusSeries struct {
+	name   string
+	labels string
+}
+
+// NewPrometheusReporter creates reporter, metric names of which are prefixed with namespace
+func NewPrometheusReporter(namespace string) *PrometheusReporter {
+	return &PrometheusReporter{Namespace: namespace}
+}
+
+// MetricsReporter interface implementation. Harvest is kept until the next one, its counts are added to counters.
+func (reporter *PrometheusReporter) Report(harvest *Harvest) error {
+	reporter.Lock()
+	defer reporter.Unlock()
+	reporter.harvest = harvest
+	if reporter.counters == nil {
+		reporter.counters = make(map[prometheusSeries]float64)
+	}
+	for _, metric := range harvest.Metrics {
+		if metric.Type == CountMetric {
+			series := prometheusSeries{reporter.metricName(metric.BaseName) + "_total", prometheusLabels(harvest.MetricLabels(metric))}
+			reporter.counters[series] += metric.Value
+		}
+	}
+	return nil
+}
+
+// DeploymentReporter interface implementation. Deployment is kept until the next one.
+func (reporter *PrometheusReporter) ReportDeployment(deployment Deployment) error {
+	reporter.Lock()
+	defer reporter.Unlock()
+	reporter.deployment = &deployment
+	return nil
+}
+
+// ServeHTTP writes metrics of last harvest
+func (reporter *PrometheusReporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reporter.Lock()
+	defer reporter.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if reporter.harvest != nil {
+		w.Write(reporter.format())
+	}
+}
+
+type prometheusSample struct {
+	name       string
+	labels     string
+	value      float64
+	metricType string
+}
+
+// metricName returns Prometheus name of metric in reporter namespace
+func (reporter *PrometheusReporter) metricName(baseName string) string {
+	name := prometheusName(baseName)
+	if reporter.Namespace != "" {
+		name = prometheusName(reporter.Namespace) + "_" + name
+	}
+	return name
+}
+
+// format renders last harvest and counters, samples of the same metric are grouped under single TYPE line.
+// It is called with reporter locked.
+func (reporter *PrometheusReporter) format() []byte {
+	harvest := reporter.harvest
+	samples := make([]prometheusSample, 0, len(harvest.Metrics))
+	for _, metric := range harvest.Metrics {
+		// summary statistics are reported as separate metrics, counts are reported as counters
+		if metric.Type == SummaryMetric || metric.Type == CountMetric {
+			continue
+		}
+		samples = append(samples, prometheusSample{reporter.metricName(metric.BaseName), prometheusLabels(harvest.MetricLabels(metric)), metric.Value, "gauge"})
+	}
+	for series, total := range reporter.counters {
+		samples = append(samples, prometheusSample{series.name, series.labels, total, "counter"})
+	}
+	if deployment := reporter.deployment; deployment != nil {
+		info := Metric{
+			BaseName: "deployment_info",
+			Labels:   map[string]string{"revision": deployment.Revision, "description": deployment.Description, "user": deployment.User},
+			Value:    1,
+		}
+		samples = append(samples, prometheusSample{reporter.metricName(info.BaseName), prometheusLabels(harvest.MetricLabels(info)), info.Value, "gauge"})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].name != samples[j].name {
+			return samples[i].name < samples[j].name
+		}
+		return samples[i].labels < samples[j].labels
+	})
+
+	var buf bytes.Buffer
+	for i, sample := range samples {
+		if i > 0 && samples[i-1].name == sample.name && samples[i-1].labels == sample.labels {
+			// names which differ only by invalid characters
+			continue
+		}
+		if i == 0 || samples[i-1].name != sample.name {
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", sample.name, sample.metricType)
+		}
+		fmt.Fprintf(&buf, "%s%s %s\n", sample.name, sample.labels, strconv.FormatFloat(sample.value, 'g', -1, 64))
+	}
+	return buf.Bytes()
+}
+
+// prometheusName replaces characters not allowed in metric and label names with underscores
+func prometheusName(name string) string {
+	result := []byte(name)
+	for i, c := range result {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= '0' && c <= '9' && i > 0) {
+			result[i] = '_'
+		}
+	}
+	return string(result)
+}
+
+var prometheusLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusLabels renders sorted label set, empty string is returned for metric without labels
+func prometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, prometheusName(key), prometheusLabelValueReplacer.Replace(labels[key])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,130 @@
+package gorelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Labels", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		reporter = &recordingReporter{}
+		agent.AddReporter(reporter)
+	})
+
+	It("should keep flattened names and pass labels of HTTP metrics", func() {
+		handler := agent.WrapHTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}, "/users")
+		Expect(agent.Run()).To(Succeed())
+
+		req, _ := http.NewRequest("POST", "/users", nil)
+		handler(httptest.NewRecorder(), req)
+		agent.harvest()
+
+		harvest := reporter.harvests[0]
+		metric := findMetric(harvest, "http/path//users/error/404")
+		Expect(metric.Value).To(Equal(1.0))
+		Expect(metric.BaseName).To(Equal("http/path/error"))
+		Expect(metric.Labels).To(Equal(map[string]string{"route": "/users", "status": "404"}))
+
+		metric = findMetric(harvest, "http/status/404")
+		Expect(metric.BaseName).To(Equal("http/status"))
+		Expect(metric.Labels).To(HaveKeyWithValue("status", "404"))
+
+		metric = findMetric(harvest, "http/method/POST")
+		Expect(metric.Value).To(Equal(1.0))
+		Expect(metric.dimensional).To(BeTrue())
+		Expect(metric.BaseName).To(Equal("http/method"))
+		Expect(metric.Labels).To(HaveKeyWithValue("method", "POST"))
+
+		metric = findMetric(harvest, "http/requests")
+		Expect(metric.BaseName).To(Equal("http/requests"))
+		Expect(metric.Labels).To(BeEmpty())
+	})
+
+	It("should pass trace name and global labels", func() {
+		agent.Labels["region"] = "eu"
+		Expect(agent.Run()).To(Succeed())
+		agent.Tracer.Trace("db", func() {})
+		agent.harvest()
+
+		harvest := reporter.harvests[0]
+		metric := findMetric(harvest, "Trace/db/max")
+		Expect(metric.BaseName).To(Equal("Trace/max"))
+		Expect(harvest.MetricLabels(*metric)).To(Equal(map[string]string{"region": "eu", "trace": "db"}))
+	})
+})
+
+var _ = Describe("PrometheusReporter", func() {
+	It("should expose last harvest in text format", func() {
+		reporter := NewPrometheusReporter("app")
+		Expect(reporter.Report(&Harvest{
+			Labels: map[string]string{"host": "web-1"},
+			Metrics: []Metric{
+				{Name: "http/status/200", BaseName: "http/status", Labels: map[string]string{"status": "200"}, Value: 3},
+				{Name: "Runtime/Goroutines", BaseName: "Runtime/Goroutines", Value: 12},
+				{Name: "http/status/500", BaseName: "http/status", Labels: map[string]string{"status": "500"}, Value: 0.5},
+				{Name: "Custom/quote", BaseName: "Custom/quote", Labels: map[string]string{"host": `a"b\`}, Value: 1},
+			},
+		})).To(Succeed())
+
+		w := httptest.NewRecorder()
+		reporter.ServeHTTP(w, nil)
+		Expect(w.Header().Get("Content-Type")).To(HavePrefix("text/plain; version=0.0.4"))
+		Expect(w.Body.String()).To(Equal(`# TYPE app_Custom_quote gauge
+app_Custom_quote{host="a\"b\\"} 1
+# TYPE app_Runtime_Goroutines gauge
+app_Runtime_Goroutines{host="web-1"} 12
+# TYPE app_http_status gauge
+app_http_status{host="web-1",status="200"} 3
+app_http_status{host="web-1",status="500"} 0.5
+`))
+	})
+
+	It("should sum counts up into counters", func() {
+		reporter := NewPrometheusReporter("app")
+		start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		harvest := func(at time.Duration, duration time.Duration, requests float64) {
+			Expect(reporter.Report(&Harvest{
+				Time:     start.Add(at),
+				Duration: duration,
+				Metrics: []Metric{
+					{Name: "http/requests", BaseName: "http/requests", Value: requests, Type: CountMetric},
+					{Name: "http/inFlight/current", BaseName: "http/inFlight/current", Value: requests, Type: GaugeMetric},
+				},
+			})).To(Succeed())
+		}
+		body := func() string {
+			w := httptest.NewRecorder()
+			reporter.ServeHTTP(w, nil)
+			return w.Body.String()
+		}
+
+		harvest(time.Minute, time.Minute, 3)
+		harvest(2*time.Minute, time.Minute, 2)
+		Expect(body()).To(Equal(`# TYPE app_http_inFlight_current gauge
+app_http_inFlight_current 2
+# TYPE app_http_requests_total counter
+app_http_requests_total 5
+`))
+	})
+
+	It("should keep HTTP method metrics out of NewRelic platform payload", func() {
+		Expect(platformReported(Metric{Name: "http/method/GET", dimensional: true})).To(BeFalse())
+		Expect(platformReported(Metric{Name: "http/status/200"})).To(BeTrue())
+	})
+
+	It("should expose nothing before first harvest", func() {
+		w := httptest.NewRecorder()
+		NewPrometheusReporter("").ServeHTTP(w, nil)
+		Expect(w.Body.Len()).To(BeZero())
+	})
+})
@@ -0,0 +1,265 @@
+package gorelic
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+// Reconfigure changes configuration of running agent. Settings absent in config are kept.
+// Labels and reporters of previous config (applied by LoadConfig or Reconfigure) are replaced with ones of config,
+// labels set on Agent and reporters added with AddReporter are kept. Only changed reporters and collectors are recreated.
+// CollectHTTPStat can not be changed while agent is running. Before Run config is applied to agent fields.
+func (agent *Agent) Reconfigure(config *Config) error {
+	agent.reconfigureLock.Lock()
+	defer agent.reconfigureLock.Unlock()
+
+	agent.configLock.Lock()
+	current := agent.config
+	agent.configLock.Unlock()
+
+	// License of running agent is used by reporters which have no own license.
+	if current != nil && config.License == nil && current.license != "" {
+		withLicense := *config
+		withLicense.License = &current.license
+		config = &withLicense
+	}
+	if err := config.validate(fileKey(""), false); err != nil {
+		return err
+	}
+	if current == nil {
+		agent.applyConfig(config)
+		return nil
+	}
+	select {
+	case <-agent.stopped:
+		return errors.New("agent is stopped")
+	default:
+	}
+	if config.CollectHTTPStat != nil && *config.CollectHTTPStat != agent.CollectHTTPStat {
+		return errors.New("collectHttpStat: can not be changed while agent is running")
+	}
+
+	next := *current
+	if config.License != nil {
+		next.license = *config.License
+	}
+	if config.Name != nil {
+		next.name = *config.Name
+	}
+	if config.PollInterval != nil {
+		next.pollInterval = time.Duration(*config.PollInterval) * time.Second
+	}
+	if config.Verbose != nil {
+		next.verbose = *config.Verbose
+	}
+	if config.CollectGcStat != nil {
+		next.collectGcStat = *config.CollectGcStat
+	}
+	if config.GCPollInterval != nil {
+		next.gcPollInterval = *config.GCPollInterval
+	}
+	if config.CollectMemoryStat != nil {
+		next.collectMemoryStat = *config.CollectMemoryStat
+	}
+	if config.MemoryAllocatorPollInterval != nil {
+		next.memoryPollInterval = *config.MemoryAllocatorPollInterval
+	}
+	proxyChanged := config.ProxyURL != nil && *config.ProxyURL != current.proxyURL
+	if proxyChanged {
+		next.proxyURL = *config.ProxyURL
+		next.client.Transport = proxyTransport(next.proxyURL)
+	}
+	next.labels = replaceConfigLabels(current.labels, current.configLabels, config.Labels)
+	next.configLabels = copyLabels(config.Labels)
+
+	if next.license != current.license || proxyChanged || !reflect.DeepEqual(config.Reporters, current.reportersConfig) {
+		next.configReporters = newConfigReporters(config.Reporters, next.license, next.client.Transport)
+		next.reportersConfig = config.Reporters
+	}
+	if next.license != current.license || next.name != current.name || next.pollInterval != current.pollInterval ||
+		next.verbose != current.verbose || proxyChanged {
+		next.platformReporter = nil
+		if next.license != "" {
+			next.platformReporter = newPlatformReporter(next.name, agent.AgentGUID, agent.AgentVersion, next.license, int(next.pollInterval/time.Second), next.client, next.verbose)
+		}
+	}
+	next.reporters = append(append([]MetricsReporter(nil), next.addedReporters...), next.configReporters...)
+	if next.platformReporter != nil {
+		next.reporters = append(next.reporters, next.platformReporter)
+	}
+
+	if next.collectGcStat != current.collectGcStat || (next.collectGcStat && next.gcPollInterval != current.gcPollInterval) {
+		agent.gcCollector.restart(next.collectGcStat, next.gcPollInterval)
+		agent.logger().Info("GC metrics collection reconfigured.", "enabled", next.collectGcStat, "pollInterval", next.gcPollInterval)
+	}
+	if next.collectMemoryStat != current.collectMemoryStat || (next.collectMemoryStat && next.memoryPollInterval != current.memoryPollInterval) {
+		agent.memoryCollector.restart(next.collectMemoryStat, next.memoryPollInterval)
+		agent.logger().Info("Memory allocator metrics collection reconfigured.", "enabled", next.collectMemoryStat, "pollInterval", next.memoryPollInterval)
+	}
+
+	agent.configLock.Lock()
+	agent.config = &next
+	agent.configLock.Unlock()
+
+	// Reporters statistic is kept by position, so it is started over for the new list.
+	if !sameReporters(next.reporters, current.reporters) {
+		agent.stats.resetReporters()
+	}
+	if next.pollInterval != current.pollInterval {
+		select {
+		case agent.pollIntervalChanged <- struct{}{}:
+		default:
+		}
+	}
+	agent.logger().Info("Agent reconfigured.", "pollInterval", int(next.pollInterval/time.Second), "reporters", len(next.reporters))
+	return nil
+}
+
+func sameReporters(reporters []MetricsReporter, other []MetricsReporter) bool {
+	if len(reporters) != len(other) {
+		return false
+	}
+	for i := range reporters {
+		if reporters[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ReloadConfig reads config file and environment variables like LoadConfig and applies them with Reconfigure
+func (agent *Agent) ReloadConfig(path string) error {
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	return agent.Reconfigure(config)
+}
+
+// reloadConfig reloads config, errors are logged since there is nobody to return them to
+func (agent *Agent) reloadConfig(path string) {
+	if err := agent.ReloadConfig(path); err != nil {
+		agent.stats.recordError("config", err)
+		agent.logger().Error("Can not reload config.", "path", path, "error", err)
+	}
+}
+
+// ReloadOnSignal reloads config file with ReloadConfig on every signal, SIGHUP by default.
+// Returned function stops reloading.
+func (agent *Agent) ReloadOnSignal(path string, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-received:
+				agent.reloadConfig(path)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(received)
+			close(done)
+		})
+	}
+}
+
+// WatchConfigFile checks config file once in interval and reloads it with ReloadConfig
+// when its modification time or size changes. Returned function stops watching.
+func (agent *Agent) WatchConfigFile(path string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	previous, _ := os.Stat(path)
+	go captureEvery(agent.clock(), interval, done, func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			agent.logger().Warn("Can not check config file.", "path", path, "error", err)
+			return
+		}
+		if previous == nil || !info.ModTime().Equal(previous.ModTime()) || info.Size() != previous.Size() {
+			previous = info
+			agent.reloadConfig(path)
+		}
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// captureEvery calls capture once in interval until stop is closed
+func captureEvery(clock Clock, interval time.Duration, stop <-chan struct{}, capture func()) {
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			capture()
+		}
+	}
+}
+
+// metricaList is iComponent keeping added metricas
+type metricaList []nrpg.IMetrica
+
+// iComponent interface implementation
+func (list *metricaList) AddMetrica(model nrpg.IMetrica) {
+	*list = append(*list, model)
+}
+
+// iComponent interface implementation
+func (list *metricaList) ClearSentData() {}
+
+// pollingCollector reports metricas filled by polling goroutine, it is restarted when its settings change
+type pollingCollector struct {
+	sync.Mutex
+	clock    Clock
+	add      func(component iComponent, pollInterval int, clock Clock, stop <-chan struct{})
+	metricas []nrpg.IMetrica
+	stop     chan struct{}
+}
+
+func newPollingCollector(clock Clock, add func(component iComponent, pollInterval int, clock Clock, stop <-chan struct{})) *pollingCollector {
+	return &pollingCollector{clock: clock, add: add}
+}
+
+// restart stops polling goroutine and starts new one if collector is enabled. Disabled collector reports nothing.
+func (collector *pollingCollector) restart(enabled bool, pollInterval int) {
+	collector.Lock()
+	defer collector.Unlock()
+	if collector.stop != nil {
+		close(collector.stop)
+		collector.stop = nil
+	}
+	collector.metricas = nil
+	if !enabled {
+		return
+	}
+	collector.stop = make(chan struct{})
+	var metricas metricaList
+	collector.add(&metricas, pollInterval, collector.clock, collector.stop)
+	collector.metricas = metricas
+}
+
+// iMetricaSource interface implementation
+func (collector *pollingCollector) Metricas() []nrpg.IMetrica {
+	collector.Lock()
+	defer collector.Unlock()
+	return collector.metricas
+}
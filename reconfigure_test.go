@@ -0,0 +1,183 @@
+package gorelic
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reconfigure", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+
+	hasMetrics := func(prefix string) bool {
+		agent.harvest()
+		harvest := reporter.lastHarvest()
+		for _, metric := range harvest.Metrics {
+			if strings.HasPrefix(metric.Name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		agent.CollectGcStat = false
+		agent.CollectMemoryStat = false
+		reporter = &recordingReporter{}
+		agent.AddReporter(reporter)
+	})
+
+	It("should apply config to stopped agent", func() {
+		name := "billing"
+		Expect(agent.Reconfigure(&Config{Name: &name})).To(Succeed())
+		Expect(agent.NewrelicName).To(Equal("billing"))
+	})
+
+	It("should enable and disable collectors", func() {
+		Expect(agent.Run()).To(Succeed())
+		Expect(hasMetrics("Runtime/GC/")).To(BeFalse())
+
+		enabled, interval := true, 1
+		Expect(agent.Reconfigure(&Config{CollectGcStat: &enabled, GCPollInterval: &interval})).To(Succeed())
+		Expect(hasMetrics("Runtime/GC/")).To(BeTrue())
+		Expect(hasMetrics("Runtime/Memory/")).To(BeFalse())
+
+		disabled := false
+		Expect(agent.Reconfigure(&Config{CollectGcStat: &disabled})).To(Succeed())
+		Expect(hasMetrics("Runtime/GC/")).To(BeFalse())
+	})
+
+	It("should restart only changed collectors", func() {
+		enabled := true
+		Expect(agent.Reconfigure(&Config{CollectGcStat: &enabled, CollectMemoryStat: &enabled})).To(Succeed())
+		Expect(agent.Run()).To(Succeed())
+		gcMetricas, memoryMetricas := agent.gcCollector.Metricas(), agent.memoryCollector.Metricas()
+
+		interval := 5
+		Expect(agent.Reconfigure(&Config{GCPollInterval: &interval})).To(Succeed())
+		Expect(agent.gcCollector.Metricas()).NotTo(Equal(gcMetricas))
+		Expect(agent.memoryCollector.Metricas()).To(Equal(memoryMetricas))
+		Expect(agent.runConfig().gcPollInterval).To(Equal(5))
+	})
+
+	It("should apply poll interval to running harvest loop", func() {
+		Expect(agent.Run()).To(Succeed())
+		Expect(agent.Stats().Harvests).To(BeZero())
+
+		interval := 1
+		Expect(agent.Reconfigure(&Config{PollInterval: &interval})).To(Succeed())
+		Eventually(func() int64 { return agent.Stats().Harvests }, 3*time.Second).Should(BeNumerically(">", 0))
+	})
+
+	It("should replace configured reporters", func() {
+		Expect(agent.LoadConfig("")).To(Succeed())
+		Expect(agent.Run()).To(Succeed())
+		Expect(agent.runConfig().reporters).To(Equal([]MetricsReporter{reporter}))
+
+		config := &Config{Reporters: ReportersConfig{InfluxDBAnnotations: &InfluxDBAnnotationsConfig{URL: "http://influx:8086", Database: "events"}}}
+		Expect(agent.Reconfigure(config)).To(Succeed())
+		reporters := agent.runConfig().reporters
+		Expect(reporters).To(HaveLen(2))
+		Expect(reporters[0]).To(Equal(reporter))
+		Expect(reporters[1]).To(BeAssignableToTypeOf(&InfluxDBAnnotationReporter{}))
+
+		Expect(agent.Reconfigure(&Config{})).To(Succeed())
+		Expect(agent.runConfig().reporters).To(Equal([]MetricsReporter{reporter}))
+	})
+
+	It("should merge labels", func() {
+		agent.Labels["region"] = "us"
+		Expect(agent.Run()).To(Succeed())
+		Expect(agent.Reconfigure(&Config{Labels: map[string]string{"env": "prod"}})).To(Succeed())
+		agent.harvest()
+		Expect(reporter.harvests[0].Labels).To(Equal(map[string]string{"region": "us", "env": "prod"}))
+	})
+
+	It("should remove labels absent in new config", func() {
+		agent.Labels["region"] = "us"
+		Expect(agent.Reconfigure(&Config{Labels: map[string]string{"env": "prod", "zone": "a"}})).To(Succeed())
+		Expect(agent.Run()).To(Succeed())
+		Expect(agent.Reconfigure(&Config{Labels: map[string]string{"env": "stage"}})).To(Succeed())
+		agent.harvest()
+		Expect(reporter.harvests[0].Labels).To(Equal(map[string]string{"region": "us", "env": "stage"}))
+	})
+
+	It("should keep unchanged reporters", func() {
+		proxy := "http://proxy:3128"
+		license := "0123456789012345678901234567890123456789"
+		config := &Config{
+			License:   &license,
+			ProxyURL:  &proxy,
+			Reporters: ReportersConfig{InfluxDBAnnotations: &InfluxDBAnnotationsConfig{URL: "http://influx:8086", Database: "events"}},
+		}
+		Expect(agent.Reconfigure(config)).To(Succeed())
+		Expect(agent.Reconfigure(config)).To(Succeed())
+		Expect(agent.Reporters).To(HaveLen(2))
+		Expect(agent.Run()).To(Succeed())
+		reporters := agent.runConfig().reporters
+		Expect(reporters).To(HaveLen(3))
+
+		reloaded := *config
+		reloaded.Reporters = ReportersConfig{InfluxDBAnnotations: &InfluxDBAnnotationsConfig{URL: "http://influx:8086", Database: "events"}}
+		Expect(agent.Reconfigure(&reloaded)).To(Succeed())
+		Expect(agent.runConfig().reporters).To(Equal(reporters))
+
+		otherProxy := "http://proxy:8080"
+		reloaded.ProxyURL = &otherProxy
+		Expect(agent.Reconfigure(&reloaded)).To(Succeed())
+		Expect(agent.runConfig().reporters[1]).NotTo(BeIdenticalTo(reporters[1]))
+		Expect(agent.runConfig().reporters[2]).NotTo(BeIdenticalTo(reporters[2]))
+	})
+
+	It("should reject invalid or unsupported changes", func() {
+		Expect(agent.Run()).To(Succeed())
+		interval := 0
+		Expect(agent.Reconfigure(&Config{PollInterval: &interval})).NotTo(Succeed())
+
+		enabled := true
+		Expect(agent.Reconfigure(&Config{CollectHTTPStat: &enabled})).To(MatchError("collectHttpStat: can not be changed while agent is running"))
+		Expect(agent.runConfig().pollInterval).To(Equal(time.Duration(DefaultNewRelicPollInterval) * time.Second))
+	})
+
+	Describe("config file", func() {
+		var dir, path string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "gorelic")
+			Expect(err).NotTo(HaveOccurred())
+			path = filepath.Join(dir, "gorelic.json")
+			Expect(ioutil.WriteFile(path, []byte(`{"name": "billing"}`), 0600)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should reload config file", func() {
+			Expect(agent.Run()).To(Succeed())
+			Expect(agent.ReloadConfig(path)).To(Succeed())
+			Expect(agent.runConfig().name).To(Equal("billing"))
+
+			Expect(ioutil.WriteFile(path, []byte(`{"unknown": true}`), 0600)).To(Succeed())
+			Expect(agent.ReloadConfig(path)).NotTo(Succeed())
+			Expect(agent.runConfig().name).To(Equal("billing"))
+		})
+
+		It("should watch config file", func() {
+			Expect(agent.Run()).To(Succeed())
+			stop := agent.WatchConfigFile(path, 10*time.Millisecond)
+			defer stop()
+
+			Expect(ioutil.WriteFile(path, []byte(`{"name": "payments"}`), 0600)).To(Succeed())
+			Eventually(func() string { return agent.runConfig().name }).Should(Equal("payments"))
+		})
+	})
+})
@@ -0,0 +1,147 @@
+package gorelic
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	metrics "github.com/yvasiyarov/go-metrics"
+	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+)
+
+// registrySource reports every instrument of go-metrics registry.
+// Registry is walked on every harvest, so instruments registered after AddRegistry are reported too.
+type registrySource struct {
+	sync.Mutex
+	prefix      string
+	registry    metrics.Registry
+	dataSource  goMetricaDataSource
+	instruments map[string]*registryInstrument
+}
+
+// registryInstrument keeps metricas created for instrument, so delta values survive between harvests
+type registryInstrument struct {
+	instrument interface{}
+	metricas   []nrpg.IMetrica
+}
+
+func newRegistrySource(prefix string, registry metrics.Registry) *registrySource {
+	return &registrySource{
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		registry:    registry,
+		dataSource:  goMetricaDataSource{registry},
+		instruments: make(map[string]*registryInstrument),
+	}
+}
+
+// iMetricaSource interface implementation.
+// Metricas of unregistered instruments are dropped, replaced instruments get new metricas.
+func (source *registrySource) Metricas() []nrpg.IMetrica {
+	source.Lock()
+	defer source.Unlock()
+
+	current := make(map[string]interface{})
+	source.registry.Each(func(name string, instrument interface{}) {
+		current[name] = instrument
+	})
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	instruments := make(map[string]*registryInstrument, len(current))
+	result := make([]nrpg.IMetrica, 0)
+	for _, name := range names {
+		instrument := current[name]
+		cached, ok := source.instruments[name]
+		if !ok || cached.instrument != instrument {
+			cached = &registryInstrument{instrument: instrument, metricas: source.newMetricas(name, instrument)}
+		}
+		instruments[name] = cached
+		result = append(result, cached.metricas...)
+	}
+	source.instruments = instruments
+	return result
+}
+
+// newMetricas creates metricas appropriate for instrument type. Unsupported instruments are skipped.
+func (source *registrySource) newMetricas(key string, instrument interface{}) []nrpg.IMetrica {
+	basePath := source.metricName(key)
+	newBase := func(name string, units string) *baseGoMetrica {
+		return &baseGoMetrica{
+			dataSource:    source.dataSource,
+			basePath:      basePath,
+			name:          name,
+			units:         units,
+			dataSourceKey: key,
+		}
+	}
+
+	switch instrument := instrument.(type) {
+	case metrics.Counter:
+		return []nrpg.IMetrica{&gaugeMetrica{newBase("", "count")}}
+	case metrics.Gauge, metrics.GaugeFloat64:
+		return []nrpg.IMetrica{&gaugeMetrica{newBase("", "value")}}
+	case metrics.Meter:
+		return []nrpg.IMetrica{
+			&gaugeIncMetrica{baseGoMetrica: newBase("/count", "events")},
+			&meterMetrica{newBase("/rate1", "events/second"), meterRate1},
+			&meterMetrica{newBase("/rate5", "events/second"), meterRate5},
+			&meterMetrica{newBase("/rate15", "events/second"), meterRate15},
+			&meterMetrica{newBase("/rateMean", "events/second"), meterRateMean},
+		}
+	case metrics.Histogram:
+		result := []nrpg.IMetrica{
+			&gaugeIncMetrica{baseGoMetrica: newBase("/count", "count")},
+			&histogramMetrica{baseGoMetrica: newBase("/mean", "value"), statFunction: histogramMean},
+			&histogramMetrica{baseGoMetrica: newBase("/min", "value"), statFunction: histogramMin},
+			&histogramMetrica{baseGoMetrica: newBase("/max", "value"), statFunction: histogramMax},
+		}
+		for _, percentile := range DefaultHistogramPercentiles {
+			result = append(result, &histogramMetrica{
+				baseGoMetrica:   newBase(percentileMetricName(percentile), "value"),
+				statFunction:    histogramPercentile,
+				percentileValue: percentile,
+			})
+		}
+		return result
+	case metrics.Timer:
+		newTimerBase := func(name string, units string) *baseTimerMetrica {
+			return &baseTimerMetrica{dataSource: instrument, name: basePath + name, units: units}
+		}
+		return []nrpg.IMetrica{
+			&gaugeIncMetrica{baseGoMetrica: newBase("/count", "count")},
+			&timerRate1Metrica{newTimerBase("/rate1", "rps")},
+			&timerRateMeanMetrica{newTimerBase("/rateMean", "rps")},
+			&timerMeanMetrica{newTimerBase("/mean", "ms")},
+			&timerMinMetrica{newTimerBase("/min", "ms")},
+			&timerMaxMetrica{newTimerBase("/max", "ms")},
+			&timerPercentile75Metrica{newTimerBase("/percentile75", "ms")},
+			&timerPercentile90Metrica{newTimerBase("/percentile90", "ms")},
+			&timerPercentile95Metrica{newTimerBase("/percentile95", "ms")},
+		}
+	}
+	return nil
+}
+
+// metricName converts dotted go-metrics name into NewRelic metric path under prefix
+func (source *registrySource) metricName(key string) string {
+	name := strings.Trim(strings.Replace(key, ".", "/", -1), "/")
+	if source.prefix == "" {
+		return name
+	}
+	return source.prefix + "/" + name
+}
+
+// AddRegistry reports every Counter, Gauge, GaugeFloat64, Meter, Histogram and Timer of go-metrics registry
+// under <prefix>/<name> path, dots in names are replaced with slashes.
+// Registry is walked on every harvest, so metrics registered later are reported as well.
+func (agent *Agent) AddRegistry(prefix string, registry metrics.Registry) {
+	source := newRegistrySource(prefix, registry)
+	agent.metricaSources = append(agent.metricaSources, source)
+	// Registries added after Run are registered immediately
+	if agent.registry != nil {
+		agent.registry.addSource(source)
+	}
+}
@@ -0,0 +1,80 @@
+package gorelic
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metrics "github.com/yvasiyarov/go-metrics"
+)
+
+var _ = Describe("Registry metrics", func() {
+	var agent *Agent
+	var reporter *recordingReporter
+	var registry metrics.Registry
+
+	BeforeEach(func() {
+		agent = NewAgent()
+		reporter = &recordingReporter{}
+		agent.AddReporter(reporter)
+		registry = metrics.NewRegistry()
+	})
+
+	It("should report every instrument type", func() {
+		agent.AddRegistry("App/", registry)
+		Expect(agent.Run()).To(Succeed())
+
+		metrics.GetOrRegisterCounter("jobs.done", registry).Inc(3)
+		metrics.GetOrRegisterGauge("queue", registry).Update(7)
+		metrics.GetOrRegisterGaugeFloat64("ratio", registry).Update(0.5)
+		metrics.GetOrRegisterMeter("requests", registry).Mark(4)
+		histogram := metrics.GetOrRegisterHistogram("payload", registry, metrics.NewUniformSample(100))
+		for i := int64(1); i <= 4; i++ {
+			histogram.Update(i)
+		}
+		metrics.GetOrRegisterTimer("db.query", registry).Update(20 * time.Millisecond)
+
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "App/jobs/done").Value).To(Equal(3.0))
+		Expect(findMetric(reporter.lastHarvest(), "App/queue").Value).To(Equal(7.0))
+		Expect(findMetric(reporter.lastHarvest(), "App/ratio").Value).To(Equal(0.5))
+		Expect(findMetric(reporter.lastHarvest(), "App/requests/count").Value).To(Equal(4.0))
+		Expect(findMetric(reporter.lastHarvest(), "App/requests/rate1")).NotTo(BeNil())
+		Expect(findMetric(reporter.lastHarvest(), "App/requests/rateMean").Units).To(Equal("events/second"))
+		Expect(findMetric(reporter.lastHarvest(), "App/payload/count").Value).To(Equal(4.0))
+		Expect(findMetric(reporter.lastHarvest(), "App/payload/max").Value).To(Equal(4.0))
+		Expect(findMetric(reporter.lastHarvest(), "App/payload/mean").Value).To(Equal(2.5))
+		Expect(findMetric(reporter.lastHarvest(), "App/payload/percentile95")).NotTo(BeNil())
+		Expect(findMetric(reporter.lastHarvest(), "App/db/query/count").Value).To(Equal(1.0))
+		Expect(findMetric(reporter.lastHarvest(), "App/db/query/max").Value).To(Equal(20.0))
+		Expect(findMetric(reporter.lastHarvest(), "App/db/query/mean").Units).To(Equal("ms"))
+	})
+
+	It("should report meter events since last harvest", func() {
+		agent.AddRegistry("App", registry)
+		Expect(agent.Run()).To(Succeed())
+
+		meter := metrics.GetOrRegisterMeter("requests", registry)
+		meter.Mark(4)
+		agent.harvest()
+		meter.Mark(1)
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "App/requests/count").Value).To(Equal(1.0))
+	})
+
+	It("should pick up instruments registered and unregistered later", func() {
+		Expect(agent.Run()).To(Succeed())
+		agent.AddRegistry("App", registry)
+
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "App/late")).To(BeNil())
+
+		metrics.GetOrRegisterCounter("late", registry).Inc(1)
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "App/late").Value).To(Equal(1.0))
+
+		registry.Unregister("late")
+		agent.harvest()
+		Expect(findMetric(reporter.lastHarvest(), "App/late")).To(BeNil())
+	})
+})
@@ -2,16 +2,22 @@ package gorelic
 
 import (
 	"fmt"
-	"github.com/yvasiyarov/newrelic_platform_go"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const linuxSystemQueryInterval = 60
+const (
+	// DefaultProcRoot - where proc filesystem is mounted
+	DefaultProcRoot = "/proc"
+
+	// DefaultSystemPollIntervalInSeconds - how often /proc/<pid>/status will be read
+	DefaultSystemPollIntervalInSeconds = 60
+)
 
 // Number of goroutines metrica
 type noGoroutinesMetrica struct{}
@@ -51,15 +57,13 @@ type iSystemMetricaDataSource interface {
 }
 
 // iSystemMetricaDataSource fabrica
-func newSystemMetricaDataSource() iSystemMetricaDataSource {
+func newSystemMetricaDataSource(procRoot string, queryInterval int, now func() time.Time) iSystemMetricaDataSource {
 	var ds iSystemMetricaDataSource
 	switch runtime.GOOS {
 	default:
 		ds = &systemMetricaDataSource{}
 	case "linux":
-		ds = &linuxSystemMetricaDataSource{
-			systemData: make(map[string]string),
-		}
+		ds = newLinuxSystemMetricaDataSource(procRoot, os.Getpid(), time.Duration(queryInterval)*time.Second, now)
 	}
 	return ds
 }
@@ -73,8 +77,22 @@ func (ds *systemMetricaDataSource) GetValue(key string) (float64, error) {
 
 // Linux OS implementation of ISystemMetricaDataSource
 type linuxSystemMetricaDataSource struct {
-	lastUpdate time.Time
-	systemData map[string]string
+	procRoot      string
+	pid           int
+	queryInterval time.Duration
+	now           func() time.Time
+	lastUpdate    time.Time
+	systemData    map[string]string
+}
+
+func newLinuxSystemMetricaDataSource(procRoot string, pid int, queryInterval time.Duration, now func() time.Time) *linuxSystemMetricaDataSource {
+	return &linuxSystemMetricaDataSource{
+		procRoot:      procRoot,
+		pid:           pid,
+		queryInterval: queryInterval,
+		now:           now,
+		systemData:    make(map[string]string),
+	}
 }
 
 func (ds *linuxSystemMetricaDataSource) GetValue(key string) (float64, error) {
@@ -82,14 +100,57 @@ func (ds *linuxSystemMetricaDataSource) GetValue(key string) (float64, error) {
 		return 0, err
 	} else if val, ok := ds.systemData[key]; !ok {
 		return 0, fmt.Errorf("system data with key %s was not found", key)
-	} else if key == "VmSize" || key == "VmPeak" || key == "VmHWM" || key == "VmRSS" {
-		valueParts := strings.Split(val, " ")
-		if len(valueParts) != 2 {
-			return 0, fmt.Errorf("invalid format for value %s", key)
+	} else {
+		return parseProcStatusValue(key, val)
+	}
+}
+
+func (ds *linuxSystemMetricaDataSource) checkAndUpdateData() error {
+	startTime := ds.now()
+	if startTime.Sub(ds.lastUpdate) > ds.queryInterval {
+		path := filepath.Join(ds.procRoot, strconv.Itoa(ds.pid), "status")
+		rawStats, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
 		}
+
+		ds.systemData = parseProcStatus(rawStats)
+		ds.lastUpdate = startTime
+	}
+	return nil
+}
+
+// parseProcStatus splits /proc/<pid>/status into "key: value" pairs
+func parseProcStatus(rawStats []byte) map[string]string {
+	systemData := make(map[string]string)
+	lines := strings.Split(string(rawStats), "\n")
+	for _, line := range lines {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			k := strings.TrimSpace(parts[0])
+			v := strings.TrimSpace(parts[1])
+
+			systemData[k] = v
+		}
+	}
+	return systemData
+}
+
+// parseProcStatusValue converts value of /proc/<pid>/status to float.
+// Memory values like "VmRSS:	    1424 kB" are converted to bytes.
+func parseProcStatusValue(key string, val string) (float64, error) {
+	valueParts := strings.Fields(val)
+	switch len(valueParts) {
+	case 1:
 		valConverted, err := strconv.ParseFloat(valueParts[0], 64)
 		if err != nil {
-			return 0, err
+			return 0, fmt.Errorf("invalid value %q for %s: %v", val, key, err)
+		}
+		return valConverted, nil
+	case 2:
+		valConverted, err := strconv.ParseFloat(valueParts[0], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q for %s: %v", val, key, err)
 		}
 		switch valueParts[1] {
 		case "kB":
@@ -98,44 +159,24 @@ func (ds *linuxSystemMetricaDataSource) GetValue(key string) (float64, error) {
 			valConverted *= 1 << 20
 		case "gB":
 			valConverted *= 1 << 30
+		default:
+			return 0, fmt.Errorf("invalid unit %q for %s", valueParts[1], key)
 		}
 		return valConverted, nil
-	} else if valConverted, err := strconv.ParseFloat(val, 64); err != nil {
-		return valConverted, nil
-	} else {
-		return valConverted, nil
-	}
-}
-func (ds *linuxSystemMetricaDataSource) checkAndUpdateData() error {
-	startTime := time.Now()
-	if startTime.Sub(ds.lastUpdate) > time.Second*linuxSystemQueryInterval {
-		path := fmt.Sprintf("/proc/%d/status", os.Getpid())
-		rawStats, err := ioutil.ReadFile(path)
-		if err != nil {
-			return err
-		}
-
-		lines := strings.Split(string(rawStats), "\n")
-		for _, line := range lines {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				k := strings.TrimSpace(parts[0])
-				v := strings.TrimSpace(parts[1])
-
-				ds.systemData[k] = v
-			}
-		}
-		ds.lastUpdate = startTime
+	default:
+		return 0, fmt.Errorf("invalid format for value %s", key)
 	}
-	return nil
 }
 
-// OS specific metrica
+// OS specific metrica. Incremental metricas report difference from previous value.
 type systemMetrica struct {
-	sourceKey    string
-	newrelicName string
-	units        string
-	dataSource   iSystemMetricaDataSource
+	sourceKey     string
+	newrelicName  string
+	units         string
+	incremental   bool
+	sampled       bool
+	previousValue float64
+	dataSource    iSystemMetricaDataSource
 }
 
 func (metrica *systemMetrica) GetName() string {
@@ -145,14 +186,33 @@ func (metrica *systemMetrica) GetUnits() string {
 	return metrica.units
 }
 func (metrica *systemMetrica) GetValue() (float64, error) {
-	return metrica.dataSource.GetValue(metrica.sourceKey)
+	currentValue, err := metrica.dataSource.GetValue(metrica.sourceKey)
+	if err != nil || !metrica.incremental {
+		return currentValue, err
+	}
+	// first sample is a baseline, counters since boot are not reported
+	value := currentValue - metrica.previousValue
+	if !metrica.sampled {
+		value = 0
+	}
+	metrica.previousValue = currentValue
+	metrica.sampled = true
+	return value, nil
+}
+
+// TypedMetrica interface implementation. Incremental metricas report increase since previous harvest.
+func (metrica *systemMetrica) GetType() MetricType {
+	if metrica.incremental {
+		return CountMetric
+	}
+	return GaugeMetric
 }
 
-func addRuntimeMericsToComponent(component newrelic_platform_go.IComponent) {
+func addRuntimeMericsToComponent(component iComponent, procRoot string, pollInterval int, now func() time.Time) {
 	component.AddMetrica(&noGoroutinesMetrica{})
 	component.AddMetrica(&noCgoCallsMetrica{})
 
-	ds := newSystemMetricaDataSource()
+	ds := newSystemMetricaDataSource(procRoot, pollInterval, now)
 	metrics := []*systemMetrica{
 		&systemMetrica{
 			sourceKey:    "Threads",
@@ -0,0 +1,113 @@
+package gorelic
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Linux system metrics", func() {
+	var now time.Time
+	clock := func() time.Time { return now }
+
+	BeforeEach(func() {
+		now = time.Date(2016, 5, 10, 14, 0, 0, 0, time.UTC)
+	})
+
+	statusFixtures := map[string]map[string]float64{
+		"linux-2.6": {
+			"Threads": 6,
+			"FDSize":  256,
+			"VmPeak":  177876 * 1024,
+			"VmSize":  177872 * 1024,
+			"VmHWM":   10244 * 1024,
+			"VmRSS":   10240 * 1024,
+		},
+		"linux-3.10": {
+			"Threads": 12,
+			"FDSize":  64,
+			"VmPeak":  231456 * 1024,
+			"VmSize":  231452 * 1024,
+			"VmHWM":   20480 * 1024,
+			"VmRSS":   18432 * 1024,
+		},
+		"linux-6.1": {
+			"Threads": 9,
+			"FDSize":  128,
+			"VmPeak":  1253376 * 1024,
+			"VmSize":  1252352 * 1024,
+			"VmHWM":   40960 * 1024,
+			"VmRSS":   32768 * 1024,
+		},
+	}
+	for kernel, expected := range statusFixtures {
+		kernel, expected := kernel, expected
+		It("should parse /proc/<pid>/status of "+kernel, func() {
+			ds := newLinuxSystemMetricaDataSource("testdata/proc/"+kernel, 1, time.Minute, clock)
+			for key, value := range expected {
+				Expect(ds.GetValue(key)).To(Equal(value), key)
+			}
+		})
+	}
+
+	Context("With malformed status file", func() {
+		var ds *linuxSystemMetricaDataSource
+
+		BeforeEach(func() {
+			ds = newLinuxSystemMetricaDataSource("testdata/proc/malformed", 1, time.Minute, clock)
+		})
+
+		It("should parse valid values", func() {
+			Expect(ds.GetValue("Threads")).To(Equal(4.0))
+			Expect(ds.GetValue("VmPeak")).To(Equal(1024.0 * 1024))
+		})
+
+		It("should fail on invalid values", func() {
+			for _, key := range []string{"FDSize", "VmSize", "VmHWM", "VmRSS", "VmSwap"} {
+				_, err := ds.GetValue(key)
+				Expect(err).To(HaveOccurred(), key)
+			}
+		})
+	})
+
+	Context("With missing status file", func() {
+		It("should fail", func() {
+			ds := newLinuxSystemMetricaDataSource("testdata/proc/linux-6.1", 2, time.Minute, clock)
+			_, err := ds.GetValue("Threads")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("refresh", func() {
+		It("should re-read status file only after query interval", func() {
+			ds := newLinuxSystemMetricaDataSource("testdata/proc/linux-2.6", 1, time.Minute, clock)
+			Expect(ds.GetValue("Threads")).To(Equal(6.0))
+
+			ds.procRoot = "testdata/proc/linux-3.10"
+			now = now.Add(30 * time.Second)
+			Expect(ds.GetValue("Threads")).To(Equal(6.0))
+
+			now = now.Add(31 * time.Second)
+			Expect(ds.GetValue("Threads")).To(Equal(12.0))
+		})
+	})
+
+	Describe("incremental systemMetrica", func() {
+		It("should report incremental values as deltas", func() {
+			ds := &fakeMetricaDataSource{values: map[string]float64{"cpu.throttledPeriods": 3}}
+			m := &systemMetrica{sourceKey: "cpu.throttledPeriods", incremental: true, dataSource: ds}
+			Expect(m.GetValue()).To(Equal(0.0))
+			ds.values["cpu.throttledPeriods"] = 10
+			Expect(m.GetValue()).To(Equal(7.0))
+		})
+	})
+})
+
+type fakeMetricaDataSource struct {
+	values map[string]float64
+}
+
+func (ds *fakeMetricaDataSource) GetValue(key string) (float64, error) {
+	return ds.values[key], nil
+}
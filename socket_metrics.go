@@ -0,0 +1,221 @@
+package gorelic
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TCP states as they are encoded in /proc/net/tcp
+var tcpStates = map[string]string{
+	"01": "Established",
+	"02": "SynSent",
+	"03": "SynRecv",
+	"04": "FinWait1",
+	"05": "FinWait2",
+	"06": "TimeWait",
+	"07": "Close",
+	"08": "CloseWait",
+	"09": "LastAck",
+	"0A": "Listen",
+	"0B": "Closing",
+	"0C": "NewSynRecv",
+}
+
+const tcpStateTimeWait = "06"
+
+// socket data source fabrica
+func newSocketMetricaDataSource(procRoot string, queryInterval int, now func() time.Time) iSystemMetricaDataSource {
+	var ds iSystemMetricaDataSource
+	switch runtime.GOOS {
+	default:
+		ds = &systemMetricaDataSource{}
+	case "linux":
+		ds = newLinuxSocketMetricaDataSource(procRoot, os.Getpid(), time.Duration(queryInterval)*time.Second, now)
+	}
+	return ds
+}
+
+// Linux implementation of TCP sockets iSystemMetricaDataSource.
+// Process sockets are found by matching inodes of /proc/<pid>/net/tcp{,6} with socket file descriptors of the process.
+type linuxSocketMetricaDataSource struct {
+	procRoot      string
+	pid           int
+	queryInterval time.Duration
+	now           func() time.Time
+	lastUpdate    time.Time
+	socketData    map[string]float64
+}
+
+func newLinuxSocketMetricaDataSource(procRoot string, pid int, queryInterval time.Duration, now func() time.Time) *linuxSocketMetricaDataSource {
+	return &linuxSocketMetricaDataSource{
+		procRoot:      procRoot,
+		pid:           pid,
+		queryInterval: queryInterval,
+		now:           now,
+		socketData:    make(map[string]float64),
+	}
+}
+
+func (ds *linuxSocketMetricaDataSource) GetValue(key string) (float64, error) {
+	if err := ds.checkAndUpdateData(); err != nil {
+		return 0, err
+	} else if val, ok := ds.socketData[key]; !ok {
+		return 0, fmt.Errorf("socket data with key %s was not found", key)
+	} else {
+		return val, nil
+	}
+}
+
+func (ds *linuxSocketMetricaDataSource) checkAndUpdateData() error {
+	startTime := ds.now()
+	if startTime.Sub(ds.lastUpdate) > ds.queryInterval {
+		processDir := filepath.Join(ds.procRoot, strconv.Itoa(ds.pid))
+		inodes, err := readSocketInodes(filepath.Join(processDir, "fd"))
+		if err != nil {
+			return err
+		}
+
+		socketData := make(map[string]float64)
+		for _, state := range tcpStates {
+			socketData["state."+state] = 0
+		}
+		socketData["total"] = 0
+		socketData["namespaceTimeWait"] = 0
+		socketData["rxQueue"] = 0
+		socketData["txQueue"] = 0
+
+		for _, table := range []string{"net/tcp", "net/tcp6"} {
+			raw, err := ioutil.ReadFile(filepath.Join(processDir, table))
+			if os.IsNotExist(err) {
+				// IPv6 could be disabled
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := parseTCPTable(raw, inodes, socketData); err != nil {
+				return fmt.Errorf("invalid format of %s: %v", table, err)
+			}
+		}
+		ds.socketData = socketData
+		ds.lastUpdate = startTime
+	}
+	return nil
+}
+
+// readSocketInodes collects inodes of "socket:[inode]" links in /proc/<pid>/fd
+func readSocketInodes(fdDir string) (map[string]bool, error) {
+	fds, err := ioutil.ReadDir(fdDir)
+	if err != nil {
+		return nil, err
+	}
+	inodes := make(map[string]bool, len(fds))
+	for _, fd := range fds {
+		// fd could be closed in the meantime
+		link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(link, "socket:[") && strings.HasSuffix(link, "]") {
+			inodes[link[len("socket:["):len(link)-1]] = true
+		}
+	}
+	return inodes, nil
+}
+
+// parseTCPTable counts sockets of /proc/net/tcp format:
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	 0: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 21709 ...
+//
+// Sockets in TIME_WAIT state are already closed and do not belong to any process,
+// they are counted for the whole network namespace separately from process sockets.
+func parseTCPTable(raw []byte, inodes map[string]bool, socketData map[string]float64) error {
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	// skip header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		} else if len(fields) < 10 {
+			return fmt.Errorf("unexpected line %q", scanner.Text())
+		}
+		st, inode := fields[3], fields[9]
+		if !inodes[inode] {
+			if st == tcpStateTimeWait {
+				socketData["namespaceTimeWait"]++
+			}
+			continue
+		}
+		state, ok := tcpStates[st]
+		if !ok {
+			return fmt.Errorf("unknown tcp state %s", st)
+		}
+		queues := strings.Split(fields[4], ":")
+		if len(queues) != 2 {
+			return fmt.Errorf("invalid queue format %s", fields[4])
+		}
+		txQueue, err := strconv.ParseUint(queues[0], 16, 64)
+		if err != nil {
+			return err
+		}
+		rxQueue, err := strconv.ParseUint(queues[1], 16, 64)
+		if err != nil {
+			return err
+		}
+
+		socketData["state."+state]++
+		socketData["total"]++
+		socketData["txQueue"] += float64(txQueue)
+		socketData["rxQueue"] += float64(rxQueue)
+	}
+	return scanner.Err()
+}
+
+func addSocketMetricsToComponent(component iComponent, procRoot string, pollInterval int, now func() time.Time) {
+	ds := newSocketMetricaDataSource(procRoot, pollInterval, now)
+	metrics := []*systemMetrica{
+		&systemMetrica{
+			sourceKey:    "total",
+			units:        "sockets",
+			newrelicName: "Runtime/System/Sockets/Total",
+		},
+		// Closed sockets waiting for delayed packets, of all processes of network namespace
+		&systemMetrica{
+			sourceKey:    "namespaceTimeWait",
+			units:        "sockets",
+			newrelicName: "Runtime/System/Sockets/Namespace/TimeWait",
+		},
+		// Data received but not read by application yet
+		&systemMetrica{
+			sourceKey:    "rxQueue",
+			units:        "bytes",
+			newrelicName: "Runtime/System/Sockets/ReceiveQueue",
+		},
+		// Data sent but not acknowledged by remote host yet
+		&systemMetrica{
+			sourceKey:    "txQueue",
+			units:        "bytes",
+			newrelicName: "Runtime/System/Sockets/SendQueue",
+		},
+	}
+	for _, state := range tcpStates {
+		metrics = append(metrics, &systemMetrica{
+			sourceKey:    "state." + state,
+			units:        "sockets",
+			newrelicName: "Runtime/System/Sockets/" + state,
+		})
+	}
+	for _, m := range metrics {
+		m.dataSource = ds
+		component.AddMetrica(m)
+	}
+}
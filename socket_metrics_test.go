@@ -0,0 +1,39 @@
+package gorelic
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Socket metrics", func() {
+	var ds *linuxSocketMetricaDataSource
+
+	BeforeEach(func() {
+		ds = newLinuxSocketMetricaDataSource("testdata/proc/sockets", 1, time.Minute, time.Now)
+	})
+
+	It("should count process sockets by state", func() {
+		Expect(ds.GetValue("state.Listen")).To(Equal(2.0))
+		Expect(ds.GetValue("state.Established")).To(Equal(2.0))
+		Expect(ds.GetValue("state.CloseWait")).To(Equal(0.0))
+	})
+
+	It("should count TIME_WAIT sockets of network namespace separately", func() {
+		Expect(ds.GetValue("namespaceTimeWait")).To(Equal(1.0))
+		Expect(ds.GetValue("state.TimeWait")).To(Equal(0.0))
+		Expect(ds.GetValue("total")).To(Equal(4.0))
+	})
+
+	It("should sum socket queues", func() {
+		Expect(ds.GetValue("rxQueue")).To(Equal(18.0))
+		Expect(ds.GetValue("txQueue")).To(Equal(32.0))
+	})
+
+	It("should fail for unknown process", func() {
+		ds.pid = 2
+		_, err := ds.GetValue("total")
+		Expect(err).To(HaveOccurred())
+	})
+})
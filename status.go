@@ -0,0 +1,209 @@
+package gorelic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces secrets in status
+const redactedValue = "[REDACTED]"
+
+// agentStatus is JSON document returned by StatusHandler
+type agentStatus struct {
+	Running      bool              `json:"running"`
+	Name         string            `json:"name"`
+	License      string            `json:"license,omitempty"`
+	StartTime    *time.Time        `json:"startTime,omitempty"`
+	Harvests     int64             `json:"harvests"`
+	LastHarvest  *harvestStatus    `json:"lastHarvest,omitempty"`
+	Reporters    []reporterStatus  `json:"reporters"`
+	Metrics      []metricStatus    `json:"metrics"`
+	HTTPPaths    []string          `json:"httpPaths"`
+	Traces       []string          `json:"traces"`
+	RecentErrors []errorStatus     `json:"recentErrors"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+type harvestStatus struct {
+	Time           time.Time `json:"time"`
+	DurationMs     float64   `json:"durationMs"`
+	Metrics        int       `json:"metrics"`
+	GetValueErrors int64     `json:"getValueErrors"`
+}
+
+type reporterStatus struct {
+	Name                string           `json:"name"`
+	Type                string           `json:"type"`
+	Successes           int64            `json:"successes"`
+	Failures            int64            `json:"failures"`
+	FailuresByReason    map[string]int64 `json:"failuresByReason,omitempty"`
+	ConsecutiveFailures int64            `json:"consecutiveFailures"`
+	SentBytes           int64            `json:"sentBytes"`
+	LastAttempt         *time.Time       `json:"lastAttempt,omitempty"`
+	LastSuccess         *time.Time       `json:"lastSuccess,omitempty"`
+	LastError           string           `json:"lastError,omitempty"`
+}
+
+type metricStatus struct {
+	Name   string            `json:"name"`
+	Units  string            `json:"units"`
+	Value  float64           `json:"value"`
+	Type   MetricType        `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type errorStatus struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+}
+
+// StatusHandler returns handler describing agent state as JSON: reporters and their last results,
+// last harvest, metric values taken by last harvest, registered HTTP paths and traces, recent errors.
+// It responds with 503 Service Unavailable until Run succeeded, so it can be used as readiness probe.
+// License key and reporters keys are replaced with [REDACTED] when StatusRedactSecrets is set.
+//
+//	adminMux.Handle("/debug/gorelic", agent.StatusHandler())
+func (agent *Agent) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		status := agent.status()
+		body, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !status.Running {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(append(body, '\n'))
+	})
+}
+
+// status describes agent state, secrets are redacted if StatusRedactSecrets is set
+func (agent *Agent) status() *agentStatus {
+	stats := agent.Stats()
+	config := agent.runConfig()
+	redact := func(text string) string { return text }
+	if agent.StatusRedactSecrets {
+		redact = newSecretsRedactor(configSecrets(config)).Replace
+	}
+
+	status := &agentStatus{
+		Running:      stats.Running,
+		Name:         config.name,
+		License:      redact(config.license),
+		Harvests:     stats.Harvests,
+		Reporters:    make([]reporterStatus, 0, len(config.reporters)),
+		HTTPPaths:    agent.httpPaths(),
+		Traces:       agent.Tracer.names(),
+		RecentErrors: make([]errorStatus, 0, len(stats.RecentErrors)),
+		Metadata:     make(map[string]string, len(config.metadata)),
+		Labels:       make(map[string]string, len(config.labels)),
+	}
+	if stats.Running {
+		status.StartTime = &stats.StartTime
+	}
+	if stats.Harvests > 0 {
+		status.LastHarvest = &harvestStatus{
+			Time:           stats.LastHarvestTime,
+			DurationMs:     float64(stats.LastHarvestDuration) / float64(time.Millisecond),
+			Metrics:        stats.LastHarvestMetrics,
+			GetValueErrors: stats.GetValueErrors,
+		}
+	}
+	if status.Traces == nil {
+		status.Traces = []string{}
+	}
+
+	// reporters are listed before their first harvest, statistic is matched by position and name
+	for i, reporter := range config.reporters {
+		reporterStatus := reporterStatus{
+			Name: reporterName(reporter, i, config.reporters),
+			Type: fmt.Sprintf("%T", reporter),
+		}
+		if i < len(stats.Reporters) && stats.Reporters[i].Name == reporterStatus.Name {
+			reporterStats := &stats.Reporters[i]
+			reporterStatus.Successes = reporterStats.Successes
+			reporterStatus.Failures = reporterStats.Failures
+			reporterStatus.FailuresByReason = reporterStats.FailuresByReason
+			reporterStatus.ConsecutiveFailures = reporterStats.ConsecutiveFailures
+			reporterStatus.SentBytes = reporterStats.SentBytes
+			reporterStatus.LastError = redact(reporterStats.LastError)
+			if !reporterStats.LastAttempt.IsZero() {
+				reporterStatus.LastAttempt = &reporterStats.LastAttempt
+			}
+			if !reporterStats.LastSuccess.IsZero() {
+				reporterStatus.LastSuccess = &reporterStats.LastSuccess
+			}
+		}
+		status.Reporters = append(status.Reporters, reporterStatus)
+	}
+
+	metrics := agent.stats.lastMetrics()
+	status.Metrics = make([]metricStatus, 0, len(metrics))
+	for _, metric := range metrics {
+		status.Metrics = append(status.Metrics, metricStatus{metric.Name, metric.Units, metric.Value, metric.Type, metric.Labels})
+	}
+
+	for _, agentError := range stats.RecentErrors {
+		status.RecentErrors = append(status.RecentErrors, errorStatus{agentError.Time, agentError.Source, redact(agentError.Message)})
+	}
+	for key, value := range config.metadata {
+		status.Metadata[key] = redact(value)
+	}
+	for key, value := range config.labels {
+		status.Labels[key] = redact(value)
+	}
+	return status
+}
+
+// configSecrets returns license key, reporters keys and passwords of reporters URLs
+func configSecrets(config *runConfig) []string {
+	secrets := []string{config.license}
+	for _, reporter := range config.reporters {
+		switch reporter := reporter.(type) {
+		case *MetricAPIReporter:
+			secrets = append(secrets, reporter.License)
+		case *InsightsReporter:
+			secrets = append(secrets, reporter.InsertKey)
+		case *GraphiteAnnotationReporter:
+			secrets = append(secrets, urlPassword(reporter.URL))
+		case *InfluxDBAnnotationReporter:
+			secrets = append(secrets, urlPassword(reporter.URL))
+		}
+	}
+	return secrets
+}
+
+// urlPassword returns password of URL user info
+func urlPassword(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return ""
+	}
+	password, _ := parsed.User.Password()
+	return password
+}
+
+// newSecretsRedactor returns replacer of every non empty secret
+func newSecretsRedactor(secrets []string) *strings.Replacer {
+	var oldnew []string
+	for _, secret := range secrets {
+		if secret != "" {
+			oldnew = append(oldnew, secret, redactedValue)
+		}
+	}
+	return strings.NewReplacer(oldnew...)
+}
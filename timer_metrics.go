@@ -9,6 +9,8 @@ type baseTimerMetrica struct {
 	dataSource metrics.Timer
 	name       string
 	units      string
+	baseName   string
+	labels     map[string]string
 }
 
 func (metrica *baseTimerMetrica) GetName() string {
@@ -19,6 +21,13 @@ func (metrica *baseTimerMetrica) GetUnits() string {
 	return metrica.units
 }
 
+func (metrica *baseTimerMetrica) GetLabels() (string, map[string]string) {
+	if metrica.baseName == "" {
+		return metrica.name, nil
+	}
+	return metrica.baseName, metrica.labels
+}
+
 type timerRate1Metrica struct {
 	*baseTimerMetrica
 }
@@ -1,18 +1,23 @@
 package gorelic
 
 import (
+	"context"
 	metrics "github.com/yvasiyarov/go-metrics"
-	nrpg "github.com/yvasiyarov/newrelic_platform_go"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Tracer struct {
+	sync.Mutex
 	metrics   map[string]*TraceTransaction
-	component nrpg.IComponent
+	component iComponent
+	now       func() time.Time
 }
 
-func newTracer(component nrpg.IComponent) *Tracer {
-	return &Tracer{make(map[string]*TraceTransaction), component}
+func newTracer(component iComponent, now func() time.Time) *Tracer {
+	return &Tracer{metrics: make(map[string]*TraceTransaction), component: component, now: now}
 }
 
 func (t *Tracer) Trace(name string, traceFunc func()) {
@@ -23,22 +28,74 @@ func (t *Tracer) Trace(name string, traceFunc func()) {
 
 func (t *Tracer) BeginTrace(name string) *Trace {
 	tracerName := "Trace/" + name
+	t.Lock()
+	defer t.Unlock()
 	m := t.metrics[tracerName]
 	if m == nil {
 		t.metrics[tracerName] = &TraceTransaction{tracerName, metrics.NewTimer()}
 		m = t.metrics[tracerName]
 		m.addMetricsToComponent(t.component)
 	}
-	return &Trace{m, time.Now()}
+	return &Trace{m, t.now(), t.now, t}
+}
+
+// count returns number of traced names
+func (t *Tracer) count() int {
+	if t == nil {
+		return 0
+	}
+	t.Lock()
+	defer t.Unlock()
+	return len(t.metrics)
+}
+
+// names returns sorted traced names
+func (t *Tracer) names() []string {
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	names := make([]string, 0, len(t.metrics))
+	for name := range t.metrics {
+		names = append(names, strings.TrimPrefix(name, "Trace/"))
+	}
+	sort.Strings(names)
+	return names
 }
 
 type Trace struct {
 	transaction *TraceTransaction
 	startTime   time.Time
+	now         func() time.Time
+	tracer      *Tracer
 }
 
 func (t *Trace) EndTrace() {
-	t.transaction.timer.UpdateSince(t.startTime)
+	t.transaction.timer.Update(t.now().Sub(t.startTime))
+}
+
+// BeginSegment starts child trace reported as Trace/<trace name>/<name>
+func (t *Trace) BeginSegment(name string) *Trace {
+	return t.tracer.BeginTrace(strings.TrimPrefix(t.transaction.name, "Trace/") + "/" + name)
+}
+
+// traceContextKey is context key of Trace
+type traceContextKey struct{}
+
+// NewTraceContext returns context carrying trace, so instrumented calls made with context are recorded as its segments:
+//
+//	trace := agent.Tracer.BeginTrace("checkout")
+//	defer trace.EndTrace()
+//	req = req.WithContext(gorelic.NewTraceContext(req.Context(), trace))
+func NewTraceContext(ctx context.Context, trace *Trace) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, trace)
+}
+
+// TraceFromContext returns trace carried by context, nil if there is none
+func TraceFromContext(ctx context.Context) *Trace {
+	trace, _ := ctx.Value(traceContextKey{}).(*Trace)
+	return trace
 }
 
 type TraceTransaction struct {
@@ -46,10 +103,14 @@ type TraceTransaction struct {
 	timer metrics.Timer
 }
 
-func (transaction *TraceTransaction) addMetricsToComponent(component nrpg.IComponent) {
+func (transaction *TraceTransaction) addMetricsToComponent(component iComponent) {
+	labels := map[string]string{"trace": strings.TrimPrefix(transaction.name, "Trace/")}
+
 	tracerMean := &timerMeanMetrica{
 		baseTimerMetrica: &baseTimerMetrica{
 			name:       transaction.name + "/mean",
+			baseName:   "Trace/mean",
+			labels:     labels,
 			units:      "ms",
 			dataSource: transaction.timer,
 		},
@@ -59,6 +120,8 @@ func (transaction *TraceTransaction) addMetricsToComponent(component nrpg.ICompo
 	tracerMax := &timerMaxMetrica{
 		baseTimerMetrica: &baseTimerMetrica{
 			name:       transaction.name + "/max",
+			baseName:   "Trace/max",
+			labels:     labels,
 			units:      "ms",
 			dataSource: transaction.timer,
 		},
@@ -68,6 +131,8 @@ func (transaction *TraceTransaction) addMetricsToComponent(component nrpg.ICompo
 	tracerMin := &timerMinMetrica{
 		baseTimerMetrica: &baseTimerMetrica{
 			name:       transaction.name + "/min",
+			baseName:   "Trace/min",
+			labels:     labels,
 			units:      "ms",
 			dataSource: transaction.timer,
 		},
@@ -77,6 +142,8 @@ func (transaction *TraceTransaction) addMetricsToComponent(component nrpg.ICompo
 	tracer75 := &timerPercentile75Metrica{
 		baseTimerMetrica: &baseTimerMetrica{
 			name:       transaction.name + "/percentile75",
+			baseName:   "Trace/percentile75",
+			labels:     labels,
 			units:      "ms",
 			dataSource: transaction.timer,
 		},
@@ -86,6 +153,8 @@ func (transaction *TraceTransaction) addMetricsToComponent(component nrpg.ICompo
 	tracer90 := &timerPercentile90Metrica{
 		baseTimerMetrica: &baseTimerMetrica{
 			name:       transaction.name + "/percentile90",
+			baseName:   "Trace/percentile90",
+			labels:     labels,
 			units:      "ms",
 			dataSource: transaction.timer,
 		},
@@ -95,6 +164,8 @@ func (transaction *TraceTransaction) addMetricsToComponent(component nrpg.ICompo
 	tracer95 := &timerPercentile95Metrica{
 		baseTimerMetrica: &baseTimerMetrica{
 			name:       transaction.name + "/percentile95",
+			baseName:   "Trace/percentile95",
+			labels:     labels,
 			units:      "ms",
 			dataSource: transaction.timer,
 		},